@@ -19,6 +19,9 @@ func main() {
 	}
 	root := cmd.NewTraceCommand(streams)
 	if err := root.Execute(); err != nil {
+		if e, ok := err.(*cmd.ExitError); ok {
+			os.Exit(e.Code)
+		}
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"os"
+
+	"github.com/fntlnz/kubectl-trace/pkg/cmd"
+)
+
+func main() {
+	root := cmd.NewTraceRunnerCommand()
+	if err := root.Execute(); err != nil {
+		if e, ok := err.(*cmd.ExitError); ok {
+			os.Exit(e.Code)
+		}
+		os.Exit(1)
+	}
+}
@@ -5,11 +5,18 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"strings"
 	"time"
 
+	"github.com/fntlnz/kubectl-trace/pkg/histogram"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
 	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes/scheme"
 	tcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/kubernetes/pkg/kubectl/util/term"
@@ -23,94 +30,437 @@ import (
 
 type Attacher struct {
 	genericclioptions.IOStreams
-	ctx          context.Context
 	CoreV1Client tcorev1.CoreV1Interface
 	Config       *restclient.Config
+	tees         []io.Writer
+	jsonEvents   bool
+	render       string
+	noColor      bool
+	remoteAttach RemoteAttach
+	// maxConcurrent is how many traces attached to at once may be waited for
+	// at the same time, all of them when 0
+	maxConcurrent int
+	// ready is called once the pod of the trace ran or could not, if set
+	ready func()
 }
 
 func NewAttacher(client tcorev1.CoreV1Interface, config *restclient.Config, streams genericclioptions.IOStreams) *Attacher {
 	return &Attacher{
 		CoreV1Client: client,
 		Config:       config,
-		ctx:          context.TODO(),
 		IOStreams:    streams,
+		remoteAttach: &defaultRemoteAttach{},
 	}
 }
 
+// RemoteAttach streams the attachment to a container, through SPDY by default.
+type RemoteAttach interface {
+	Attach(method string, url *url.URL, config *restclient.Config, stdin io.Reader, stdout, stderr io.Writer, tty bool, terminalSizeQueue remotecommand.TerminalSizeQueue) error
+}
+
+// WithRemoteAttach makes the attacher stream the attachments through r, e.g. a
+// fake in tests.
+func (a *Attacher) WithRemoteAttach(r RemoteAttach) {
+	a.remoteAttach = r
+}
+
 const (
-	podNotFoundError              = "no pod found to attach with the given selector"
 	podPhaseNotAcceptedError      = "cannot attach into a container in a completed pod; current phase is %s"
+	podFailedError                = "trace pod %s cannot run: %s"
+	podUnschedulableError         = "trace pod %s cannot be scheduled: %s"
+	attachTimeoutError            = "timed out waiting to attach to the trace pod"
+	streamClosedError             = "stream closed"
+	reconnectFailedError          = "unable to reattach to the trace pod %s: %s"
+	attachDeniedWarning           = "warning: attaching to %s is not allowed (%s), following its logs instead: input and TTY are not available\n"
 	invalidPodContainersSizeError = "unexpected number of containers in trace job pod"
+	noPodRunsError                = "none of the trace pods can run"
 )
 
-func (a *Attacher) WithContext(c context.Context) {
-	a.ctx = c
+// WithTee also writes the output of the trace to w, can be repeated.
+func (a *Attacher) WithTee(w io.Writer) {
+	a.tees = append(a.tees, w)
 }
 
-func (a *Attacher) AttachJob(traceJobID types.UID, namespace string) {
-	a.Attach(fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, traceJobID), namespace)
+// WithoutColor does not color the prefixes of the traces attached to at once,
+// colored on terminals otherwise.
+func (a *Attacher) WithoutColor() {
+	a.noColor = true
 }
 
-func (a *Attacher) Attach(selector, namespace string) {
-	go wait.ExponentialBackoff(wait.Backoff{
-		Duration: time.Second * 1,
-		Factor:   0.01,
-		Jitter:   0.0,
-		Steps:    100,
-	}, func() (bool, error) {
-		pl, err := a.CoreV1Client.Pods(namespace).List(metav1.ListOptions{
-			LabelSelector: selector,
-		})
+// output provides where the output of the trace goes, out and the tees if any.
+func (a *Attacher) output(out io.Writer) io.Writer {
+	if len(a.tees) == 0 {
+		return out
+	}
+	ws := []io.Writer{out}
+	for _, tee := range a.tees {
+		// The tees never get the line endings of a TTY
+		ws = append(ws, &crlfWriter{w: tee})
+	}
+	return io.MultiWriter(ws...)
+}
+
+// WithJSONEvents re-emits the JSON lines printed by bpftrace with the trace ID,
+// node and time of each event, the attachment then goes without TTY.
+func (a *Attacher) WithJSONEvents() {
+	a.jsonEvents = true
+}
+
+// WithRender renders the histograms printed by bpftrace in the mode, one of
+// histogram.Modes, the tees still get them as printed.
+func (a *Attacher) WithRender(mode string) {
+	a.render = mode
+}
 
+// WithMaxConcurrent waits for the pods of at most n traces attached to at once
+// at the same time, the next ones being waited for once these run.
+func (a *Attacher) WithMaxConcurrent(n int) {
+	a.maxConcurrent = n
+}
+
+// podOutput provides where the output of the tracer of the pod goes.
+func (a *Attacher) podOutput(pod *corev1.Pod, out io.Writer) io.Writer {
+	if a.jsonEvents {
+		out = &crlfWriter{w: newJSONEventWriter(a.Out, pod.Labels[meta.TraceIDLabelKey], pod.Spec.NodeName)}
+	} else if len(a.render) > 0 {
+		out = histogram.NewRenderer(out, a.render)
+	}
+	return a.output(out)
+}
+
+// AttachJob attaches to the trace until the context is done, failing as soon
+// as its pod cannot run.
+func (a *Attacher) AttachJob(ctx context.Context, traceJobID types.UID, namespace string) error {
+	return a.Attach(ctx, fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, traceJobID), namespace)
+}
+
+// Attach attaches to the pod matching the selector until the context is done,
+// failing as soon as the pod cannot run, e.g. when it failed, cannot pull its
+// image or cannot be scheduled.
+func (a *Attacher) Attach(ctx context.Context, selector, namespace string) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- a.attach(ctx, selector, namespace)
+	}()
+
+	select {
+	case err := <-errc:
 		if err != nil {
-			return false, err
+			return err
 		}
+		<-ctx.Done()
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// reconnectBackoff paces the attempts to reattach after the stream dropped.
+var reconnectBackoff = wait.Backoff{
+	Duration: time.Second * 1,
+	Factor:   2,
+	Jitter:   0.0,
+	Steps:    10,
+}
 
-		if len(pl.Items) == 0 {
-			return false, fmt.Errorf(podNotFoundError)
+const (
+	// podWaitTimeout is how long to wait for the trace pod to run.
+	podWaitTimeout = time.Second * 100
+	// reconnectMaxDelay caps the delay between two reattach attempts.
+	reconnectMaxDelay = time.Second * 30
+	// reconnectResetAfter is how long an attachment has to last for the
+	// backoff to start over at the next drop.
+	reconnectResetAfter = time.Minute * 1
+)
+
+// attach attaches to the pod once it runs, failing when it cannot start, and
+// reattaches with backoff when the stream drops while the pod still runs.
+func (a *Attacher) attach(ctx context.Context, selector, namespace string) error {
+	t := setupTTY(a.IOStreams.Out, a.IOStreams.In)
+	if a.jsonEvents {
+		t.Raw = false
+	}
+
+	pod, err := a.waitForPod(ctx, selector, namespace)
+	if a.ready != nil {
+		a.ready()
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	backoff := reconnectBackoff
+	for {
+		glog.V(1).Infof("attaching to pod %s in %s", pod.Name, pod.Namespace)
+		started := time.Now()
+		err := a.attachPod(pod, t)
+		if ctx.Err() != nil {
+			return nil
+		}
+		glog.V(2).Infof("attachment to pod %s ended: %v", pod.Name, err)
+		if attachDenied(err) {
+			fmt.Fprintf(a.ErrOut, i18n.T(attachDeniedWarning), pod.Name, err)
+			return a.followLogs(ctx, pod)
 		}
-		pod := &pl.Items[0]
-		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
-			return false, fmt.Errorf(podPhaseNotAcceptedError, pod.Status.Phase)
+		if time.Since(started) > reconnectResetAfter {
+			backoff = reconnectBackoff
+		}
+		if err == nil {
+			err = fmt.Errorf(i18n.T(streamClosedError))
 		}
 
-		if len(pod.Spec.Containers) != 1 {
-			return false, fmt.Errorf(invalidPodContainersSizeError)
+		for {
+			// The stream ends with the tracer, otherwise the connection dropped
+			p, getErr := a.CoreV1Client.Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+			if errors.IsNotFound(getErr) || (getErr == nil && p.Status.Phase != corev1.PodRunning) {
+				return nil
+			}
+			if backoff.Steps < 1 {
+				return fmt.Errorf(i18n.T(reconnectFailedError), pod.Name, err)
+			}
+			delay := nextDelay(&backoff)
+			fmt.Fprintf(a.ErrOut, "lost attachment to %s (%s), reconnecting in %s\n", pod.Name, err, delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil
+			}
+			if getErr == nil {
+				break
+			}
 		}
+	}
+}
+
+// attachDenied tells whether the attach subresource refused the attachment,
+// by RBAC, admission or the container runtime, so that retrying is pointless.
+func attachDenied(err error) bool {
+	return errors.IsForbidden(err) || errors.IsMethodNotSupported(err)
+}
+
+// followLogs streams the logs of the container of the pod until it ends.
+func (a *Attacher) followLogs(ctx context.Context, pod *corev1.Pod) error {
+	rc, err := a.CoreV1Client.Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: pod.Spec.Containers[0].Name,
+		Follow:    true,
+	}).Stream()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	go func() {
+		<-ctx.Done()
+		rc.Close()
+	}()
+	_, err = io.Copy(a.podOutput(pod, a.Out), rc)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
 
-		restClient := a.CoreV1Client.RESTClient().(*restclient.RESTClient)
-		containerName := pod.Spec.Containers[0].Name
+// nextDelay provides the delay before the next attempt, stepping the backoff.
+func nextDelay(b *wait.Backoff) time.Duration {
+	delay := b.Duration
+	b.Duration = time.Duration(float64(b.Duration) * b.Factor)
+	if b.Duration > reconnectMaxDelay {
+		b.Duration = reconnectMaxDelay
+	}
+	b.Steps--
+	return delay
+}
 
-		t, err := setupTTY(a.IOStreams.Out, a.IOStreams.In)
+// waitForPod watches the pod of the trace until it runs, failing when it cannot start.
+func (a *Attacher) waitForPod(ctx context.Context, selector, namespace string) (*corev1.Pod, error) {
+	pods := a.CoreV1Client.Pods(namespace)
+	timeout := time.After(podWaitTimeout)
+
+	// The events of the pod tell whether it is being scheduled, pulling its image...
+	// and the fatal ones that it will never run
+	stopEvents := make(chan struct{})
+	defer close(stopEvents)
+	fatal := make(chan error, 1)
+	following := false
+	follow := func(pod *corev1.Pod) {
+		if !following {
+			following = true
+			go a.printEvents(pod.Namespace, pod.Name, stopEvents, fatal)
+		}
+	}
+
+	for {
+		glog.V(2).Infof("waiting for the pod matching %s in %s to run", selector, namespace)
+		pl, err := pods.List(metav1.ListOptions{
+			LabelSelector: selector,
+		})
 		if err != nil {
-			return false, err
+			return nil, err
 		}
-		ao := attach{
-			restClient:    restClient,
-			podName:       pod.Name,
-			namespace:     pod.Namespace,
-			containerName: containerName,
-			config:        a.Config,
-			tty:           t,
+		for i := range pl.Items {
+			if running, err := podRunning(&pl.Items[i]); running || err != nil {
+				return &pl.Items[i], err
+			}
+			follow(&pl.Items[i])
 		}
-		err = t.Safe(ao.defaultAttachFunc())
 
+		// The pod may not be created yet right after the job, wait for it to run
+		w, err := pods.Watch(metav1.ListOptions{
+			LabelSelector:   selector,
+			ResourceVersion: pl.ResourceVersion,
+		})
 		if err != nil {
-			// on error, just send false so that the backoff mechanism can do a new tentative
-			return false, nil
+			return nil, err
+		}
+		pod, err := a.watchPod(ctx, w, timeout, fatal, follow)
+		w.Stop()
+		if pod != nil || err != nil {
+			return pod, err
 		}
-		return true, nil
+		// The watch expired, list again to not miss any change
+	}
+}
+
+// watchPod provides the first pod that runs according to the watch, if any
+// before the watch closes, failing as soon as a fatal event of the pod happens.
+func (a *Attacher) watchPod(ctx context.Context, w watch.Interface, timeout <-chan time.Time, fatal <-chan error, waiting func(*corev1.Pod)) (*corev1.Pod, error) {
+	for {
+		select {
+		case e, ok := <-w.ResultChan():
+			if !ok {
+				return nil, nil
+			}
+			if e.Type == watch.Error {
+				return nil, errors.FromObject(e.Object)
+			}
+			pod, ok := e.Object.(*corev1.Pod)
+			if !ok || e.Type == watch.Deleted {
+				continue
+			}
+			if running, err := podRunning(pod); running || err != nil {
+				return pod, err
+			}
+			glog.V(3).Infof("pod %s is %s", pod.Name, pod.Status.Phase)
+			waiting(pod)
+		case err := <-fatal:
+			return nil, err
+		case <-timeout:
+			return nil, fmt.Errorf(i18n.T(attachTimeoutError))
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// fatalEventReasons are the reasons of the events telling that a pod will never
+// run, the trace pods being bound to their node.
+var fatalEventReasons = map[string]bool{
+	"FailedScheduling": true,
+}
+
+// printEvents prints the events of the pod as they happen, until stopped,
+// sending the first fatal one to fatal.
+func (a *Attacher) printEvents(namespace, pod string, stop <-chan struct{}, fatal chan<- error) {
+	w, err := a.CoreV1Client.Events(namespace).Watch(metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.name=%s", pod),
 	})
-	<-a.ctx.Done()
+	// The events are only informative
+	if err != nil {
+		return
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case e, ok := <-w.ResultChan():
+			if !ok {
+				return
+			}
+			ev, ok := e.Object.(*corev1.Event)
+			if !ok || e.Type == watch.Deleted {
+				continue
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			fmt.Fprintf(a.ErrOut, "%s: %s\n", ev.Reason, strings.TrimSpace(ev.Message))
+			if fatalEventReasons[ev.Reason] {
+				select {
+				case fatal <- fmt.Errorf(i18n.T(podUnschedulableError), pod, strings.TrimSpace(ev.Message)):
+				default:
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// podRunning tells whether the trace pod runs, failing when it cannot start.
+func podRunning(pod *corev1.Pod) (bool, error) {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		if reason := tracejob.PodFailureReason(*pod); len(reason) > 0 {
+			return false, fmt.Errorf(i18n.T(podFailedError), pod.Name, reason)
+		}
+		return false, fmt.Errorf(i18n.T(podPhaseNotAcceptedError), pod.Status.Phase)
+	}
+	if reason := tracejob.PodFailureReason(*pod); len(reason) > 0 {
+		return false, fmt.Errorf(i18n.T(podFailedError), pod.Name, reason)
+	}
+	// Without the events, the scheduler also tells it through the pod conditions
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse && c.Reason == corev1.PodReasonUnschedulable {
+			return false, fmt.Errorf(i18n.T(podUnschedulableError), pod.Name, c.Message)
+		}
+	}
+
+	// The tracer is the first container, sidecars like the exporter come after it
+	if len(pod.Spec.Containers) == 0 {
+		return false, fmt.Errorf(i18n.T(invalidPodContainersSizeError))
+	}
+	return pod.Status.Phase == corev1.PodRunning, nil
+}
+
+// attachPod attaches to the container of the pod until the stream ends.
+func (a *Attacher) attachPod(pod *corev1.Pod, t term.TTY) error {
+	ao := attach{
+		restClient:    a.CoreV1Client.RESTClient(),
+		remoteAttach:  a.remoteAttach,
+		podName:       pod.Name,
+		namespace:     pod.Namespace,
+		containerName: pod.Spec.Containers[0].Name,
+		config:        a.Config,
+		tty:           t,
+		out:           a.podOutput(pod, t.Out),
+	}
+
+	// since the TTY is always in raw mode when attaching do a fake resize
+	// of the screen so that it will be redrawn during attach and detach,
+	// then forward the resizes of the terminal until the session ends
+	if tsize := t.GetSize(); tsize != nil {
+		tsizeinc := *tsize
+		tsizeinc.Height++
+		tsizeinc.Width++
+		ao.terminalSizeQueue = t.MonitorSize(&tsizeinc, tsize)
+	}
+	return t.Safe(ao.defaultAttachFunc())
 }
 
 type attach struct {
-	restClient    *restclient.RESTClient
+	restClient    restclient.Interface
+	remoteAttach  RemoteAttach
 	podName       string
 	containerName string
 	namespace     string
 	config        *restclient.Config
 	tty           term.TTY
+	out           io.Writer
+
+	terminalSizeQueue remotecommand.TerminalSizeQueue
 }
 
 func (a attach) defaultAttachFunc() func() error {
@@ -122,26 +472,19 @@ func (a attach) defaultAttachFunc() func() error {
 			SubResource("attach")
 		req.VersionedParams(&corev1.PodAttachOptions{
 			Container: a.containerName,
-			Stdin:     true,
+			Stdin:     a.tty.Raw,
 			Stdout:    true,
 			Stderr:    false,
 			TTY:       a.tty.Raw,
 		}, scheme.ParameterCodec)
 
-		att := &defaultRemoteAttach{}
-
-		// since the TTY is always in raw mode when attaching do a fake resize
-		// of the screen so that it will be redrawn during attach and detach
-		tsize := a.tty.GetSize()
-		var terminalSizeQueue remotecommand.TerminalSizeQueue
-		if tsize != nil {
-			tsizeinc := *tsize
-			tsizeinc.Height++
-			tsizeinc.Width++
-			terminalSizeQueue = a.tty.MonitorSize(&tsizeinc, tsize)
+		// Without a TTY the output is streamed as is, and the input is not forwarded
+		var stdin io.Reader
+		if a.tty.Raw {
+			stdin = a.tty.In
 		}
 
-		return att.Attach("POST", req.URL(), a.config, a.tty.In, a.tty.Out, nil, a.tty.Raw, terminalSizeQueue)
+		return a.remoteAttach.Attach("POST", req.URL(), a.config, stdin, a.out, nil, a.tty.Raw, a.terminalSizeQueue)
 	}
 }
 
@@ -161,16 +504,53 @@ func (*defaultRemoteAttach) Attach(method string, url *url.URL, config *restclie
 	})
 }
 
-func setupTTY(out io.Writer, in io.Reader) (term.TTY, error) {
+// setupTTY uses a raw TTY when both the input and the output are terminals,
+// otherwise the output is piped or redirected and attaching goes without TTY.
+func setupTTY(out io.Writer, in io.Reader) term.TTY {
 	t := term.TTY{
 		Out: out,
 		In:  in,
 		Raw: true,
 	}
 
-	if !t.IsTerminalIn() {
-		return t, fmt.Errorf("unable to use a TTY if the input is not a terminal")
+	if !t.IsTerminalIn() || !t.IsTerminalOut() {
+		t.Raw = false
+		// The tracer still writes to the TTY of its container
+		t.Out = &crlfWriter{w: out}
 	}
 
-	return t, nil
+	return t
+}
+
+// crlfWriter turns the CRLF line endings written by a TTY into LF.
+type crlfWriter struct {
+	w  io.Writer
+	cr bool
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	buf := make([]byte, 0, len(p)+1)
+	if c.cr && p[0] != '\n' {
+		buf = append(buf, '\r')
+	}
+	c.cr = false
+	for i, b := range p {
+		if b == '\r' {
+			if i == len(p)-1 {
+				c.cr = true
+				continue
+			}
+			if p[i+1] == '\n' {
+				continue
+			}
+		}
+		buf = append(buf, b)
+	}
+	if _, err := c.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
@@ -0,0 +1,66 @@
+package attacher
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// jsonEventWriter re-emits the JSON lines printed by bpftrace with the trace
+// and the node they come from and when they were printed. Lines which are not
+// JSON objects, like errors, are emitted as events of the output type.
+type jsonEventWriter struct {
+	w       io.Writer
+	traceID string
+	node    string
+	line    bytes.Buffer
+	now     func() time.Time
+}
+
+func newJSONEventWriter(w io.Writer, traceID, node string) *jsonEventWriter {
+	return &jsonEventWriter{
+		w:       w,
+		traceID: traceID,
+		node:    node,
+		now:     time.Now,
+	}
+}
+
+func (j *jsonEventWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b != '\n' {
+			j.line.WriteByte(b)
+			continue
+		}
+		err := j.emit(bytes.TrimSpace(j.line.Bytes()))
+		j.line.Reset()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (j *jsonEventWriter) emit(line []byte) error {
+	if len(line) == 0 {
+		return nil
+	}
+	event := map[string]interface{}{}
+	if err := json.Unmarshal(line, &event); err != nil {
+		event = map[string]interface{}{
+			"type": "output",
+			"data": string(line),
+		}
+	}
+	event["trace_id"] = j.traceID
+	event["node"] = j.node
+	event["timestamp"] = j.now().UTC().Format(time.RFC3339Nano)
+
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = j.w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,143 @@
+package attacher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/kubernetes/pkg/kubectl/util/term"
+)
+
+// Target is a trace to attach to along with other ones.
+type Target struct {
+	ID        types.UID
+	Namespace string
+	// Prefix identifies the lines of the trace in the output, e.g. its node.
+	Prefix string
+}
+
+// prefixColors are the ANSI colors of the prefixes, cycled through the targets.
+var prefixColors = []int{32, 33, 34, 35, 36, 31}
+
+// AttachJobs attaches to several traces at once without TTY, interleaving
+// their output line by line, each line prefixed with the prefix of its trace,
+// until the context is done. It fails as soon as none of their pods can run.
+func (a *Attacher) AttachJobs(ctx context.Context, targets []Target) error {
+	out := &lockedWriter{w: a.Out}
+	errOut := &lockedWriter{w: a.ErrOut}
+	tees := []io.Writer{}
+	for _, tee := range a.tees {
+		tees = append(tees, &lockedWriter{w: tee})
+	}
+	colored := !a.noColor && term.IsTerminal(a.Out)
+
+	var wg sync.WaitGroup
+	failed := make(chan error, len(targets))
+	var slots chan struct{}
+	if a.maxConcurrent > 0 {
+		slots = make(chan struct{}, a.maxConcurrent)
+	}
+	for i, t := range targets {
+		prefix := fmt.Sprintf("[%s] ", t.Prefix)
+		coloredPrefix := prefix
+		if colored {
+			coloredPrefix = fmt.Sprintf("\x1b[%dm%s\x1b[0m", prefixColors[i%len(prefixColors)], prefix)
+		}
+
+		ta := &Attacher{
+			IOStreams: genericclioptions.IOStreams{
+				Out:    &prefixWriter{prefix: coloredPrefix, w: out},
+				ErrOut: &prefixWriter{prefix: coloredPrefix, w: errOut},
+			},
+			CoreV1Client: a.CoreV1Client,
+			Config:       a.Config,
+			jsonEvents:   a.jsonEvents,
+			render:       a.render,
+			remoteAttach: a.remoteAttach,
+		}
+		// JSON events tell their node already
+		if a.jsonEvents {
+			ta.Out = out
+		}
+		for _, tee := range tees {
+			ta.WithTee(&prefixWriter{prefix: prefix, w: tee})
+		}
+
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+			ta.ready = func() { <-slots }
+		}
+
+		wg.Add(1)
+		go func(t Target) {
+			defer wg.Done()
+			if err := ta.attach(ctx, fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, t.ID), t.Namespace); err != nil {
+				fmt.Fprintf(ta.ErrOut, "error: %s\n", err)
+				failed <- err
+			}
+		}(t)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		if len(failed) == len(targets) {
+			return fmt.Errorf(i18n.T(noPodRunsError))
+		}
+		<-ctx.Done()
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// lockedWriter serializes the writes to a writer shared by several traces.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// prefixWriter writes whole lines starting with a prefix, so that the lines of
+// several traces do not mix.
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	line   bytes.Buffer
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	for _, c := range b {
+		if p.line.Len() == 0 {
+			p.line.WriteString(p.prefix)
+		}
+		p.line.WriteByte(c)
+		if c == '\n' {
+			_, err := p.w.Write(p.line.Bytes())
+			p.line.Reset()
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(b), nil
+}
@@ -0,0 +1,199 @@
+// Package bpftrace rewrites bpftrace programs, e.g. to scope their probes to a
+// container.
+package bpftrace
+
+import (
+	"fmt"
+	"strings"
+)
+
+// untaskedProbes are the probe types not firing in the context of a task, whose
+// cgroup is then meaningless.
+var untaskedProbes = map[string]bool{
+	"BEGIN":    true,
+	"END":      true,
+	"interval": true,
+	"i":        true,
+}
+
+// declarations are the keywords starting the top level blocks that are not probes.
+var declarations = []string{"struct", "union", "enum", "config", "macro", "fn"}
+
+const (
+	unterminatedErrString = "unterminated %s in the bpftrace program"
+	mixedProbesErrString  = "cannot filter the probes %s by cgroup, BEGIN, END and interval probes must have their own action"
+)
+
+// FilterCgroup scopes the probes of the program to the cgroup at path, a
+// directory of the unified cgroup hierarchy, adding a predicate to each probe
+// or to its existing predicate. BEGIN, END and interval probes are left as is.
+func FilterCgroup(program, path string) (string, error) {
+	filter := fmt.Sprintf("cgroup == cgroupid(%q)", path)
+
+	var b strings.Builder
+	start, depth := 0, 0
+	for i := 0; i < len(program); i++ {
+		switch c := program[i]; {
+		case c == '"':
+			end := stringEnd(program, i)
+			if end < 0 {
+				return "", fmt.Errorf(unterminatedErrString, "string")
+			}
+			i = end
+		case strings.HasPrefix(program[i:], "//"):
+			end := strings.IndexByte(program[i:], '\n')
+			if end < 0 {
+				end = len(program) - i
+			}
+			i += end
+		case strings.HasPrefix(program[i:], "/*"):
+			end := strings.Index(program[i+2:], "*/")
+			if end < 0 {
+				return "", fmt.Errorf(unterminatedErrString, "comment")
+			}
+			i += end + 3
+		case c == '{':
+			if depth == 0 {
+				header, err := filterHeader(program[start:i], filter)
+				if err != nil {
+					return "", err
+				}
+				b.WriteString(header)
+				start = i
+			}
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				b.WriteString(program[start : i+1])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return "", fmt.Errorf(unterminatedErrString, "block")
+	}
+	b.WriteString(program[start:])
+	return b.String(), nil
+}
+
+// stringEnd provides the index of the quote ending the string literal starting
+// at start, -1 when it is not terminated.
+func stringEnd(program string, start int) int {
+	for i := start + 1; i < len(program); i++ {
+		switch program[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// filterHeader adds the filter to the header of a top level block, the probes
+// and the predicate if any preceding an action, along with the comments and the
+// preprocessor directives before them.
+func filterHeader(header, filter string) (string, error) {
+	// The comments are blanked out so that they are not mistaken for code, the
+	// indexes in code being the ones in the header
+	code := blankComments(header)
+
+	// The probes start after the preprocessor directives, which go as is
+	prefix := 0
+	for {
+		trimmed := strings.TrimLeft(code[prefix:], " \t\r\n;")
+		prefix = len(code) - len(trimmed)
+		if !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		end := strings.IndexByte(trimmed, '\n')
+		if end < 0 {
+			end = len(trimmed)
+		}
+		prefix += end
+	}
+
+	body := code[prefix:]
+	end := len(strings.TrimRight(body, " \t\r\n"))
+	if end == 0 {
+		return header, nil
+	}
+	for _, d := range declarations {
+		if strings.HasPrefix(body, d) && (end == len(d) || isBlank(body[len(d)])) {
+			return header, nil
+		}
+	}
+
+	// The predicate starts with the first slash after a blank, probes have
+	// slashes in their paths
+	probesEnd, predicate := end, -1
+	for i := 1; i < end; i++ {
+		if body[i] != '/' || !isBlank(body[i-1]) {
+			continue
+		}
+		before := strings.TrimRight(body[:i], " \t\r\n")
+		if strings.HasSuffix(before, ",") || strings.HasSuffix(before, ":") {
+			continue
+		}
+		probesEnd, predicate = len(before), i
+		break
+	}
+
+	probes := strings.Split(body[:probesEnd], ",")
+	untasked := 0
+	for _, p := range probes {
+		if untaskedProbes[strings.SplitN(strings.TrimSpace(p), ":", 2)[0]] {
+			untasked++
+		}
+	}
+	if untasked == len(probes) {
+		return header, nil
+	}
+	if untasked > 0 {
+		return "", fmt.Errorf(mixedProbesErrString, strings.Join(strings.Fields(body[:probesEnd]), " "))
+	}
+
+	if predicate < 0 {
+		return header[:prefix+end] + " /" + filter + "/" + header[prefix+end:], nil
+	}
+	if end-predicate < 2 || body[end-1] != '/' {
+		return "", fmt.Errorf(unterminatedErrString, "predicate")
+	}
+	inner := strings.TrimSpace(header[prefix+predicate+1 : prefix+end-1])
+	return header[:prefix+predicate] + "/(" + inner + ") && " + filter + "/" + header[prefix+end:], nil
+}
+
+// blankComments replaces the comments of s with blanks, keeping its length and
+// its lines.
+func blankComments(s string) string {
+	b := []byte(s)
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] == '"':
+			if end := stringEnd(s, i); end >= 0 {
+				i = end
+			}
+		case strings.HasPrefix(s[i:], "//"), strings.HasPrefix(s[i:], "/*"):
+			end := len(s)
+			if s[i+1] == '/' {
+				if n := strings.IndexByte(s[i:], '\n'); n >= 0 {
+					end = i + n
+				}
+			} else if n := strings.Index(s[i+2:], "*/"); n >= 0 {
+				end = i + n + 4
+			}
+			for j := i; j < end; j++ {
+				if b[j] != '\n' {
+					b[j] = ' '
+				}
+			}
+			i = end - 1
+		}
+	}
+	return string(b)
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
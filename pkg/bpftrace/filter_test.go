@@ -0,0 +1,74 @@
+package bpftrace
+
+import "testing"
+
+func TestFilterCgroup(t *testing.T) {
+	const path = "/sys/fs/cgroup/kubepods/pod1/abc"
+	tests := []struct {
+		name    string
+		program string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "probe without predicate",
+			program: `kprobe:do_nanosleep { printf("sleep by %d\n", pid); }`,
+			want:    `kprobe:do_nanosleep /cgroup == cgroupid("/sys/fs/cgroup/kubepods/pod1/abc")/ { printf("sleep by %d\n", pid); }`,
+		},
+		{
+			name:    "probe with predicate and path",
+			program: "uprobe:/bin/bash:readline /pid == 1/\n{ @[comm] = count(); }",
+			want:    "uprobe:/bin/bash:readline /(pid == 1) && cgroup == cgroupid(\"/sys/fs/cgroup/kubepods/pod1/abc\")/\n{ @[comm] = count(); }",
+		},
+		{
+			name: "begin, end, comments and several probes",
+			program: `#include <linux/sched.h>
+BEGIN { printf("{ tracing\n"); }
+// count the opens } here
+tracepoint:syscalls:sys_enter_open,
+tracepoint:syscalls:sys_enter_openat // both
+{ @[str(args->filename)] = count(); }
+END { clear(@); }`,
+			want: `#include <linux/sched.h>
+BEGIN { printf("{ tracing\n"); }
+// count the opens } here
+tracepoint:syscalls:sys_enter_open,
+tracepoint:syscalls:sys_enter_openat /cgroup == cgroupid("/sys/fs/cgroup/kubepods/pod1/abc")/ // both
+{ @[str(args->filename)] = count(); }
+END { clear(@); }`,
+		},
+		{
+			name:    "struct definition",
+			program: "struct foo { int a; }\nkprobe:f { }",
+			want:    "struct foo { int a; }\nkprobe:f /cgroup == cgroupid(\"/sys/fs/cgroup/kubepods/pod1/abc\")/ { }",
+		},
+		{
+			name:    "begin mixed with probes",
+			program: `BEGIN, kprobe:f { }`,
+			wantErr: true,
+		},
+		{
+			name:    "unterminated block",
+			program: `kprobe:f { if (1) { }`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FilterCgroup(tt.program, path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected\n%s\ngot\n%s", tt.want, got)
+			}
+		})
+	}
+}
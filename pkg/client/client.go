@@ -0,0 +1,280 @@
+// Package client creates and manages traces from Go programs, like operators,
+// chat bots or user interfaces, the way the kubectl trace commands do.
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/fntlnz/kubectl-trace/pkg/attacher"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+// TraceClient creates and manages the traces of a cluster.
+type TraceClient interface {
+	// Run creates the trace jobs, the ones without ID are given a new one, and
+	// provides them as created.
+	Run(ctx context.Context, tjs ...tracejob.TraceJob) ([]tracejob.TraceJob, error)
+	// Get provides the trace jobs of the namespace matching the filter, of all
+	// the namespaces when empty. The ID of the filter can be a prefix.
+	Get(ctx context.Context, namespace string, tf tracejob.TraceJobFilter) ([]tracejob.TraceJob, error)
+	// Delete deletes the trace jobs of the namespace matching the filter, of all
+	// the namespaces when empty. The ID of the filter can be a prefix.
+	Delete(ctx context.Context, namespace string, tf tracejob.TraceJobFilter) error
+	// Attach attaches to the trace jobs until the context is done, the output
+	// of several trace jobs is interleaved and prefixed by node. It fails as
+	// soon as their pods cannot run.
+	Attach(ctx context.Context, a *attacher.Attacher, tjs []tracejob.TraceJob) error
+	// Wait waits for the trace jobs of the namespace matching the filter to end,
+	// of all the namespaces when empty, and provides them with their final status.
+	// The ID of the filter can be a prefix.
+	Wait(ctx context.Context, namespace string, tf tracejob.TraceJobFilter) ([]tracejob.TraceJob, error)
+}
+
+var (
+	noTraceErrString       = "no trace found"
+	waitScheduledErrString = "trace %s is scheduled, it never ends"
+)
+
+// Client is the TraceClient of a cluster.
+type Client struct {
+	config    *rest.Config
+	clientset kubernetes.Interface
+
+	// DeletePropagation is how the objects of the deleted trace jobs are
+	// deleted, in the foreground by default.
+	DeletePropagation metav1.DeletionPropagation
+	// Out receives what is deleted, it is discarded by default.
+	Out io.Writer
+}
+
+var _ TraceClient = &Client{}
+
+// New provides the client of the cluster of the config, see factory.WithContext
+// to abort its requests in flight along with the contexts.
+func New(config *rest.Config) (*Client, error) {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewForClientset(clientset, config), nil
+}
+
+// NewForClientset provides the client going through the clientset, e.g. a fake
+// one in tests. The config is only needed to attach to the trace jobs.
+func NewForClientset(clientset kubernetes.Interface, config *rest.Config) *Client {
+	return &Client{
+		config:    config,
+		clientset: clientset,
+		Out:       ioutil.Discard,
+	}
+}
+
+// CoreV1 provides the core client of the cluster.
+func (c *Client) CoreV1() corev1client.CoreV1Interface {
+	return c.clientset.CoreV1()
+}
+
+// TraceJobClient provides the trace job client of the namespace, of all the
+// namespaces when empty.
+func (c *Client) TraceJobClient(namespace string) *tracejob.TraceJobClient {
+	core := c.clientset.CoreV1()
+	tc := &tracejob.TraceJobClient{
+		JobClient:     c.clientset.BatchV1().Jobs(namespace),
+		CronJobClient: c.clientset.BatchV1beta1().CronJobs(namespace),
+		ConfigClient:  core.ConfigMaps(namespace),
+		ServiceClient: core.Services(namespace),
+		SecretClient:  core.Secrets(namespace),
+		PodClient:     core.Pods(namespace),
+		EventClient:   core.Events(namespace),
+
+		DeletePropagation: c.DeletePropagation,
+	}
+	tc.WithOutStream(c.Out)
+	return tc
+}
+
+// NewTraceJob provides a trace job running the program on the node, with a new ID.
+func NewTraceJob(namespace, hostname, program string) tracejob.TraceJob {
+	tj := tracejob.TraceJob{
+		Namespace: namespace,
+		Hostname:  hostname,
+		Program:   program,
+		TTL:       &metav1.Duration{Duration: tracejob.DefaultTTL},
+	}
+	setID(&tj)
+	return tj
+}
+
+// setID gives a new ID to the trace job, along with the name of its objects.
+func setID(tj *tracejob.TraceJob) {
+	tj.ID = uuid.NewUUID()
+	tj.Name = fmt.Sprintf("%s%s", meta.ObjectNamePrefix, string(tj.ID))
+}
+
+func (c *Client) Run(ctx context.Context, tjs ...tracejob.TraceJob) ([]tracejob.TraceJob, error) {
+	created := []tracejob.TraceJob{}
+	for _, tj := range tjs {
+		if len(tj.ID) == 0 {
+			setID(&tj)
+		}
+		if _, err := c.TraceJobClient(tj.Namespace).Create(ctx, tj); err != nil {
+			return created, err
+		}
+		created = append(created, tj)
+	}
+	return created, nil
+}
+
+func (c *Client) Get(ctx context.Context, namespace string, tf tracejob.TraceJobFilter) ([]tracejob.TraceJob, error) {
+	tc := c.TraceJobClient(namespace)
+	tf, err := tc.ResolveIDPrefix(ctx, tf)
+	if err != nil {
+		return nil, err
+	}
+	return tc.GetJob(ctx, tf)
+}
+
+func (c *Client) Delete(ctx context.Context, namespace string, tf tracejob.TraceJobFilter) error {
+	tf, err := c.TraceJobClient(namespace).ResolveIDPrefix(ctx, tf)
+	if err != nil {
+		return err
+	}
+
+	// Deletions are namespaced, traces of all namespaces are deleted namespace by namespace
+	namespaces := []string{namespace}
+	if len(namespace) == 0 {
+		tjs, err := c.TraceJobClient("").GetJob(ctx, tf)
+		if err != nil {
+			return err
+		}
+		namespaces = Namespaces(tjs)
+		if len(namespaces) == 0 {
+			fmt.Fprintf(c.Out, "error: no trace found to be deleted\n")
+		}
+	}
+
+	for _, ns := range namespaces {
+		if err := c.TraceJobClient(ns).DeleteJobs(ctx, tf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewAttacher provides an attacher to the trace jobs writing to the streams.
+func (c *Client) NewAttacher(streams genericclioptions.IOStreams) *attacher.Attacher {
+	return attacher.NewAttacher(c.clientset.CoreV1(), c.config, streams)
+}
+
+func (c *Client) Attach(ctx context.Context, a *attacher.Attacher, tjs []tracejob.TraceJob) error {
+	if len(tjs) == 1 {
+		return a.AttachJob(ctx, tjs[0].ID, tjs[0].Namespace)
+	}
+	targets := []attacher.Target{}
+	for _, tj := range tjs {
+		targets = append(targets, attacher.Target{
+			ID:        tj.ID,
+			Namespace: tj.Namespace,
+			Prefix:    tj.Hostname,
+		})
+	}
+	return a.AttachJobs(ctx, targets)
+}
+
+// Wait provides the trace jobs once they are all completed, failed or deleted,
+// in which case their status is deleted. It fails for scheduled trace jobs.
+func (c *Client) Wait(ctx context.Context, namespace string, tf tracejob.TraceJobFilter) ([]tracejob.TraceJob, error) {
+	tc := c.TraceJobClient(namespace)
+	tf, err := tc.ResolveIDPrefix(ctx, tf)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []types.UID{}
+	waited := map[types.UID]tracejob.TraceJob{}
+	for {
+		// Watching before getting the trace jobs misses none of their changes
+		w, err := tc.WatchJobs(ctx, tf)
+		if err != nil {
+			return nil, err
+		}
+		tjs, err := tc.GetJob(ctx, tf)
+		if err != nil {
+			w.Stop()
+			return nil, err
+		}
+		if len(tjs) == 0 && len(ids) == 0 {
+			w.Stop()
+			return nil, fmt.Errorf(i18n.T(noTraceErrString))
+		}
+
+		ended := true
+		current := map[types.UID]bool{}
+		for _, tj := range tjs {
+			switch tj.Status {
+			case tracejob.TraceJobStatusScheduled, tracejob.TraceJobStatusSuspended:
+				w.Stop()
+				return nil, fmt.Errorf(i18n.T(waitScheduledErrString), tj.ID)
+			case tracejob.TraceJobStatusCompleted, tracejob.TraceJobStatusFailed:
+			default:
+				ended = false
+			}
+			if _, ok := waited[tj.ID]; !ok {
+				ids = append(ids, tj.ID)
+			}
+			waited[tj.ID] = tj
+			current[tj.ID] = true
+		}
+		for _, id := range ids {
+			if !current[id] {
+				tj := waited[id]
+				tj.Status = tracejob.TraceJobStatusDeleted
+				waited[id] = tj
+			}
+		}
+
+		if ended {
+			w.Stop()
+			ended := []tracejob.TraceJob{}
+			for _, id := range ids {
+				ended = append(ended, waited[id])
+			}
+			return ended, nil
+		}
+
+		// Any change of the jobs, or the end of the watch, gets them again
+		select {
+		case <-w.ResultChan():
+		case <-ctx.Done():
+		}
+		w.Stop()
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Namespaces provides the namespaces of the trace jobs, without duplicates.
+func Namespaces(tjs []tracejob.TraceJob) []string {
+	namespaces := []string{}
+	seen := map[string]bool{}
+	for _, tj := range tjs {
+		if !seen[tj.Namespace] {
+			seen[tj.Namespace] = true
+			namespaces = append(namespaces, tj.Namespace)
+		}
+	}
+	return namespaces
+}
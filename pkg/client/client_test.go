@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	batchv1beta1client "k8s.io/client-go/kubernetes/typed/batch/v1beta1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// fakeClientset keeps the jobs and the config maps in memory, the other
+// resources are not available.
+type fakeClientset struct {
+	kubernetes.Interface
+	jobs       *fakeJobs
+	configMaps *fakeConfigMaps
+}
+
+func newFakeClientset() *fakeClientset {
+	return &fakeClientset{
+		jobs:       &fakeJobs{},
+		configMaps: &fakeConfigMaps{},
+	}
+}
+
+func (f *fakeClientset) BatchV1() batchv1client.BatchV1Interface {
+	return fakeBatchV1{jobs: f.jobs}
+}
+
+func (f *fakeClientset) BatchV1beta1() batchv1beta1client.BatchV1beta1Interface {
+	return fakeBatchV1beta1{}
+}
+
+func (f *fakeClientset) CoreV1() corev1client.CoreV1Interface {
+	return fakeCoreV1{configMaps: f.configMaps}
+}
+
+type fakeBatchV1 struct {
+	batchv1client.BatchV1Interface
+	jobs *fakeJobs
+}
+
+func (f fakeBatchV1) Jobs(string) batchv1client.JobInterface { return f.jobs }
+
+type fakeBatchV1beta1 struct {
+	batchv1beta1client.BatchV1beta1Interface
+}
+
+func (fakeBatchV1beta1) CronJobs(string) batchv1beta1client.CronJobInterface { return nil }
+
+type fakeCoreV1 struct {
+	corev1client.CoreV1Interface
+	configMaps *fakeConfigMaps
+}
+
+func (f fakeCoreV1) ConfigMaps(string) corev1client.ConfigMapInterface { return f.configMaps }
+func (fakeCoreV1) Pods(string) corev1client.PodInterface               { return nil }
+func (fakeCoreV1) Services(string) corev1client.ServiceInterface       { return nil }
+func (fakeCoreV1) Secrets(string) corev1client.SecretInterface         { return nil }
+func (fakeCoreV1) Events(string) corev1client.EventInterface           { return nil }
+
+type fakeJobs struct {
+	batchv1client.JobInterface
+	items []batchv1.Job
+}
+
+func (f *fakeJobs) Create(j *batchv1.Job) (*batchv1.Job, error) {
+	j.UID = types.UID("uid-" + j.Name)
+	f.items = append(f.items, *j)
+	return j, nil
+}
+
+func (f *fakeJobs) List(opts metav1.ListOptions) (*batchv1.JobList, error) {
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	jl := &batchv1.JobList{}
+	for _, j := range f.items {
+		if selector.Matches(labels.Set(j.Labels)) {
+			jl.Items = append(jl.Items, j)
+		}
+	}
+	return jl, nil
+}
+
+func (f *fakeJobs) Watch(metav1.ListOptions) (watch.Interface, error) {
+	return watch.NewFake(), nil
+}
+
+type fakeConfigMaps struct {
+	corev1client.ConfigMapInterface
+	items []apiv1.ConfigMap
+}
+
+func (f *fakeConfigMaps) Create(cm *apiv1.ConfigMap) (*apiv1.ConfigMap, error) {
+	f.items = append(f.items, *cm)
+	return cm, nil
+}
+
+func (f *fakeConfigMaps) Update(cm *apiv1.ConfigMap) (*apiv1.ConfigMap, error) {
+	return cm, nil
+}
+
+func TestRunGet(t *testing.T) {
+	ctx := context.Background()
+	cs := newFakeClientset()
+	c := NewForClientset(cs, nil)
+
+	tjs, err := c.Run(ctx, NewTraceJob("default", "node1", "BEGIN { exit(); }"), tracejob.TraceJob{Namespace: "default", Hostname: "node2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tjs) != 2 || len(cs.jobs.items) != 2 || len(cs.configMaps.items) != 2 {
+		t.Fatalf("expected 2 trace jobs with their config maps, got %d jobs and %d config maps", len(cs.jobs.items), len(cs.configMaps.items))
+	}
+	if len(tjs[1].ID) == 0 {
+		t.Fatalf("expected a new ID for the trace job without one")
+	}
+
+	prefix := types.UID(tjs[1].ID[:8])
+	got, err := c.Get(ctx, "default", tracejob.TraceJobFilter{ID: &prefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != tjs[1].ID || got[0].Hostname != "node2" {
+		t.Fatalf("expected trace job %s on node2, got %+v", tjs[1].ID, got)
+	}
+}
+
+func TestWait(t *testing.T) {
+	ctx := context.Background()
+	cs := newFakeClientset()
+	c := NewForClientset(cs, nil)
+
+	tjs, err := c.Run(ctx, NewTraceJob("default", "node1", "BEGIN { exit(); }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs.jobs.items[0].Status.Conditions = []batchv1.JobCondition{
+		{Type: batchv1.JobComplete, Status: apiv1.ConditionTrue},
+	}
+
+	got, err := c.Wait(ctx, "default", tracejob.TraceJobFilter{ID: &tjs[0].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Status != tracejob.TraceJobStatusCompleted {
+		t.Fatalf("expected the trace job completed, got %+v", got)
+	}
+
+	missing := types.UID("missing")
+	if _, err := c.Wait(ctx, "default", tracejob.TraceJobFilter{ID: &missing}); err == nil {
+		t.Fatalf("expected an error waiting for no trace job")
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	tjs := []tracejob.TraceJob{{Namespace: "a"}, {Namespace: "b"}, {Namespace: "a"}}
+	if got := Namespaces(tjs); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("expected [a b], got %v", got)
+	}
+}
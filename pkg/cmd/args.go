@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"regexp"
+
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// idRegexp matches the trace IDs and their prefixes, the names given to traces
+// do not match it.
+var idRegexp = regexp.MustCompile(`^[0-9a-f-]+$`)
+
+// parseTraceArg parses the trace name or ID of an argument. Names of traces
+// only having the prefix of their ID select them by ID, like ID prefixes do,
+// and names given with --name select them with or without their prefix.
+func parseTraceArg(arg string) (*string, *types.UID) {
+	arg = meta.TrimResource(arg)
+	id := arg
+	if meta.IsObjectName(arg) {
+		if len(arg) == len(meta.ObjectNamePrefix)+tracejob.IDLength {
+			return &arg, nil
+		}
+		id = arg[len(meta.ObjectNamePrefix):]
+	}
+	if !idRegexp.MatchString(id) {
+		name := meta.ObjectNamePrefix + id
+		return &name, nil
+	}
+	tid := types.UID(id)
+	return nil, &tid
+}
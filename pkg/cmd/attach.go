@@ -3,22 +3,27 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/fntlnz/kubectl-trace/pkg/attacher"
+	"github.com/fntlnz/kubectl-trace/pkg/client"
 	"github.com/fntlnz/kubectl-trace/pkg/factory"
-	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/histogram"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/recording"
 	"github.com/fntlnz/kubectl-trace/pkg/signals"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
 	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
-	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
-	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 )
 
 var (
-	attachShort = `` // Wrap with i18n.T()
+	attachShort = ``
 	attachLong  = attachShort + `
 
 ...`
@@ -28,7 +33,13 @@ var (
   %[1]s trace attach -h
 
   # ...
-  %[1]s trace attach`
+  %[1]s trace attach
+
+  # Attach to all the traces created by one invocation on many nodes
+  %[1]s trace attach --group 4f9c2a1b
+
+  # Attach drawing the histograms of the trace as bar charts
+  %[1]s trace attach 656ee75a-ee3c-11e8-9e7a-8c164500a77e --render bars`
 )
 
 // AttachOptions ...
@@ -38,6 +49,10 @@ type AttachOptions struct {
 	traceName    *string
 	namespace    string
 	clientConfig *rest.Config
+	outputFile   string
+	recordFile   string
+	group        string
+	render       string
 }
 
 // NewAttachOptions provides an instance of AttachOptions with default values.
@@ -52,11 +67,10 @@ func NewAttachCommand(factory factory.Factory, streams genericclioptions.IOStrea
 	o := NewAttachOptions(streams)
 
 	cmd := &cobra.Command{
-		Use:                   "attach (TRACE_ID | TRACE_NAME)",
-		DisableFlagsInUseLine: true,
-		Short:                 attachShort,
-		Long:                  attachLong,                             // Wrap with templates.LongDesc()
-		Example:               fmt.Sprintf(attachExamples, "kubectl"), // Wrap with templates.Examples()
+		Use:     "attach (TRACE_ID | TRACE_NAME | --group GROUP)",
+		Short:   i18n.T(attachShort),
+		Long:    templates.LongDesc(i18n.T(attachLong)),
+		Example: templates.Examples(fmt.Sprintf(i18n.T(attachExamples), "kubectl")),
 		PreRunE: func(c *cobra.Command, args []string) error {
 			return o.Validate(c, args)
 		},
@@ -72,21 +86,29 @@ func NewAttachCommand(factory factory.Factory, streams genericclioptions.IOStrea
 		},
 	}
 
+	cmd.Flags().StringVar(&o.outputFile, "output-file", o.outputFile, "File to also write the output of the trace to")
+	cmd.Flags().StringVar(&o.recordFile, "record", o.recordFile, "File to record the output of the trace to with the time of each line, to be replayed with the replay command")
+	cmd.Flags().StringVar(&o.render, "render", o.render, fmt.Sprintf("Render the histograms printed by bpftrace, one of: %s", strings.Join(histogram.Modes, ", ")))
+	cmd.Flags().StringVar(&o.group, "group", o.group, "Attach to all the traces of this group, created by one invocation")
+
 	return cmd
 }
 
 func (o *AttachOptions) Validate(cmd *cobra.Command, args []string) error {
 	switch len(args) {
 	case 1:
-		if meta.IsObjectName(args[0]) {
-			o.traceName = &args[0]
-		} else {
-			tid := types.UID(args[0])
-			o.traceID = &tid
-		}
+		o.traceName, o.traceID = parseTraceArg(args[0])
 		break
+	case 0:
+		if len(o.group) > 0 {
+			break
+		}
+		fallthrough
 	default:
-		return fmt.Errorf("(TRACE_ID | TRACE_NAME) is a required argument for the attach command")
+		return fmt.Errorf(i18n.T("(TRACE_ID | TRACE_NAME) is a required argument for the attach command"))
+	}
+	if len(o.render) > 0 {
+		return validateRender(o.render)
 	}
 
 	return nil
@@ -110,41 +132,71 @@ func (o *AttachOptions) Complete(factory factory.Factory, cmd *cobra.Command, ar
 }
 
 func (o *AttachOptions) Run() error {
-	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	// Interrupting aborts the requests in flight too
+	ctx := signals.WithStandardSignals(context.Background())
+	c, err := client.New(factory.WithContext(ctx, o.clientConfig))
 	if err != nil {
 		return err
 	}
 
-	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	jobs, err := c.Get(ctx, o.namespace, tracejob.TraceJobFilter{
+		Name:  o.traceName,
+		ID:    o.traceID,
+		Group: o.group,
+	})
 	if err != nil {
 		return err
 	}
 
-	tc := &tracejob.TraceJobClient{
-		JobClient: jobsClient.Jobs(o.namespace),
+	if len(jobs) == 0 {
+		return fmt.Errorf(i18n.T("no trace found with the provided criterias"))
 	}
 
-	tf := tracejob.TraceJobFilter{
-		Name: o.traceName,
-		ID:   o.traceID,
+	a := c.NewAttacher(o.IOStreams)
+	if !colored(o.Out) {
+		a.WithoutColor()
 	}
-
-	jobs, err := tc.GetJob(tf)
-
+	if len(o.render) > 0 {
+		a.WithRender(o.render)
+	}
+	closeOutputs, err := attachOutputs(a, o.outputFile, o.recordFile)
 	if err != nil {
 		return err
 	}
-
-	if len(jobs) == 0 {
-		return fmt.Errorf("no trace found with the provided criterias")
+	defer closeOutputs()
+	if len(o.group) == 0 {
+		jobs = jobs[:1]
 	}
+	return c.Attach(ctx, a, jobs)
+}
 
-	job := jobs[0]
+// attachOutputs makes the attacher also write the output of the trace to the
+// output file and to the recording, when set, providing how to close them.
+func attachOutputs(a *attacher.Attacher, outputFile, recordFile string) (func(), error) {
+	closers := []io.Closer{}
+	closeAll := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i].Close()
+		}
+	}
 
-	ctx := context.Background()
-	ctx = signals.WithStandardSignals(ctx)
-	a := attacher.NewAttacher(coreClient, o.clientConfig, o.IOStreams)
-	a.WithContext(ctx)
-	a.AttachJob(job.ID, job.Namespace)
-	return nil
+	if len(outputFile) > 0 {
+		f, err := os.Create(outputFile)
+		if err != nil {
+			return nil, err
+		}
+		closers = append(closers, f)
+		a.WithTee(f)
+	}
+	if len(recordFile) > 0 {
+		f, err := os.Create(recordFile)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		r := recording.NewRecorder(f)
+		closers = append(closers, f, r)
+		a.WithTee(r)
+	}
+	return closeAll, nil
 }
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/pflag"
+	"k8s.io/kubernetes/pkg/kubectl/util/term"
+)
+
+// noColorEnv disables the colors when set, see https://no-color.org.
+const noColorEnv = "NO_COLOR"
+
+// noColor disables the colors of the output.
+var noColor bool
+
+// addColorFlags adds the flag disabling the colors of the output.
+func addColorFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&noColor, "no-color", noColor, fmt.Sprintf("Disable the colors of the output, as does setting %s. Only terminals are colored", noColorEnv))
+}
+
+// colored tells whether the output written to w is colored: it is on terminals,
+// unless disabled by --no-color or NO_COLOR.
+func colored(w io.Writer) bool {
+	return !noColor && len(os.Getenv(noColorEnv)) == 0 && term.IsTerminal(w)
+}
+
+// statusColors are the ANSI colors of the statuses of the traces, all of two
+// digits so that colored columns stay aligned.
+var statusColors = map[tracejob.TraceJobStatus]int{
+	tracejob.TraceJobStatusCreated:   33,
+	tracejob.TraceJobStatusRunning:   32,
+	tracejob.TraceJobStatusCompleted: 36,
+	tracejob.TraceJobStatusFailed:    31,
+	tracejob.TraceJobStatusScheduled: 34,
+	tracejob.TraceJobStatusSuspended: 90,
+	tracejob.TraceJobStatusDeleted:   90,
+}
+
+// defaultColor is the default color of the terminal, coloring the headers of
+// colored columns as wide as their cells.
+const defaultColor = 39
+
+// colorize wraps s in the ANSI escape sequences of the color.
+func colorize(s string, color int) string {
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, s)
+}
+
+// colorStatus colors the status of the trace job, along with its reason.
+func colorStatus(j tracejob.TraceJob) string {
+	color, ok := statusColors[j.Status]
+	if !ok {
+		color = defaultColor
+	}
+	return colorize(jobStatus(j), color)
+}
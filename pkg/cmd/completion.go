@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+var (
+	completionShort = `Output the shell completion code of kubectl-trace`
+	completionLong  = completionShort + `
+
+The completion suggests the commands and the flags, along with the nodes and the
+pods to trace and the IDs of the existing traces, for bash and zsh.`
+
+	completionExamples = `
+  # Load the bash completion in the current shell
+  source <(%[1]s-trace completion bash)
+
+  # Load the zsh completion in the current shell
+  source <(%[1]s-trace completion zsh)`
+
+	completionShellErrString = "the shell must be one of %v"
+)
+
+// completionShells generate the completion code for each shell.
+var completionShells = map[string]func(io.Writer, *cobra.Command) error{
+	"bash": genCompletionBash,
+	"zsh":  genCompletionZsh,
+}
+
+// completionKinds are what the completion suggests, provided by __complete.
+const (
+	completeTargets    = "targets"
+	completeContainers = "containers"
+	completeTraces     = "traces"
+)
+
+// bashCompletionFunc suggests the targets and the trace IDs when the commands
+// have nothing to suggest, with the connection flags of the command line.
+const bashCompletionFunc = `
+__kubectl_trace_override_flag_list=(--kubeconfig --cluster --user --context --namespace --server -n -s)
+__kubectl_trace_override_flags()
+{
+    local ${__kubectl_trace_override_flag_list[*]##*-} two_word_of of var
+    for w in "${words[@]}"; do
+        if [ -n "${two_word_of}" ]; then
+            eval "${two_word_of##*-}=\"${two_word_of}=\${w}\""
+            two_word_of=
+            continue
+        fi
+        for of in "${__kubectl_trace_override_flag_list[@]}"; do
+            case "${w}" in
+                ${of}=*)
+                    eval "${of##*-}=\"${w}\""
+                    ;;
+                ${of})
+                    two_word_of="${of}"
+                    ;;
+            esac
+        done
+    done
+    for var in "${__kubectl_trace_override_flag_list[@]##*-}"; do
+        if eval "test -n \"\$${var}\""; then
+            eval "echo -n \${${var}}' '"
+        fi
+    done
+}
+
+__kubectl_trace_complete()
+{
+    local out
+    if out=$("${words[0]}" __complete "$@" $(__kubectl_trace_override_flags) 2>/dev/null); then
+        COMPREPLY=( $( compgen -W "${out[*]}" -- "$cur" ) )
+    fi
+}
+
+__kubectl_trace_get_containers()
+{
+    local len=${#nouns[@]}
+    if [[ ${len} -ge 1 ]]; then
+        __kubectl_trace_complete containers "${nouns[${len}-1]#pod/}"
+    fi
+}
+
+__custom_func() {
+    case ${last_command} in
+        trace_run | trace_generate)
+            if [[ ${#nouns[@]} -eq 0 ]]; then
+                __kubectl_trace_complete targets
+            fi
+            return
+            ;;
+        trace_attach | trace_delete | trace_get | trace_describe | trace_diagnose | trace_logs | trace_results | trace_stop | trace_wait | trace_shell | trace_kill | trace_flamegraph | trace_top)
+            __kubectl_trace_complete traces
+            return
+            ;;
+        *)
+            ;;
+    esac
+}
+`
+
+// CompletionOptions ...
+type CompletionOptions struct {
+	genericclioptions.IOStreams
+	shell string
+}
+
+// NewCompletionOptions provides an instance of CompletionOptions with default values.
+func NewCompletionOptions(streams genericclioptions.IOStreams) *CompletionOptions {
+	return &CompletionOptions{
+		IOStreams: streams,
+	}
+}
+
+// NewCompletionCommand provides the completion command wrapping CompletionOptions.
+func NewCompletionCommand(streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewCompletionOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "completion SHELL",
+		Short:        i18n.T(completionShort),
+		Long:         templates.LongDesc(i18n.T(completionLong)),
+		Example:      templates.Examples(fmt.Sprintf(i18n.T(completionExamples), "kubectl")),
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		ValidArgs:    []string{"bash", "zsh"},
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			return completionShells[o.shell](o.Out, c.Root())
+		},
+	}
+
+	return cmd
+}
+
+func (o *CompletionOptions) Validate(cmd *cobra.Command, args []string) error {
+	o.shell = args[0]
+	if _, ok := completionShells[o.shell]; !ok {
+		return fmt.Errorf(i18n.T(completionShellErrString), cmd.ValidArgs)
+	}
+	return nil
+}
+
+// genCompletionBash generates the bash completion of the root command, bound to
+// the kubectl-trace binary too.
+func genCompletionBash(out io.Writer, root *cobra.Command) error {
+	if err := root.GenBashCompletion(out); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(out, "complete -o default -F __start_%[1]s kubectl-%[1]s\n", root.Name())
+	return err
+}
+
+// genCompletionZsh generates the bash completion, loaded through the bash
+// completion emulation of zsh so that it suggests the same.
+func genCompletionZsh(out io.Writer, root *cobra.Command) error {
+	buf := new(bytes.Buffer)
+	if err := genCompletionBash(buf, root); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "autoload -U +X compinit && compinit")
+	fmt.Fprintln(out, "autoload -U +X bashcompinit && bashcompinit")
+	_, err := buf.WriteTo(out)
+	return err
+}
+
+// NewCompleteCommand provides the hidden command listing what the completion
+// suggests: the targets, the containers of a pod or the trace IDs.
+func NewCompleteCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	return &cobra.Command{
+		Use:    "__complete (targets | containers POD | traces)",
+		Hidden: true,
+		Args:   cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			candidates, err := completions(factory, args)
+			if err != nil {
+				return err
+			}
+			for _, candidate := range candidates {
+				fmt.Fprintln(streams.Out, candidate)
+			}
+			return nil
+		},
+	}
+}
+
+// completions lists the candidates of a completion kind.
+func completions(factory factory.Factory, args []string) ([]string, error) {
+	namespace, _, err := factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := factory.KubernetesClientSet()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []string{}
+	switch args[0] {
+	case completeTargets:
+		nl, err := clientset.CoreV1().Nodes().List(metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range nl.Items {
+			candidates = append(candidates, n.Name)
+		}
+		pl, err := clientset.CoreV1().Pods(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pl.Items {
+			candidates = append(candidates, "pod/"+p.Name)
+		}
+	case completeContainers:
+		if len(args) < 2 {
+			return nil, fmt.Errorf(i18n.T("the pod is required to complete its containers"))
+		}
+		pod, err := clientset.CoreV1().Pods(namespace).Get(args[1], metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range pod.Spec.Containers {
+			candidates = append(candidates, c.Name)
+		}
+	case completeTraces:
+		jl, err := clientset.BatchV1().Jobs(namespace).List(metav1.ListOptions{
+			LabelSelector: meta.TraceIDLabelKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, j := range jl.Items {
+			candidates = append(candidates, j.Labels[meta.TraceIDLabelKey])
+		}
+	default:
+		return nil, fmt.Errorf(i18n.T("unknown completion %s"), args[0])
+	}
+	return candidates, nil
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+)
+
+// configFile is the file of the defaults of the flags, in the kubectl-trace
+// directory of the home directory.
+const configFile = "config.yaml"
+
+const (
+	configErrString      = "error reading the config file %s: %v"
+	configValueErrString = "invalid value of %s in the %s: %v"
+)
+
+// loadConfig loads the defaults of the flags from the config file at path, or
+// from the default config file when path is empty, which may be missing.
+// The config file maps the names of the flags to their values, lists for the
+// flags that can be repeated:
+//
+//	imagename: quay.io/myorg/kubectl-trace-bpftrace:v1
+//	serviceaccount: tracer
+//	limits: cpu=1,memory=512Mi
+//	toleration:
+//	- dedicated=tracing:NoSchedule
+//	deny-node:
+//	- env=production
+func loadConfig(path string) (map[string]interface{}, error) {
+	explicit := len(path) > 0
+	if !explicit {
+		home, err := homeDir()
+		if err != nil {
+			return nil, nil
+		}
+		path = filepath.Join(home, traceHomeDir, configFile)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(i18n.T(configErrString), path, err)
+	}
+	config := map[string]interface{}{}
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf(i18n.T(configErrString), path, err)
+	}
+	return config, nil
+}
+
+// envPrefix is the prefix of the environment variables holding the defaults of
+// the flags, followed by their name in upper case with underscores, e.g.
+// KUBECTL_TRACE_SERVICEACCOUNT for --serviceaccount.
+const envPrefix = "KUBECTL_TRACE_"
+
+// envAliases are shorter names of the environment variables of some flags.
+var envAliases = map[string]string{
+	"IMAGE": "imagename",
+}
+
+// envDefaults provides the defaults of the flags set in the environment.
+func envDefaults(flags *pflag.FlagSet, getenv func(string) string) map[string]interface{} {
+	defaults := map[string]interface{}{}
+	flags.VisitAll(func(f *pflag.Flag) {
+		if v := getenv(envPrefix + strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))); len(v) > 0 {
+			defaults[f.Name] = v
+		}
+	})
+	for alias, name := range envAliases {
+		if _, ok := defaults[name]; ok {
+			continue
+		}
+		if v := getenv(envPrefix + alias); len(v) > 0 {
+			defaults[name] = v
+		}
+	}
+	return defaults
+}
+
+// applyDefaults sets the flags that were not given on the command line to their
+// defaults, like if they had been given. Defaults of flags the command does not
+// have are ignored, the config file is shared by all the commands.
+func applyDefaults(flags *pflag.FlagSet, defaults map[string]interface{}, source string) error {
+	for name, value := range defaults {
+		f := flags.Lookup(name)
+		if f == nil || f.Changed {
+			continue
+		}
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+		for _, v := range values {
+			if err := flags.Set(name, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf(i18n.T(configValueErrString), name, source, err)
+			}
+		}
+	}
+	return nil
+}
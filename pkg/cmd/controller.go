@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fntlnz/kubectl-trace/pkg/controller"
+	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/signals"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	controllerShort = `Reconcile TraceJob resources into trace jobs`
+	controllerLong  = controllerShort + `
+
+The controller watches the TraceJob custom resources and creates the trace jobs they
+declare, so that traces can be managed declaratively. It is meant to run in the
+cluster, see the manifests in the deploy directory.`
+
+	controllerExamples = `
+  # Reconcile the TraceJob resources of all the namespaces
+  %[1]s trace controller --all-namespaces
+
+  # Reconcile the TraceJob resources of a specific namespace
+  %[1]s trace controller -n myns`
+)
+
+// ControllerOptions ...
+type ControllerOptions struct {
+	genericclioptions.IOStreams
+
+	namespace     string
+	allNamespaces bool
+
+	client    dynamic.Interface
+	clientset kubernetes.Interface
+}
+
+// NewControllerOptions provides an instance of ControllerOptions with default values.
+func NewControllerOptions(streams genericclioptions.IOStreams) *ControllerOptions {
+	return &ControllerOptions{
+		IOStreams: streams,
+	}
+}
+
+// NewControllerCommand provides the controller command wrapping ControllerOptions.
+func NewControllerCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewControllerOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "controller",
+		Short:        i18n.T(controllerShort),
+		Long:         templates.LongDesc(i18n.T(controllerLong)),
+		Example:      templates.Examples(fmt.Sprintf(i18n.T(controllerExamples), "kubectl")),
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().BoolVar(&o.allNamespaces, "all-namespaces", o.allNamespaces, "If present, reconcile the TraceJob resources across all namespaces")
+
+	return cmd
+}
+
+// Complete completes the setup of the command.
+func (o *ControllerOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+	if o.allNamespaces {
+		o.namespace = ""
+	}
+
+	o.client, err = factory.DynamicClient()
+	if err != nil {
+		return err
+	}
+
+	o.clientset, err = factory.KubernetesClientSet()
+	return err
+}
+
+// Run executes the controller until interrupted.
+func (o *ControllerOptions) Run() error {
+	ctx := signals.WithStandardSignals(context.Background())
+	c := controller.NewController(o.client, o.clientset, o.namespace, o.ErrOut)
+	return c.Run(ctx)
+}
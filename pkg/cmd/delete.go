@@ -1,21 +1,24 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/fntlnz/kubectl-trace/pkg/client"
 	"github.com/fntlnz/kubectl-trace/pkg/factory"
-	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
 	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
-	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
-	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 )
 
 var (
-	deleteShort = `Delete a bpftrace program execution` // Wrap with i18n.T()
+	deleteShort = `Delete a bpftrace program execution`
 	deleteLong  = `
 ...`
 
@@ -29,10 +32,33 @@ var (
   # Delete all bpftrace programs in a specific namespace
   %[1]s trace delete -n myns --all
 
+  # Delete the bpftrace programs created by one invocation on many nodes
+  %[1]s trace delete --group 4f9c2a1b
+
+  # Delete the bpftrace programs matching a label selector
+  %[1]s trace delete -l team=storage
+
   # Delete all bpftrace programs in all the namespaces
-  %[1]s trace delete --all-namespaces`
+  %[1]s trace delete -A --all
+
+  # Delete a specific bpftrace program by ID, whatever its namespace
+  %[1]s trace delete -A 656ee75a-ee3c-11e8-9e7a-8c164500a77e`
 )
 
+const (
+	cascadeForeground = "foreground"
+	cascadeBackground = "background"
+	cascadeOrphan     = "orphan"
+
+	cascadeErrString = "unknown cascade %s, one of: %s, %s, %s"
+)
+
+var cascadePropagations = map[string]metav1.DeletionPropagation{
+	cascadeForeground: metav1.DeletePropagationForeground,
+	cascadeBackground: metav1.DeletePropagationBackground,
+	cascadeOrphan:     metav1.DeletePropagationOrphan,
+}
+
 // DeleteOptions ...
 type DeleteOptions struct {
 	genericclioptions.IOStreams
@@ -43,18 +69,21 @@ type DeleteOptions struct {
 	clientConfig         *rest.Config
 	all                  bool
 	allNamespaces        bool
+	selector             string
+	group                string
+	cascade              string
 }
 
 // NewDeleteOptions provides an instance of DeleteOptions with default values.
 func NewDeleteOptions(streams genericclioptions.IOStreams) *DeleteOptions {
 	rbFlags := &genericclioptions.ResourceBuilderFlags{}
-	rbFlags.WithAllNamespaces(false)
 	rbFlags.WithAll(false)
 
 	return &DeleteOptions{
 		ResourceBuilderFlags: rbFlags,
 		IOStreams:            streams,
 		all:                  false,
+		cascade:              cascadeForeground,
 	}
 }
 
@@ -64,9 +93,9 @@ func NewDeleteCommand(factory factory.Factory, streams genericclioptions.IOStrea
 
 	cmd := &cobra.Command{
 		Use:     "delete (TRACE_ID | TRACE_NAME)",
-		Short:   deleteShort,
-		Long:    deleteLong,                             // Wrap with templates.LongDesc()
-		Example: fmt.Sprintf(deleteExamples, "kubectl"), // Wrap with templates.Examples()
+		Short:   i18n.T(deleteShort),
+		Long:    templates.LongDesc(i18n.T(deleteLong)),
+		Example: templates.Examples(fmt.Sprintf(i18n.T(deleteExamples), "kubectl")),
 		PreRunE: func(c *cobra.Command, args []string) error {
 			return o.Validate(c, args)
 		},
@@ -83,6 +112,10 @@ func NewDeleteCommand(factory factory.Factory, streams genericclioptions.IOStrea
 	}
 
 	o.ResourceBuilderFlags.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&o.cascade, "cascade", o.cascade, fmt.Sprintf("How the pods of the traces are deleted, one of: %s (before the traces), %s (after the traces), %s (left running)", cascadeForeground, cascadeBackground, cascadeOrphan))
+	cmd.Flags().StringVarP(&o.selector, "selector", "l", o.selector, "Delete the traces matching this label selector, e.g. team=storage")
+	cmd.Flags().StringVar(&o.group, "group", o.group, groupUsage)
+	cmd.Flags().BoolVarP(&o.allNamespaces, "all-namespaces", "A", o.allNamespaces, allNamespacesUsage)
 
 	return cmd
 }
@@ -90,15 +123,19 @@ func NewDeleteCommand(factory factory.Factory, streams genericclioptions.IOStrea
 func (o *DeleteOptions) Validate(cmd *cobra.Command, args []string) error {
 	switch len(args) {
 	case 1:
-		if meta.IsObjectName(args[0]) {
-			o.traceName = &args[0]
-		} else {
-			tid := types.UID(args[0])
-			o.traceID = &tid
-		}
+		o.traceName, o.traceID = parseTraceArg(args[0])
 		break
 	}
 
+	if len(o.selector) > 0 {
+		if _, err := labels.Parse(o.selector); err != nil {
+			return err
+		}
+	}
+	if _, ok := cascadePropagations[o.cascade]; !ok {
+		return fmt.Errorf(i18n.T(cascadeErrString), o.cascade, cascadeForeground, cascadeBackground, cascadeOrphan)
+	}
+
 	return nil
 }
 
@@ -110,8 +147,7 @@ func (o *DeleteOptions) Complete(factory factory.Factory, cmd *cobra.Command, ar
 		return err
 	}
 
-	if cmd.Flag("all-namespaces").Changed {
-		o.allNamespaces = *o.ResourceBuilderFlags.AllNamespaces
+	if o.allNamespaces {
 		o.namespace = ""
 	}
 
@@ -125,39 +161,25 @@ func (o *DeleteOptions) Complete(factory factory.Factory, cmd *cobra.Command, ar
 		return err
 	}
 
-	if o.traceID == nil && o.traceName == nil && o.all == false {
-		return fmt.Errorf("when no trace id or trace name are specified you must specify --all=true to delete all the traces")
+	if o.traceID == nil && o.traceName == nil && len(o.selector) == 0 && len(o.group) == 0 && o.all == false {
+		return fmt.Errorf(i18n.T("when no trace id, trace name, group or selector are specified you must specify --all=true to delete all the traces"))
 	}
 	return nil
 }
 
 func (o *DeleteOptions) Run() error {
-	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	c, err := client.New(o.clientConfig)
 	if err != nil {
 		return err
 	}
-
-	coreClient, err := corev1client.NewForConfig(o.clientConfig)
-	if err != nil {
-		return err
-	}
-
-	tc := &tracejob.TraceJobClient{
-		JobClient:    jobsClient.Jobs(o.namespace),
-		ConfigClient: coreClient.ConfigMaps(o.namespace),
-	}
-
-	tc.WithOutStream(o.Out)
+	c.DeletePropagation = cascadePropagations[o.cascade]
+	c.Out = o.Out
 
 	tf := tracejob.TraceJobFilter{
-		Name: o.traceName,
-		ID:   o.traceID,
+		Name:     o.traceName,
+		ID:       o.traceID,
+		Group:    o.group,
+		Selector: o.selector,
 	}
-
-	err = tc.DeleteJobs(tf)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return c.Delete(context.Background(), o.namespace, tf)
 }
@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	batchv1beta1client "k8s.io/client-go/kubernetes/typed/batch/v1beta1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	describeShort = `Show the details of a trace`
+	describeLong  = describeShort + `
+
+The details include the target and the program of the trace, the state of its pod
+and containers, the related events and how to get its output.`
+
+	describeExamples = `
+  # Describe a trace by ID
+  %[1]s trace describe 656ee75a-ee3c-11e8-9e7a-8c164500a77e
+
+  # Describe a trace by name in a specific namespace
+  %[1]s trace describe kubectl-trace-1bb3ae39-efe8-11e8-9f29-8c164500a77e -n myns`
+
+	describeArgErrString = "(TRACE_ID | TRACE_NAME) is a required argument for the describe command"
+	traceNotFoundErr     = "no trace found with the provided criterias"
+)
+
+// DescribeOptions ...
+type DescribeOptions struct {
+	genericclioptions.IOStreams
+	traceID      *types.UID
+	traceName    *string
+	namespace    string
+	clientConfig *rest.Config
+}
+
+// NewDescribeOptions provides an instance of DescribeOptions with default values.
+func NewDescribeOptions(streams genericclioptions.IOStreams) *DescribeOptions {
+	return &DescribeOptions{
+		IOStreams: streams,
+	}
+}
+
+// NewDescribeCommand provides the describe command wrapping DescribeOptions.
+func NewDescribeCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewDescribeOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "describe (TRACE_ID | TRACE_NAME)",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T(describeShort),
+		Long:                  templates.LongDesc(i18n.T(describeLong)),
+		Example:               templates.Examples(fmt.Sprintf(i18n.T(describeExamples), "kubectl")),
+		SilenceUsage:          true,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating DescribeOptions accordingly.
+func (o *DescribeOptions) Validate(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf(i18n.T(describeArgErrString))
+	}
+	o.traceName, o.traceID = parseTraceArg(args[0])
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *DescribeOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.clientConfig, err = factory.ToRESTConfig()
+	return err
+}
+
+// Run prints the details of the trace.
+func (o *DescribeOptions) Run() error {
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	cronJobsClient, err := batchv1beta1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient:     jobsClient.Jobs(o.namespace),
+		CronJobClient: cronJobsClient.CronJobs(o.namespace),
+		ConfigClient:  coreClient.ConfigMaps(o.namespace),
+		PodClient:     coreClient.Pods(o.namespace),
+	}
+
+	ctx := context.Background()
+	tf, err := tc.ResolveIDPrefix(ctx, tracejob.TraceJobFilter{
+		Name: o.traceName,
+		ID:   o.traceID,
+	})
+	if err != nil {
+		return err
+	}
+	tjs, err := tc.GetJob(ctx, tf)
+	if err != nil {
+		return err
+	}
+	if len(tjs) == 0 {
+		return fmt.Errorf(i18n.T(traceNotFoundErr))
+	}
+	tj := tjs[0]
+	selector := metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, tj.ID),
+	}
+
+	// Scheduled traces have no job until their first run
+	var spec *v1.PodSpec
+	jl, err := tc.JobClient.List(selector)
+	if err != nil {
+		return err
+	}
+	if len(jl.Items) > 0 {
+		spec = &jl.Items[0].Spec.Template.Spec
+	} else if len(tj.Schedule) > 0 {
+		cj, err := tc.CronJobClient.Get(tj.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		spec = &cj.Spec.JobTemplate.Spec.Template.Spec
+	}
+
+	program := ""
+	if cm, err := tc.ConfigClient.Get(tj.Name, metav1.GetOptions{}); err == nil {
+		program, _ = tracejob.Program(*cm)
+	} else if s, err := coreClient.Secrets(tj.Namespace).Get(tj.Name, metav1.GetOptions{}); err == nil {
+		program, _ = tracejob.SecretProgram(*s)
+	}
+
+	pl, err := tc.PodClient.List(selector)
+	if err != nil {
+		return err
+	}
+
+	events, err := traceEvents(coreClient.Events(tj.Namespace), jl.Items, pl.Items)
+	if err != nil {
+		return err
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(o.Out, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "Name:\t%s\n", tj.Name)
+	fmt.Fprintf(w, "Namespace:\t%s\n", tj.Namespace)
+	fmt.Fprintf(w, "ID:\t%s\n", tj.ID)
+	fmt.Fprintf(w, "Node:\t%s\n", tj.Hostname)
+	if spec != nil && len(spec.Containers) > 0 {
+		for _, e := range spec.Containers[0].Env {
+			if e.Name == "TARGET_POD" {
+				fmt.Fprintf(w, "Target Pod:\t%s\n", e.Value)
+			}
+		}
+	}
+	if len(tj.Schedule) > 0 {
+		fmt.Fprintf(w, "Schedule:\t%s\n", tj.Schedule)
+	}
+	fmt.Fprintf(w, "Status:\t%s\n", jobStatus(tj))
+	fmt.Fprintf(w, "Created:\t%s (%s ago)\n", tj.CreationTimestamp.Format(timeFormat), age(tj.CreationTimestamp))
+	if spec != nil && len(spec.Containers) > 0 {
+		fmt.Fprintf(w, "Image:\t%s\n", spec.Containers[0].Image)
+		fmt.Fprintf(w, "Command:\t%s\n", strings.Join(spec.Containers[0].Command, " "))
+	}
+	// The BPF objects of network tracers are not printable
+	if len(program) > 0 && !utf8.ValidString(program) {
+		fmt.Fprintf(w, "Program:\t%d bytes BPF object\n", len(program))
+	} else if len(program) > 0 {
+		fmt.Fprintf(w, "Program:\n")
+		w.Flush()
+		printIndented(o.Out, program)
+	}
+
+	fmt.Fprintf(w, "Pods:")
+	if len(pl.Items) == 0 {
+		fmt.Fprintf(w, "\t<none>\n")
+	} else {
+		fmt.Fprintf(w, "\n")
+	}
+	for _, p := range pl.Items {
+		fmt.Fprintf(w, "  %s:\n", p.Name)
+		fmt.Fprintf(w, "    Phase:\t%s\n", p.Status.Phase)
+		if p.Status.StartTime != nil {
+			fmt.Fprintf(w, "    Started:\t%s\n", p.Status.StartTime.Format(timeFormat))
+		}
+		statuses := append([]v1.ContainerStatus{}, p.Status.InitContainerStatuses...)
+		statuses = append(statuses, p.Status.ContainerStatuses...)
+		for _, s := range statuses {
+			fmt.Fprintf(w, "    Container %s:\t%s\n", s.Name, containerState(s.State))
+		}
+	}
+
+	fmt.Fprintf(w, "Events:")
+	if len(events) == 0 {
+		fmt.Fprintf(w, "\t<none>\n")
+	} else {
+		fmt.Fprintf(w, "\n  Type\tReason\tAge\tFrom\tMessage\n")
+	}
+	for _, e := range events {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", e.Type, e.Reason, age(e.LastTimestamp), e.Source.Component, strings.TrimSpace(e.Message))
+	}
+
+	fmt.Fprintf(w, "Output:\n")
+	fmt.Fprintf(w, "  kubectl trace attach %s -n %s\n", tj.Name, tj.Namespace)
+	for _, p := range pl.Items {
+		fmt.Fprintf(w, "  kubectl logs %s -n %s\n", p.Name, p.Namespace)
+	}
+	return nil
+}
+
+const timeFormat = "Mon, 02 Jan 2006 15:04:05 -0700"
+
+// traceEvents provides the events of the jobs and pods of a trace.
+func traceEvents(client corev1client.EventInterface, jobs []batchv1.Job, pods []v1.Pod) ([]v1.Event, error) {
+	names := []string{}
+	for _, j := range jobs {
+		names = append(names, j.Name)
+	}
+	for _, p := range pods {
+		names = append(names, p.Name)
+	}
+
+	events := []v1.Event{}
+	for _, name := range names {
+		el, err := client.List(metav1.ListOptions{
+			FieldSelector: fmt.Sprintf("involvedObject.name=%s", name),
+		})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, el.Items...)
+	}
+	return events, nil
+}
+
+// containerState describes the state of a container like kubectl does.
+func containerState(s v1.ContainerState) string {
+	switch {
+	case s.Running != nil:
+		return fmt.Sprintf("Running since %s", s.Running.StartedAt.Format(timeFormat))
+	case s.Waiting != nil:
+		return fmt.Sprintf("Waiting (%s) %s", s.Waiting.Reason, s.Waiting.Message)
+	case s.Terminated != nil:
+		return fmt.Sprintf("Terminated (%s), exit code %d", s.Terminated.Reason, s.Terminated.ExitCode)
+	}
+	return "Unknown"
+}
+
+func printIndented(w io.Writer, text string) {
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		fmt.Fprintf(w, "    %s\n", line)
+	}
+}
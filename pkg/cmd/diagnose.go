@@ -0,0 +1,361 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	diagnoseShort = `Explain why a trace does not produce output`
+	diagnoseLong  = diagnoseShort + `
+
+The phase of the trace pod, the state of its containers, the related events and the
+last lines of its logs are gathered to tell what went wrong and how to fix it.`
+
+	diagnoseExamples = `
+  # Diagnose a trace
+  %[1]s trace diagnose 656ee75a-ee3c-11e8-9e7a-8c164500a77e`
+
+	diagnoseArgErrString = "(TRACE_ID | TRACE_NAME) is a required argument for the diagnose command"
+)
+
+// diagnoseLogLines is how many lines of logs are looked at and printed.
+const diagnoseLogLines = 20
+
+// DiagnoseOptions ...
+type DiagnoseOptions struct {
+	genericclioptions.IOStreams
+	traceID      *types.UID
+	traceName    *string
+	namespace    string
+	clientConfig *rest.Config
+}
+
+// NewDiagnoseOptions provides an instance of DiagnoseOptions with default values.
+func NewDiagnoseOptions(streams genericclioptions.IOStreams) *DiagnoseOptions {
+	return &DiagnoseOptions{
+		IOStreams: streams,
+	}
+}
+
+// NewDiagnoseCommand provides the diagnose command wrapping DiagnoseOptions.
+func NewDiagnoseCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewDiagnoseOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "diagnose (TRACE_ID | TRACE_NAME)",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T(diagnoseShort),
+		Long:                  templates.LongDesc(i18n.T(diagnoseLong)),
+		Example:               templates.Examples(fmt.Sprintf(i18n.T(diagnoseExamples), "kubectl")),
+		SilenceUsage:          true,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating DiagnoseOptions accordingly.
+func (o *DiagnoseOptions) Validate(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf(i18n.T(diagnoseArgErrString))
+	}
+	o.traceName, o.traceID = parseTraceArg(args[0])
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *DiagnoseOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.clientConfig, err = factory.ToRESTConfig()
+	return err
+}
+
+// Run prints what is wrong with the trace and how to fix it.
+func (o *DiagnoseOptions) Run() error {
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient: jobsClient.Jobs(o.namespace),
+		PodClient: coreClient.Pods(o.namespace),
+	}
+
+	ctx := context.Background()
+	tf, err := tc.ResolveIDPrefix(ctx, tracejob.TraceJobFilter{
+		Name: o.traceName,
+		ID:   o.traceID,
+	})
+	if err != nil {
+		return err
+	}
+	tjs, err := tc.GetJob(ctx, tf)
+	if err != nil {
+		return err
+	}
+	if len(tjs) == 0 {
+		return fmt.Errorf(i18n.T(traceNotFoundErr))
+	}
+	tj := tjs[0]
+	selector := metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, tj.ID),
+	}
+
+	jl, err := tc.JobClient.List(selector)
+	if err != nil {
+		return err
+	}
+	pl, err := tc.PodClient.List(selector)
+	if err != nil {
+		return err
+	}
+	events, err := traceEvents(coreClient.Events(tj.Namespace), jl.Items, pl.Items)
+	if err != nil {
+		return err
+	}
+
+	// The tracer container may not have started, its logs are then missing
+	logs := ""
+	pod := latestPod(pl.Items)
+	if pod != nil {
+		lines := int64(diagnoseLogLines)
+		rc, err := coreClient.Pods(pod.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{
+			Container: tj.Name,
+			TailLines: &lines,
+		}).Stream()
+		if err == nil {
+			b, _ := ioutil.ReadAll(rc)
+			rc.Close()
+			logs = string(b)
+		}
+	}
+
+	fmt.Fprintf(o.Out, "Trace %s is %s\n", tj.ID, strings.ToLower(jobStatus(tj)))
+	if pod != nil {
+		fmt.Fprintf(o.Out, "Pod %s is %s\n", pod.Name, strings.ToLower(string(pod.Status.Phase)))
+	}
+	fmt.Fprintf(o.Out, "\n")
+	for _, d := range diagnoseTrace(tj, pod, events, logs) {
+		fmt.Fprintf(o.Out, "- %s\n", d.problem)
+		if len(d.fix) > 0 {
+			fmt.Fprintf(o.Out, "  Suggestion: %s\n", d.fix)
+		}
+	}
+	if len(logs) > 0 {
+		fmt.Fprintf(o.Out, "\nLast lines of the logs:\n")
+		printIndented(o.Out, logs)
+	}
+	return nil
+}
+
+// diagnosis is a problem of a trace along with how to fix it.
+type diagnosis struct {
+	problem string
+	fix     string
+}
+
+// logDiagnoses are the problems recognized in the logs of the tracer.
+var logDiagnoses = []struct {
+	patterns []string
+	diagnosis
+}{
+	{
+		patterns: []string{"kernel headers", "linux/types.h", "file not found"},
+		diagnosis: diagnosis{
+			problem: "bpftrace cannot find the kernel headers of the node",
+			fix:     "run the trace with --fetch-headers, or with --btf=true when the kernel has BTF",
+		},
+	},
+	{
+		patterns: []string{"operation not permitted", "permission denied"},
+		diagnosis: diagnosis{
+			problem: "the tracer is not allowed to load BPF programs",
+			fix:     "run the trace privileged, without --unprivileged, or add the missing --capabilities",
+		},
+	},
+	{
+		patterns: []string{"syntax error", "unknown function", "undefined map", "type mismatch"},
+		diagnosis: diagnosis{
+			problem: "the program is not valid",
+			fix:     "check it with run --check before running it",
+		},
+	},
+	{
+		patterns: []string{"no probes to attach", "could not attach", "unknown probe"},
+		diagnosis: diagnosis{
+			problem: "the probes of the program cannot be attached on the node",
+			fix:     "list the available probes with -e 'BEGIN{}' and bpftrace -l on the node, kernel functions differ between versions",
+		},
+	},
+}
+
+// sccFailedCreate is the reason of the pods rejected by the security context
+// constraints, told by the message of their FailedCreate events.
+const sccFailedCreate = "FailedCreateSCC"
+
+// eventDiagnoses are the problems recognized in the warning events of the trace.
+var eventDiagnoses = map[string]diagnosis{
+	"FailedScheduling": {
+		problem: "the trace pod cannot be scheduled",
+		fix:     "tolerate the taints of the node with --toleration or --tolerate-all, or lower the --requests",
+	},
+	"FailedCreate": {
+		problem: "the trace pod cannot be created",
+		fix:     "privileged pods must be allowed in the namespace by RBAC and Pod Security, run the trace in a namespace allowing them",
+	},
+	sccFailedCreate: {
+		problem: "the trace pod is rejected by the security context constraints of OpenShift",
+		fix:     "create a service account allowed to run privileged pods with kubectl trace setup, and run the trace with --serviceaccount kubectl-trace",
+	},
+	"FailedMount": {
+		problem: "the volumes of the trace pod cannot be mounted",
+		fix:     "check the --volume flags and that the host paths exist on the node",
+	},
+}
+
+// waitingDiagnoses are the problems recognized in the waiting reasons of the containers.
+var waitingDiagnoses = map[string]diagnosis{
+	"ErrImagePull": {
+		problem: "the tracer image cannot be pulled",
+		fix:     "check --imagename and give the credentials of the registry with --image-pull-secret",
+	},
+	"ImagePullBackOff": {
+		problem: "the tracer image cannot be pulled",
+		fix:     "check --imagename and give the credentials of the registry with --image-pull-secret",
+	},
+	"CreateContainerConfigError": {
+		problem: "the tracer container cannot be configured",
+		fix:     "check the secrets and configmaps referenced by the trace exist",
+	},
+}
+
+// diagnoseTrace tells what is wrong with a trace, from its latest pod, its events
+// and the last lines of its logs.
+func diagnoseTrace(tj tracejob.TraceJob, pod *v1.Pod, events []v1.Event, logs string) []diagnosis {
+	ds := []diagnosis{}
+	seen := map[string]bool{}
+	add := func(d diagnosis) {
+		if !seen[d.problem] {
+			seen[d.problem] = true
+			ds = append(ds, d)
+		}
+	}
+
+	for _, e := range events {
+		reason := e.Reason
+		if reason == "FailedCreate" && strings.Contains(e.Message, "security context constraint") {
+			reason = sccFailedCreate
+		}
+		if d, ok := eventDiagnoses[reason]; ok && e.Type == v1.EventTypeWarning {
+			d.problem = fmt.Sprintf("%s: %s", d.problem, strings.TrimSpace(e.Message))
+			add(d)
+		}
+	}
+
+	if pod == nil {
+		if len(tj.Schedule) > 0 {
+			add(diagnosis{problem: fmt.Sprintf("the trace has not run yet, it is scheduled at %s", tj.Schedule)})
+		} else if len(ds) == 0 {
+			add(diagnosis{
+				problem: "no pod has been created for the trace",
+				fix:     "check the quotas and admission policies of the namespace",
+			})
+		}
+		return ds
+	}
+
+	statuses := append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, s := range statuses {
+		if w := s.State.Waiting; w != nil {
+			if d, ok := waitingDiagnoses[w.Reason]; ok {
+				add(d)
+			}
+		}
+		if t := s.State.Terminated; t != nil && t.ExitCode != 0 {
+			switch {
+			case s.Name == "headers":
+				add(diagnosis{
+					problem: "the kernel headers of the node cannot be fetched",
+					fix:     "give where to download them from with --headers-url",
+				})
+			case t.Reason == "OOMKilled":
+				add(diagnosis{
+					problem: "the tracer ran out of memory",
+					fix:     "raise the memory with --limits, or reduce the size of the maps of the program",
+				})
+			}
+		}
+	}
+
+	lower := strings.ToLower(logs)
+	for _, ld := range logDiagnoses {
+		for _, p := range ld.patterns {
+			if strings.Contains(lower, p) {
+				add(ld.diagnosis)
+				break
+			}
+		}
+	}
+
+	if len(ds) > 0 {
+		return ds
+	}
+	switch {
+	case pod.Status.Phase == v1.PodRunning && len(strings.TrimSpace(logs)) == 0:
+		add(diagnosis{
+			problem: "the tracer runs but printed nothing, its probes may not have fired yet",
+			fix:     "maps and histograms are printed on exit, get them with the stop command",
+		})
+	case pod.Status.Phase == v1.PodSucceeded:
+		add(diagnosis{
+			problem: "the trace completed",
+			fix:     "read its output with the logs command",
+		})
+	case len(tj.Reason) > 0:
+		add(diagnosis{problem: fmt.Sprintf("the trace pod failed: %s", tj.Reason)})
+	default:
+		add(diagnosis{problem: "nothing wrong found"})
+	}
+	return ds
+}
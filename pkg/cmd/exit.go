@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// ExitError ends kubectl trace with its exit code, once the command told why.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// exitWith ends the command with the exit code, without cobra printing it as an error.
+func exitWith(cmd *cobra.Command, code int) error {
+	cmd.SilenceErrors = true
+	return &ExitError{Code: code}
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/fntlnz/kubectl-trace/pkg/exporter"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exporterShort = `Expose the maps printed by bpftrace as Prometheus metrics`
+	exporterLong  = exporterShort + `
+
+The JSON output of bpftrace is followed as the tracer writes it, and the latest values of
+its maps, histograms and stats are served on /metrics. This command is meant to be the
+entrypoint of the exporter sidecar of trace jobs and is not intended to be used directly.`
+
+	// exporterLinger is how long the metrics are still served once the tracer
+	// ended, so that they are scraped a last time.
+	exporterLinger = 30 * time.Second
+)
+
+// ExporterOptions ...
+type ExporterOptions struct {
+	input string
+	port  int32
+}
+
+// NewExporterOptions provides an instance of ExporterOptions with default values.
+func NewExporterOptions() *ExporterOptions {
+	return &ExporterOptions{
+		port: 9090,
+	}
+}
+
+// NewExporterCommand provides the exporter command wrapping ExporterOptions.
+func NewExporterCommand() *cobra.Command {
+	o := NewExporterOptions()
+
+	cmd := &cobra.Command{
+		Use:          "exporter --input FILE [--port PORT]",
+		Short:        i18n.T(exporterShort),
+		Long:         templates.LongDesc(i18n.T(exporterLong)),
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.input, "input", o.input, "File the tracer writes its JSON output to")
+	cmd.Flags().Int32Var(&o.port, "port", o.port, "Port to serve the metrics on")
+
+	return cmd
+}
+
+// Run serves the metrics until the tracer ended.
+func (o *ExporterOptions) Run() error {
+	m := exporter.NewMetrics()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- http.ListenAndServe(fmt.Sprintf(":%d", o.port), mux)
+	}()
+	go func() {
+		errc <- o.follow(m)
+	}()
+
+	if err := <-errc; err != nil {
+		return err
+	}
+	time.Sleep(exporterLinger)
+	return nil
+}
+
+// follow updates the metrics with the lines of the input as they are written,
+// until the tracer ended.
+func (o *ExporterOptions) follow(m *exporter.Metrics) error {
+	f, err := o.open()
+	if err != nil || f == nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	line := []byte{}
+	for {
+		b, err := r.ReadBytes('\n')
+		line = append(line, b...)
+		if err == io.EOF {
+			if tracerDone(o.input) {
+				return nil
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		// Lines which are not maps are not metrics
+		m.Update(line)
+		line = []byte{}
+	}
+}
+
+// open opens the input once the tracer created it, it is nil if the tracer
+// ended without.
+func (o *ExporterOptions) open() (*os.File, error) {
+	for {
+		f, err := os.Open(o.input)
+		if err == nil {
+			return f, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		if tracerDone(o.input) {
+			return nil, nil
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// tracerDone tells whether the tracer writing to output ended.
+func tracerDone(output string) bool {
+	_, err := os.Stat(output + doneSuffix)
+	return err == nil
+}
+
+// doneSuffix is the suffix of the file created next to the metrics output once
+// the tracer ended.
+const doneSuffix = ".done"
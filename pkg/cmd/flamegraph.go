@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/flamegraph"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	flamegraphShort = `Render a flamegraph from the stacks sampled by a trace`
+	flamegraphLong  = flamegraphShort + `
+
+The trace output is collected from its pod and folded locally, it can be produced by
+the perf, pyspy and rbspy tracers or by bpftrace programs aggregating kstack or ustack.`
+
+	flamegraphExamples = `
+  # Render the flamegraph of a trace into out.svg
+  %[1]s trace flamegraph 656ee75a-ee3c-11e8-9e7a-8c164500a77e -o out.svg
+
+  # Render the flamegraph of a trace by name on the standard output
+  %[1]s trace flamegraph kubectl-trace-1bb3ae39-efe8-11e8-9f29-8c164500a77e`
+
+	traceNotFoundErrString    = "no trace found with the provided criterias"
+	tracePodNotFoundErrString = "no pod found for trace %s"
+)
+
+// FlamegraphOptions ...
+type FlamegraphOptions struct {
+	genericclioptions.IOStreams
+	traceID      *types.UID
+	traceName    *string
+	namespace    string
+	output       string
+	clientConfig *rest.Config
+}
+
+// NewFlamegraphOptions provides an instance of FlamegraphOptions with default values.
+func NewFlamegraphOptions(streams genericclioptions.IOStreams) *FlamegraphOptions {
+	return &FlamegraphOptions{
+		IOStreams: streams,
+	}
+}
+
+// NewFlamegraphCommand provides the flamegraph command wrapping FlamegraphOptions.
+func NewFlamegraphCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewFlamegraphOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "flamegraph (TRACE_ID | TRACE_NAME) [-o FILE]",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T(flamegraphShort),
+		Long:                  templates.LongDesc(i18n.T(flamegraphLong)),
+		Example:               templates.Examples(fmt.Sprintf(i18n.T(flamegraphExamples), "kubectl")),
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.output, "output", "o", o.output, "File to write the SVG flamegraph to, defaults to the standard output")
+
+	return cmd
+}
+
+func (o *FlamegraphOptions) Validate(cmd *cobra.Command, args []string) error {
+	switch len(args) {
+	case 1:
+		o.traceName, o.traceID = parseTraceArg(args[0])
+		break
+	default:
+		return fmt.Errorf(i18n.T("(TRACE_ID | TRACE_NAME) is a required argument for the flamegraph command"))
+	}
+
+	return nil
+}
+
+func (o *FlamegraphOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	// Prepare namespace
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	//// Prepare client
+	o.clientConfig, err = factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (o *FlamegraphOptions) Run() error {
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient: jobsClient.Jobs(o.namespace),
+	}
+
+	ctx := context.Background()
+	tf, err := tc.ResolveIDPrefix(ctx, tracejob.TraceJobFilter{
+		Name: o.traceName,
+		ID:   o.traceID,
+	})
+	if err != nil {
+		return err
+	}
+	jobs, err := tc.GetJob(ctx, tf)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		return fmt.Errorf(i18n.T(traceNotFoundErrString))
+	}
+	job := jobs[0]
+
+	pl, err := coreClient.Pods(job.Namespace).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, job.ID),
+	})
+	if err != nil {
+		return err
+	}
+	if len(pl.Items) == 0 {
+		return fmt.Errorf(i18n.T(tracePodNotFoundErrString), job.ID)
+	}
+
+	logs, err := coreClient.Pods(job.Namespace).GetLogs(pl.Items[0].Name, &v1.PodLogOptions{}).Stream()
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	folded, err := flamegraph.Collapse(logs)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = o.Out
+	if len(o.output) > 0 {
+		f, err := os.Create(o.output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	return flamegraph.Render(out, job.Name, folded)
+}
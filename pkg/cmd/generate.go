@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+var (
+	generateShort = `Generate the manifest of a trace without contacting the cluster`
+	generateLong  = generateShort + `
+
+The manifest is built purely client-side so that it can be applied through a separate
+pipeline, e.g. in air-gapped clusters. The node is not looked up: its name must match
+its kubernetes.io/hostname label, as it usually does.`
+
+	generateExamples = `
+  # Generate the manifest of a bpftrace program for a specific node
+  %[1]s trace generate kubernetes-node-emt8.c.myproject.internal -f read.bt > trace.yaml
+
+  # Generate the manifest of a perf capture of a node as JSON
+  %[1]s trace generate kubernetes-node-emt8.c.myproject.internal --tracer perf -o json
+
+  # Generate a TraceJob resource for the in-cluster controller
+  %[1]s trace generate kubernetes-node-emt8.c.myproject.internal -f read.bt --crd -n tracing`
+
+	generateArgErrString = "NODE is a required argument for the generate command"
+)
+
+// GenerateOptions ...
+type GenerateOptions struct {
+	*RunOptions
+}
+
+// NewGenerateOptions provides an instance of GenerateOptions with default values.
+func NewGenerateOptions(streams genericclioptions.IOStreams) *GenerateOptions {
+	return &GenerateOptions{
+		RunOptions: NewRunOptions(streams),
+	}
+}
+
+// NewGenerateCommand provides the generate command wrapping GenerateOptions.
+func NewGenerateCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewGenerateOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "generate NODE [--command -- COMMAND [ARGS...]]",
+		Short:        i18n.T(generateShort),
+		Long:         templates.LongDesc(i18n.T(generateLong)),
+		Example:      templates.Examples(fmt.Sprintf(i18n.T(generateExamples), "kubectl")),
+		SilenceUsage: true,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	o.addJobFlags(cmd)
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating GenerateOptions accordingly.
+func (o *GenerateOptions) Validate(cmd *cobra.Command, args []string) error {
+	args, err := o.splitCommand(cmd, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf(i18n.T(generateArgErrString))
+	}
+
+	if tracejob.Tracer(o.tracer).TargetsProcess() {
+		return fmt.Errorf(i18n.T(podTargetRequiredErrString), o.tracer)
+	}
+	if tracejob.Tracer(o.tracer).IsNetwork() && len(o.iface) == 0 {
+		return fmt.Errorf(i18n.T(interfaceRequiredErrString), o.tracer)
+	}
+	if err := o.validateJob(cmd); err != nil {
+		return err
+	}
+
+	// The node labels are not available offline, BTF is only assumed when requested
+	o.nodes = []traceNode{{hostname: args[0], btf: o.btf == btfEnabled}}
+	return nil
+}
+
+// Complete completes the setup of the command, without any request to the cluster.
+func (o *GenerateOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	if err := o.completeProgram(); err != nil {
+		return err
+	}
+
+	// The namespace comes from the flags or the kubeconfig file, if any
+	var err error
+	o.namespace, o.explicitNamespace, err = factory.ToRawKubeConfigLoader().Namespace()
+	if len(o.traceNamespace) > 0 {
+		o.namespace = o.traceNamespace
+	}
+	return err
+}
+
+// Run prints the objects making up the trace job.
+func (o *GenerateOptions) Run() error {
+	objs, err := o.objects(o.traceJob(o.nodes[0]))
+	if err != nil {
+		return err
+	}
+	return o.printObjects(objs)
+}
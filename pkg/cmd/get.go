@@ -1,24 +1,34 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"strings"
 	"text/tabwriter"
+	"time"
 
+	"github.com/fntlnz/kubectl-trace/pkg/client"
 	"github.com/fntlnz/kubectl-trace/pkg/factory"
-	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/signals"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
 	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
 	"github.com/spf13/cobra"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
-	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
-	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions/printers"
 	"k8s.io/client-go/rest"
 )
 
 var (
 	getCommand = "get"
-	getShort   = `Get the running traces` // Wrap with i18n.T()
+	getShort   = `Get the running traces`
 	getLong    = getShort + `
 	
 ...`
@@ -30,11 +40,38 @@ var (
   # Get only a specific trace
   %[1]s trace get 656ee75a-ee3c-11e8-9e7a-8c164500a77e
 
+  # Get only a specific trace by a unique prefix of its ID
+  %[1]s trace get 656ee75a
+
   # Get only a specific trace in a specific namespace
   %[1]s trace get 656ee75a-ee3c-11e8-9e7a-8c164500a77e -n myns
 
   # Get all traces in all namespaces
-  %[1]s trace get --all-namespaces`
+  %[1]s trace get -A
+
+  # Get the names of the traces in a namespace, to attach to or delete them
+  %[1]s trace get -n myns -o name
+
+  # Get the traces as TraceJob resources in JSON
+  %[1]s trace get -o json
+
+  # Watch the status changes of the traces in a namespace
+  %[1]s trace get -n myns --watch
+
+  # Get the traces still running on a node
+  %[1]s trace get -A --node kubernetes-node-emt8.c.myproject.internal --status running
+
+  # Get the traces created by one invocation on many nodes
+  %[1]s trace get --group 4f9c2a1b
+
+  # Get the traces created more than an hour ago
+  %[1]s trace get -A --older-than 1h`
+
+	allNamespacesUsage = "If present, select the traces across all namespaces. Namespace in current context is ignored even if specified with --namespace"
+	groupUsage         = "Only select the traces of this group, created by one invocation"
+
+	statusUnknownErrString = "unknown status %s, one of: %s"
+	olderThanErrString     = "--older-than must be a positive duration, e.g. 1h"
 
 	argumentsErr     = fmt.Sprintf("at most one argument for %s command", getCommand)
 	missingTargetErr = fmt.Sprintf("specify either a TRACE_ID or a namespace or all namespaces")
@@ -43,26 +80,29 @@ var (
 // GetOptions ...
 type GetOptions struct {
 	genericclioptions.IOStreams
-	ResourceBuilderFlags *genericclioptions.ResourceBuilderFlags
+	PrintFlags *genericclioptions.PrintFlags
 
 	namespace string
 
 	// Local to this command
 	allNamespaces bool
+	watch         bool
+	node          string
+	status        string
+	olderThan     time.Duration
+	group         string
 	traceArg      string
 	clientConfig  *rest.Config
 	traceID       *types.UID
 	traceName     *string
+	printer       printers.ResourcePrinter
 }
 
 // NewGetOptions provides an instance of GetOptions with default values.
 func NewGetOptions(streams genericclioptions.IOStreams) *GetOptions {
-	rbFlags := &genericclioptions.ResourceBuilderFlags{}
-	rbFlags.WithAllNamespaces(false)
-
 	return &GetOptions{
-		ResourceBuilderFlags: rbFlags,
-		IOStreams:            streams,
+		PrintFlags: genericclioptions.NewPrintFlags(""),
+		IOStreams:  streams,
 	}
 }
 
@@ -72,9 +112,9 @@ func NewGetCommand(factory factory.Factory, streams genericclioptions.IOStreams)
 
 	cmd := &cobra.Command{
 		Use:          fmt.Sprintf("%s (TRACE_ID | TRACE_NAME)", getCommand),
-		Short:        getShort,
-		Long:         getLong,                             // wrap with templates.LongDesc()
-		Example:      fmt.Sprintf(getExamples, "kubectl"), // wrap with templates.Examples()
+		Short:        i18n.T(getShort),
+		Long:         templates.LongDesc(i18n.T(getLong)),
+		Example:      templates.Examples(fmt.Sprintf(i18n.T(getExamples), "kubectl")),
 		SilenceUsage: true,
 		PreRunE: func(c *cobra.Command, args []string) error {
 			return o.Validate(c, args)
@@ -91,7 +131,13 @@ func NewGetCommand(factory factory.Factory, streams genericclioptions.IOStreams)
 		},
 	}
 
-	o.ResourceBuilderFlags.AddFlags(cmd.Flags())
+	cmd.Flags().BoolVarP(&o.allNamespaces, "all-namespaces", "A", o.allNamespaces, allNamespacesUsage)
+	o.PrintFlags.AddFlags(cmd)
+	cmd.Flags().StringVar(&o.node, "node", o.node, "Only get the traces running on this node")
+	cmd.Flags().StringVar(&o.status, "status", o.status, fmt.Sprintf("Only get the traces having this status, one of: %s", joinStatuses(getStatuses)))
+	cmd.Flags().StringVar(&o.group, "group", o.group, groupUsage)
+	cmd.Flags().DurationVar(&o.olderThan, "older-than", o.olderThan, "Only get the traces created more than this duration ago, e.g. 1h")
+	cmd.Flags().BoolVarP(&o.watch, "watch", "w", o.watch, "Watch the status changes of the traces, starting with their current status. Scheduled traces are not watched, the traces they run are")
 
 	return cmd
 }
@@ -99,15 +145,30 @@ func NewGetCommand(factory factory.Factory, streams genericclioptions.IOStreams)
 func (o *GetOptions) Validate(cmd *cobra.Command, args []string) error {
 	switch len(args) {
 	case 1:
-		if meta.IsObjectName(args[0]) {
-			o.traceName = &args[0]
-		} else {
-			tid := types.UID(args[0])
-			o.traceID = &tid
-		}
+		o.traceName, o.traceID = parseTraceArg(args[0])
 		break
 	}
 
+	if len(o.status) > 0 {
+		status, ok := parseStatus(o.status)
+		if !ok {
+			return fmt.Errorf(i18n.T(statusUnknownErrString), o.status, joinStatuses(getStatuses))
+		}
+		o.status = string(status)
+	}
+	if o.olderThan < 0 {
+		return fmt.Errorf(i18n.T(olderThanErrString))
+	}
+
+	// The table is printed when no output format is given
+	if len(*o.PrintFlags.OutputFormat) > 0 {
+		var err error
+		o.printer, err = o.PrintFlags.ToPrinter()
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -120,8 +181,7 @@ func (o *GetOptions) Complete(factory factory.Factory, cmd *cobra.Command, args
 	}
 
 	// All namespaces, when present, overrides namespace flag
-	if cmd.Flag("all-namespaces").Changed {
-		o.allNamespaces = *o.ResourceBuilderFlags.AllNamespaces
+	if o.allNamespaces {
 		o.namespace = ""
 	}
 
@@ -135,43 +195,173 @@ func (o *GetOptions) Complete(factory factory.Factory, cmd *cobra.Command, args
 }
 
 func (o *GetOptions) Run() error {
-	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
-	if err != nil {
-		return err
+	// Watching goes on until interrupted
+	ctx := context.Background()
+	clientConfig := o.clientConfig
+	if o.watch {
+		ctx = signals.WithStandardSignals(ctx)
+		clientConfig = factory.WithContext(ctx, clientConfig)
 	}
 
-	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	c, err := client.New(clientConfig)
 	if err != nil {
 		return err
 	}
+	c.Out = o.Out
+	tc := c.TraceJobClient(o.namespace)
 
-	tc := &tracejob.TraceJobClient{
-		JobClient:    jobsClient.Jobs(o.namespace),
-		ConfigClient: coreClient.ConfigMaps(o.namespace),
+	tf := tracejob.TraceJobFilter{
+		Name:  o.traceName,
+		ID:    o.traceID,
+		Group: o.group,
+	}
+	tf, err = tc.ResolveIDPrefix(ctx, tf)
+	if err != nil {
+		return err
 	}
 
-	tc.WithOutStream(o.Out)
-
-	tf := tracejob.TraceJobFilter{
-		Name: o.traceName,
-		ID:   o.traceID,
+	if o.watch {
+		return o.watchJobs(ctx, tc, tf)
 	}
 
-	jobs, err := tc.GetJob(tf)
+	all, err := tc.GetJob(ctx, tf)
 
 	if err != nil {
 		return err
 	}
 
-	// TODO: support other output formats via the o flag, like json, yaml. Not sure if a good idea, trace is not a resource in k8s
+	jobs := []tracejob.TraceJob{}
+	for _, j := range all {
+		if o.matches(j) {
+			jobs = append(jobs, j)
+		}
+	}
+
+	if o.printer != nil {
+		return jobsPrint(o.Out, o.printer, jobs)
+	}
 	jobsTablePrint(o.Out, jobs)
 	return nil
 }
 
+// getStatuses are the statuses get filters the traces with.
+var getStatuses = []tracejob.TraceJobStatus{
+	tracejob.TraceJobStatusCreated,
+	tracejob.TraceJobStatusRunning,
+	tracejob.TraceJobStatusCompleted,
+	tracejob.TraceJobStatusFailed,
+	tracejob.TraceJobStatusScheduled,
+	tracejob.TraceJobStatusSuspended,
+}
+
+func parseStatus(s string) (tracejob.TraceJobStatus, bool) {
+	for _, status := range getStatuses {
+		if strings.EqualFold(s, string(status)) {
+			return status, true
+		}
+	}
+	return "", false
+}
+
+func joinStatuses(statuses []tracejob.TraceJobStatus) string {
+	s := make([]string, len(statuses))
+	for i, status := range statuses {
+		s[i] = strings.ToLower(string(status))
+	}
+	return strings.Join(s, ", ")
+}
+
+// matches tells whether the trace job passes the node, status and age filters.
+func (o *GetOptions) matches(tj tracejob.TraceJob) bool {
+	if len(o.node) > 0 && tj.Hostname != o.node {
+		return false
+	}
+	if len(o.status) > 0 && string(tj.Status) != o.status {
+		return false
+	}
+	if o.olderThan > 0 && time.Since(tj.CreationTimestamp.Time) < o.olderThan {
+		return false
+	}
+	return true
+}
+
+// watchJobs prints the trace jobs whenever their status changes, until interrupted.
+func (o *GetOptions) watchJobs(ctx context.Context, tc *tracejob.TraceJobClient, tf tracejob.TraceJobFilter) error {
+	w := new(tabwriter.Writer)
+	w.Init(o.Out, 8, 8, 0, '\t', 0)
+	color := colored(o.Out)
+	if o.printer == nil {
+		fmt.Fprintf(w, jobsTableFormat+"\n", jobsHeader(color)...)
+		w.Flush()
+	}
+
+	statuses := map[string]tracejob.TraceJobStatus{}
+	for {
+		wi, err := tc.WatchJobs(ctx, tf)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// The channel is closed when the server times the watch out, it is then watched again
+		for e := range wi.ResultChan() {
+			if e.Type == watch.Error {
+				wi.Stop()
+				return errors.FromObject(e.Object)
+			}
+			j, ok := e.Object.(*batchv1.Job)
+			if !ok {
+				continue
+			}
+			tj := tracejob.FromJob(*j)
+			if !o.matches(tj) && statuses[tj.Name] == "" {
+				continue
+			}
+			if e.Type == watch.Deleted {
+				tj.Status = tracejob.TraceJobStatusDeleted
+				delete(statuses, tj.Name)
+			} else if statuses[tj.Name] == tj.Status {
+				continue
+			} else {
+				statuses[tj.Name] = tj.Status
+			}
+
+			if o.printer != nil {
+				u, err := tj.ToUnstructured()
+				if err != nil {
+					return err
+				}
+				if err := o.printer.PrintObj(u, o.Out); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Fprintf(w, jobsTableFormat+"\n", jobRow(tj, color)...)
+			w.Flush()
+		}
+	}
+}
+
+// jobsPrint prints the traces as a list of TraceJob resources.
+func jobsPrint(w io.Writer, p printers.ResourcePrinter, jobs []tracejob.TraceJob) error {
+	list := &unstructured.UnstructuredList{}
+	list.SetAPIVersion("v1")
+	list.SetKind("List")
+	for _, j := range jobs {
+		u, err := j.ToUnstructured()
+		if err != nil {
+			return err
+		}
+		list.Items = append(list.Items, *u)
+	}
+	return p.PrintObj(list, w)
+}
+
 // TODO(fntlnz): This needs better printing, perhaps we could use the humanreadable table from k8s itself
 // to be consistent with the main project.
 func jobsTablePrint(o io.Writer, jobs []tracejob.TraceJob) {
-	format := "%s\t%s\t%s\t%s\t%s\t"
+	format := jobsTableFormat
 	if len(jobs) == 0 {
 		fmt.Println("No resources found.")
 		return
@@ -182,11 +372,54 @@ func jobsTablePrint(o io.Writer, jobs []tracejob.TraceJob) {
 	w.Init(o, 8, 8, 0, '\t', 0)
 	defer w.Flush()
 
-	// TODO(fntlnz): Do the status and age fields, we don't have a way to get them now, so reporting
-	// them as missing.
-	fmt.Fprintf(w, format, "NAMESPACE", "NODE", "NAME", "STATUS", "AGE")
+	color := colored(o)
+	fmt.Fprintf(w, format, jobsHeader(color)...)
 	for _, j := range jobs {
-		fmt.Fprintf(w, "\n"+format, j.Namespace, j.Hostname, j.Name, "<missing>", "<missing>")
+		fmt.Fprintf(w, "\n"+format, jobRow(j, color)...)
 	}
 	fmt.Fprintf(w, "\n")
 }
+
+const jobsTableFormat = "%s\t%s\t%s\t%s\t%s\t"
+
+func jobsHeader(color bool) []interface{} {
+	status := "STATUS"
+	if color {
+		status = colorize(status, defaultColor)
+	}
+	return []interface{}{"NAMESPACE", "NODE", "NAME", status, "AGE"}
+}
+
+func jobRow(j tracejob.TraceJob, color bool) []interface{} {
+	status := jobStatus(j)
+	if color {
+		status = colorStatus(j)
+	}
+	return []interface{}{j.Namespace, j.Hostname, j.Name, status, age(j.CreationTimestamp)}
+}
+
+// jobStatus provides the status of the trace job along with the reason of its failure, if any.
+func jobStatus(j tracejob.TraceJob) string {
+	if len(j.Reason) > 0 {
+		return fmt.Sprintf("%s (%s)", j.Status, j.Reason)
+	}
+	return string(j.Status)
+}
+
+// age provides the age of an object like kubectl does, e.g. 5m or 2d.
+func age(t metav1.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	d := time.Since(t.Time)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+)
+
+var (
+	headersShort = `Fetch the kernel headers of the node for the tracer`
+	headersLong  = headersShort + `
+
+The headers are extracted from the kernel itself when it is built with CONFIG_IKHEADERS,
+otherwise they are downloaded from the URL template, if any. This command is meant to be
+the entrypoint of the init container of trace jobs and is not intended to be used directly.`
+
+	kheadersPath  = "/sys/kernel/kheaders.tar.xz"
+	osReleasePath = "/proc/sys/kernel/osrelease"
+
+	headersNotFoundErrString = "unable to find kernel headers for %s, the kernel has no CONFIG_IKHEADERS and no URL is configured"
+	headersDownloadErrString = "error downloading the kernel headers from %s: %s"
+	headersTreeErrString     = "no kernel source tree found in the headers"
+)
+
+// HeadersOptions ...
+type HeadersOptions struct {
+	dest      string
+	url       string
+	osRelease string
+}
+
+// NewHeadersOptions provides an instance of HeadersOptions with default values.
+func NewHeadersOptions() *HeadersOptions {
+	return &HeadersOptions{
+		osRelease: "/host/etc/os-release",
+	}
+}
+
+// NewHeadersCommand provides the headers command wrapping HeadersOptions.
+func NewHeadersCommand() *cobra.Command {
+	o := NewHeadersOptions()
+
+	cmd := &cobra.Command{
+		Use:          "headers --dest DIR [--url URL]",
+		Short:        i18n.T(headersShort),
+		Long:         templates.LongDesc(i18n.T(headersLong)),
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.dest, "dest", o.dest, "Directory to extract the headers to")
+	cmd.Flags().StringVar(&o.url, "url", o.url, "URL template of a tar.gz archive of the headers, e.g. https://mirror/linux-headers-{{.KernelRelease}}.tar.gz")
+	cmd.Flags().StringVar(&o.osRelease, "os-release", o.osRelease, "Path of the os-release file of the node, whose ID, VERSION_ID and BUILD_ID are available to the URL template")
+
+	return cmd
+}
+
+// HeadersContext is the data available to the headers URL template, the
+// os-release fields of the node are empty when it has no such file.
+type HeadersContext struct {
+	KernelRelease string
+	// ID is the operating system of the node, like cos.
+	ID string
+	// VersionID is the version of the operating system of the node.
+	VersionID string
+	// BuildID is the build of the operating system of the node, used by cos.
+	BuildID string
+}
+
+// Run fetches the headers into the destination directory, the source tree is
+// linked from its build directory whatever the layout of the archive.
+func (o *HeadersOptions) Run() error {
+	release, err := kernelRelease()
+	if err != nil {
+		return err
+	}
+	src := filepath.Join(o.dest, "src")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		return err
+	}
+
+	if err := o.extract(release, src); err != nil {
+		return err
+	}
+
+	root, err := findSourceTree(src)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(o.dest, root)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(rel, filepath.Join(o.dest, "build"))
+}
+
+func (o *HeadersOptions) extract(release, src string) error {
+	// The kheaders module provides the archive when it is not built in
+	if _, err := os.Stat(kheadersPath); os.IsNotExist(err) {
+		exec.Command("modprobe", "kheaders").Run()
+	}
+	if _, err := os.Stat(kheadersPath); err == nil {
+		return runForwardingSignals(exec.Command("tar", "-xJf", kheadersPath, "-C", src), 0)
+	}
+
+	if len(o.url) == 0 {
+		return fmt.Errorf(i18n.T(headersNotFoundErrString), release)
+	}
+	tmpl, err := template.New("url").Option("missingkey=error").Parse(o.url)
+	if err != nil {
+		return err
+	}
+	ctx := readOSRelease(o.osRelease)
+	ctx.KernelRelease = release
+	var url bytes.Buffer
+	if err := tmpl.Execute(&url, ctx); err != nil {
+		return err
+	}
+
+	resp, err := http.Get(url.String())
+	if err != nil {
+		return fmt.Errorf(i18n.T(headersDownloadErrString), url.String(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf(i18n.T(headersDownloadErrString), url.String(), resp.Status)
+	}
+
+	c := exec.Command("tar", "-xzf", "-", "-C", src)
+	c.Stdin = resp.Body
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// findSourceTree provides the shallowest directory having the include and arch
+// directories of a kernel source tree.
+func findSourceTree(dir string) (string, error) {
+	queue := []string{dir}
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+		if isDir(filepath.Join(d, "include")) && isDir(filepath.Join(d, "arch")) {
+			return d, nil
+		}
+		entries, err := ioutil.ReadDir(d)
+		if err != nil {
+			return "", err
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				queue = append(queue, filepath.Join(d, e.Name()))
+			}
+		}
+	}
+	return "", fmt.Errorf(i18n.T(headersTreeErrString))
+}
+
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// readOSRelease reads the fields of an os-release file, ignoring a missing one.
+func readOSRelease(path string) HeadersContext {
+	ctx := HeadersContext{}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ctx
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.Trim(parts[1], `"'`)
+		switch parts[0] {
+		case "ID":
+			ctx.ID = value
+		case "VERSION_ID":
+			ctx.VersionID = value
+		case "BUILD_ID":
+			ctx.BuildID = value
+		}
+	}
+	return ctx
+}
+
+// kernelRelease provides the release of the running kernel, like uname -r.
+func kernelRelease() (string, error) {
+	b, err := ioutil.ReadFile(osReleasePath)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fntlnz/kubectl-trace/pkg/history"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+var (
+	historyShort = `List the traces run from this machine and run them again`
+	historyLong  = historyShort + `
+
+Every run records its targets, the hash of its program, its command line and its
+outcome in ~/.kubectl-trace/history.`
+
+	historyExamples = `
+  # List the last traces run
+  %[1]s trace history
+
+  # Run again the trace number 12 of the history
+  %[1]s trace history --rerun 12`
+
+	historyRerunErrString = "no entry %d in the history, there are %d entries"
+	historyLimitErrString = "the limit must be positive"
+)
+
+const (
+	// traceHomeDir is the directory of the files of kubectl-trace, in the home directory.
+	traceHomeDir = ".kubectl-trace"
+	historyFile  = "history"
+)
+
+// HistoryOptions ...
+type HistoryOptions struct {
+	genericclioptions.IOStreams
+	limit int
+	rerun int
+}
+
+// NewHistoryOptions provides an instance of HistoryOptions with default values.
+func NewHistoryOptions(streams genericclioptions.IOStreams) *HistoryOptions {
+	return &HistoryOptions{
+		IOStreams: streams,
+		limit:     20,
+	}
+}
+
+// NewHistoryCommand provides the history command wrapping HistoryOptions.
+func NewHistoryCommand(streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewHistoryOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "history [--rerun N]",
+		Short:        i18n.T(historyShort),
+		Long:         templates.LongDesc(i18n.T(historyLong)),
+		Example:      templates.Examples(fmt.Sprintf(i18n.T(historyExamples), "kubectl")),
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&o.limit, "limit", o.limit, "How many of the last entries to list")
+	cmd.Flags().IntVar(&o.rerun, "rerun", o.rerun, "Number of the entry to run again, with the same command line")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating HistoryOptions accordingly.
+func (o *HistoryOptions) Validate(cmd *cobra.Command, args []string) error {
+	if o.limit <= 0 {
+		return fmt.Errorf(i18n.T(historyLimitErrString))
+	}
+	return nil
+}
+
+// Run lists the history, or runs an entry again.
+func (o *HistoryOptions) Run() error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	entries, err := history.Load(path)
+	if err != nil {
+		return err
+	}
+
+	if o.rerun != 0 {
+		if o.rerun < 1 || o.rerun > len(entries) {
+			return fmt.Errorf(i18n.T(historyRerunErrString), o.rerun, len(entries))
+		}
+		return o.runAgain(entries[o.rerun-1])
+	}
+
+	first := 0
+	if len(entries) > o.limit {
+		first = len(entries) - o.limit
+	}
+	w := new(tabwriter.Writer)
+	w.Init(o.Out, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "#\tTIME\tTARGETS\tPROGRAM\tOUTCOME\tCOMMAND\n")
+	for i := first; i < len(entries); i++ {
+		e := entries[i]
+		outcome := strings.Join(e.TraceIDs, ",")
+		if len(e.Error) > 0 {
+			outcome = "error: " + e.Error
+		}
+		program := e.ProgramHash
+		if len(program) > 12 {
+			program = program[:12]
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", i+1, e.Time.Local().Format(time.RFC822), strings.Join(e.Targets, ","), program, outcome, commandLine(e.Args))
+	}
+	return nil
+}
+
+// runAgain runs the command line of an entry with the current executable.
+func (o *HistoryOptions) runAgain(e history.Entry) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(o.ErrOut, "running %s\n", commandLine(e.Args))
+	c := exec.Command(self, e.Args...)
+	c.Stdin = o.In
+	c.Stdout = o.Out
+	c.Stderr = o.ErrOut
+	return c.Run()
+}
+
+// recordHistory records a run of a trace in the history. The history is only
+// informative, failing to record it is not reported.
+func recordHistory(e history.Entry) {
+	path, err := historyPath()
+	if err != nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	e.Args = os.Args[1:]
+	history.Append(path, e)
+}
+
+func historyPath() (string, error) {
+	home, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, traceHomeDir, historyFile), nil
+}
+
+// homeDir provides the home directory of the user, from HOME or else from the
+// user database.
+func homeDir() (string, error) {
+	if home := os.Getenv("HOME"); len(home) > 0 {
+		return home, nil
+	}
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return u.HomeDir, nil
+}
+
+// commandLine provides a command line as typed in a shell, quoting the arguments
+// that need it.
+func commandLine(args []string) string {
+	quoted := []string{"kubectl", "trace"}
+	for _, a := range args {
+		if len(a) == 0 || strings.ContainsAny(a, " \t\n\"'$`\\{}()*;&|<>") {
+			a = strconv.Quote(a)
+		}
+		quoted = append(quoted, a)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	batchv1beta1client "k8s.io/client-go/kubernetes/typed/batch/v1beta1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	killShort = `Terminate a trace immediately`
+	killLong  = killShort + `
+
+The trace pods are deleted without any grace period and the trace is deleted, for traces
+overloading their node. The output of the tracer is lost, see the stop command to keep it.`
+
+	killExamples = `
+  # Terminate a trace right now
+  %[1]s trace kill 656ee75a-ee3c-11e8-9e7a-8c164500a77e`
+
+	killArgErrString = "(TRACE_ID | TRACE_NAME) is a required argument for the kill command"
+)
+
+// KillOptions ...
+type KillOptions struct {
+	genericclioptions.IOStreams
+	traceID      *types.UID
+	traceName    *string
+	namespace    string
+	clientConfig *rest.Config
+}
+
+// NewKillOptions provides an instance of KillOptions with default values.
+func NewKillOptions(streams genericclioptions.IOStreams) *KillOptions {
+	return &KillOptions{
+		IOStreams: streams,
+	}
+}
+
+// NewKillCommand provides the kill command wrapping KillOptions.
+func NewKillCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewKillOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "kill (TRACE_ID | TRACE_NAME)",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T(killShort),
+		Long:                  templates.LongDesc(i18n.T(killLong)),
+		Example:               templates.Examples(fmt.Sprintf(i18n.T(killExamples), "kubectl")),
+		SilenceUsage:          true,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating KillOptions accordingly.
+func (o *KillOptions) Validate(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf(i18n.T(killArgErrString))
+	}
+	o.traceName, o.traceID = parseTraceArg(args[0])
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *KillOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.clientConfig, err = factory.ToRESTConfig()
+	return err
+}
+
+// Run deletes the pods of the trace without grace period, then the trace itself.
+func (o *KillOptions) Run() error {
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	cronJobsClient, err := batchv1beta1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient:     jobsClient.Jobs(o.namespace),
+		CronJobClient: cronJobsClient.CronJobs(o.namespace),
+		ConfigClient:  coreClient.ConfigMaps(o.namespace),
+		SecretClient:  coreClient.Secrets(o.namespace),
+
+		DeletePropagation: metav1.DeletePropagationBackground,
+	}
+	tc.WithOutStream(o.Out)
+
+	tf := tracejob.TraceJobFilter{
+		Name: o.traceName,
+		ID:   o.traceID,
+	}
+	ctx := context.Background()
+	tf, err = tc.ResolveIDPrefix(ctx, tf)
+	if err != nil {
+		return err
+	}
+	tjs, err := tc.GetJob(ctx, tf)
+	if err != nil {
+		return err
+	}
+	if len(tjs) == 0 {
+		return fmt.Errorf(i18n.T(traceNotFoundErr))
+	}
+	tj := tjs[0]
+
+	pods := coreClient.Pods(tj.Namespace)
+	pl, err := pods.List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, tj.ID),
+	})
+	if err != nil {
+		return err
+	}
+	grace := int64(0)
+	for _, p := range pl.Items {
+		err := pods.Delete(p.Name, &metav1.DeleteOptions{GracePeriodSeconds: &grace})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(o.Out, "trace pod %s killed\n", p.Name)
+	}
+
+	// The trace is deleted too, otherwise its job would start a new pod
+	return tc.DeleteJobs(ctx, tracejob.TraceJobFilter{ID: &tj.ID})
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"flag"
+
+	"github.com/spf13/pflag"
+)
+
+// logFlags are the flags of glog exposed by the commands.
+var logFlags = []string{"v", "vmodule"}
+
+// addLogFlags adds the flags setting the verbosity of the logs, written to the
+// standard error: -v=2 tells about the trace resources and pods, -v=6 and above
+// about the requests of the clients to the API server, which log through glog too.
+func addLogFlags(flags *pflag.FlagSet) {
+	flag.Set("logtostderr", "true")
+	for _, name := range logFlags {
+		flags.AddGoFlag(flag.CommandLine.Lookup(name))
+	}
+	// glog complains about logging before its flags are parsed otherwise
+	flag.CommandLine.Parse([]string{})
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	logsShort = `Print the output of a trace`
+	logsLong  = logsShort + `
+
+The output is read from the logs of the trace pod, so that it is available after
+detaching from the trace or when attaching is not possible. The pod of the latest
+run is used for scheduled traces.`
+
+	logsExamples = `
+  # Print the output of a trace
+  %[1]s trace logs 656ee75a-ee3c-11e8-9e7a-8c164500a77e
+
+  # Stream the output of a running trace
+  %[1]s trace logs -f kubectl-trace-1bb3ae39-efe8-11e8-9f29-8c164500a77e
+
+  # Print the output of the previous run of the tracer container
+  %[1]s trace logs -p 656ee75a-ee3c-11e8-9e7a-8c164500a77e`
+
+	logsArgErrString = "(TRACE_ID | TRACE_NAME) is a required argument for the logs command"
+	podNotFoundErr   = "no pod found for the trace, it may not have started yet"
+)
+
+// LogsOptions ...
+type LogsOptions struct {
+	genericclioptions.IOStreams
+	traceID      *types.UID
+	traceName    *string
+	namespace    string
+	clientConfig *rest.Config
+
+	follow   bool
+	previous bool
+}
+
+// NewLogsOptions provides an instance of LogsOptions with default values.
+func NewLogsOptions(streams genericclioptions.IOStreams) *LogsOptions {
+	return &LogsOptions{
+		IOStreams: streams,
+	}
+}
+
+// NewLogsCommand provides the logs command wrapping LogsOptions.
+func NewLogsCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewLogsOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "logs (TRACE_ID | TRACE_NAME)",
+		Short:        i18n.T(logsShort),
+		Long:         templates.LongDesc(i18n.T(logsLong)),
+		Example:      templates.Examples(fmt.Sprintf(i18n.T(logsExamples), "kubectl")),
+		SilenceUsage: true,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&o.follow, "follow", "f", o.follow, "Stream the output until the trace ends")
+	cmd.Flags().BoolVarP(&o.previous, "previous", "p", o.previous, "Print the output of the previous instance of the tracer container, if it restarted")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating LogsOptions accordingly.
+func (o *LogsOptions) Validate(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf(i18n.T(logsArgErrString))
+	}
+	o.traceName, o.traceID = parseTraceArg(args[0])
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *LogsOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.clientConfig, err = factory.ToRESTConfig()
+	return err
+}
+
+// Run prints the logs of the trace pod.
+func (o *LogsOptions) Run() error {
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient: jobsClient.Jobs(o.namespace),
+	}
+
+	ctx := context.Background()
+	tf, err := tc.ResolveIDPrefix(ctx, tracejob.TraceJobFilter{
+		Name: o.traceName,
+		ID:   o.traceID,
+	})
+	if err != nil {
+		return err
+	}
+	tjs, err := tc.GetJob(ctx, tf)
+	if err != nil {
+		return err
+	}
+	if len(tjs) == 0 {
+		return fmt.Errorf(i18n.T(traceNotFoundErr))
+	}
+	tj := tjs[0]
+
+	pods := coreClient.Pods(tj.Namespace)
+	pl, err := pods.List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, tj.ID),
+	})
+	if err != nil {
+		return err
+	}
+	pod := latestPod(pl.Items)
+	if pod == nil {
+		return fmt.Errorf(i18n.T(podNotFoundErr))
+	}
+
+	// The tracer container is named after the trace
+	rc, err := pods.GetLogs(pod.Name, &v1.PodLogOptions{
+		Container: tj.Name,
+		Follow:    o.follow,
+		Previous:  o.previous,
+	}).Stream()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	_, err = io.Copy(o.Out, rc)
+	return err
+}
+
+// latestPod provides the most recently created pod, if any.
+func latestPod(pods []v1.Pod) *v1.Pod {
+	var latest *v1.Pod
+	for i := range pods {
+		if latest == nil || latest.CreationTimestamp.Before(&pods[i].CreationTimestamp) {
+			latest = &pods[i]
+		}
+	}
+	return latest
+}
@@ -0,0 +1,13 @@
+package cmd
+
+import "golang.org/x/sys/unix"
+
+// setMemlock sets the locked memory limit of the runner, inherited by the
+// tracer, unlimited being RLIM_INFINITY.
+func setMemlock(limit string) error {
+	n, err := parseMemlock(limit)
+	if err != nil {
+		return err
+	}
+	return unix.Setrlimit(unix.RLIMIT_MEMLOCK, &unix.Rlimit{Cur: n, Max: n})
+}
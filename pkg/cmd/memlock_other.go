@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+)
+
+// setMemlock fails, only the runner of Linux trace pods sets the limit.
+func setMemlock(limit string) error {
+	return fmt.Errorf(i18n.T("the memlock limit can only be set on Linux"))
+}
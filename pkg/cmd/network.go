@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+)
+
+const (
+	objectProgramPath = "/tmp/program.o"
+	// podInterface is the interface of the pods, the host side of which is the
+	// peer of its veth pair.
+	podInterface = "eth0"
+	// tcPreference is the preference of the tc filter of the trace, so that it
+	// is removed without the other filters of the interface.
+	tcPreference = "49152"
+
+	interfaceNotFoundErrString = "unable to find the host interface of container %s"
+	tracePipeErrString         = "unable to find the trace pipe of the kernel, tracefs must be mounted on the node"
+)
+
+// tracePipePaths are where the trace pipe printed to by bpf_trace_printk can be,
+// depending on whether tracefs is mounted on its own.
+var tracePipePaths = []string{"/sys/kernel/tracing/trace_pipe", "/sys/kernel/debug/tracing/trace_pipe"}
+
+// runNetwork attaches the BPF object to the interface and prints what it writes
+// to the trace pipe, until the duration expires or the runner is interrupted,
+// then detaches it.
+func (o *TraceRunnerOptions) runNetwork() error {
+	_, b, err := readProgram(o.program)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(objectProgramPath, b, 0644); err != nil {
+		return err
+	}
+
+	iface := o.iface
+	if len(iface) == 0 {
+		if iface, err = findContainerInterface(o.containerID); err != nil {
+			return err
+		}
+	}
+
+	pipe := ""
+	for _, p := range tracePipePaths {
+		if _, err := os.Stat(p); err == nil {
+			pipe = p
+			break
+		}
+	}
+	if len(pipe) == 0 {
+		return fmt.Errorf(i18n.T(tracePipeErrString))
+	}
+	f, err := os.Open(pipe)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	attach, detach := networkCommands(tracejob.Tracer(o.tracer), iface, o.direction, o.section, objectProgramPath)
+	for _, args := range attach {
+		if err := runNetworkCommand(args); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		for _, args := range detach {
+			if err := runNetworkCommand(args); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+			}
+		}
+	}()
+	fmt.Fprintf(os.Stderr, "attached %s to %s\n", o.tracer, iface)
+
+	// Reading the trace pipe blocks, the copy is left behind once interrupted
+	go io.Copy(o.stdout, f)
+	waitInterrupt(o.duration)
+	return nil
+}
+
+// networkCommands provides the commands attaching the BPF object to the
+// interface, and the ones detaching it.
+func networkCommands(tracer tracejob.Tracer, iface, direction, section, object string) ([][]string, [][]string) {
+	if tracer == tracejob.XDPTracer {
+		// The generic mode works on every interface, veths included
+		attach := []string{"ip", "link", "set", "dev", iface, "xdpgeneric", "obj", object}
+		if len(section) > 0 {
+			attach = append(attach, "sec", section)
+		}
+		return [][]string{attach}, [][]string{{"ip", "link", "set", "dev", iface, "xdpgeneric", "off"}}
+	}
+
+	if len(direction) == 0 {
+		direction = tracejob.DirectionIngress
+	}
+	filter := []string{"tc", "filter", "add", "dev", iface, direction, "pref", tcPreference, "bpf", "direct-action", "obj", object}
+	if len(section) > 0 {
+		filter = append(filter, "sec", section)
+	}
+	attach := [][]string{
+		// The clsact qdisc holds the ingress and egress filters, it may already be there
+		{"tc", "qdisc", "replace", "dev", iface, "clsact"},
+		filter,
+	}
+	return attach, [][]string{{"tc", "filter", "del", "dev", iface, direction, "pref", tcPreference}}
+}
+
+// runNetworkCommand runs the command, failing with its output when it fails.
+func runNetworkCommand(args []string) error {
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// waitInterrupt waits for the runner to be interrupted or for the duration to
+// expire, if any.
+func waitInterrupt(duration time.Duration) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	var expired <-chan time.Time
+	if duration > 0 {
+		timer := time.NewTimer(duration)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-sigCh:
+	case <-expired:
+	}
+}
+
+// link is a network interface as listed by ip -o link.
+type link struct {
+	index int
+	name  string
+	// peer is the index of the other end of a veth pair, zero otherwise.
+	peer int
+}
+
+// parseLinks parses the interfaces listed by ip -o link, in the form
+// 3: eth0@if12: <BROADCAST,MULTICAST,UP> mtu 1500...
+func parseLinks(out string) []link {
+	links := []link{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimSuffix(fields[0], ":"))
+		if err != nil {
+			continue
+		}
+		l := link{index: index, name: strings.TrimSuffix(fields[1], ":")}
+		if i := strings.Index(l.name, "@if"); i > 0 {
+			l.peer, _ = strconv.Atoi(l.name[i+len("@if"):])
+			l.name = l.name[:i]
+		} else if i := strings.Index(l.name, "@"); i > 0 {
+			l.name = l.name[:i]
+		}
+		links = append(links, l)
+	}
+	return links
+}
+
+// findContainerInterface provides the host side of the veth pair of the
+// interface of the container, looked up in its network namespace.
+func findContainerInterface(containerID string) (string, error) {
+	pid, err := findContainerPID(containerID)
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command("nsenter", "-t", strconv.Itoa(pid), "-n", "ip", "-o", "link", "show", "dev", podInterface).Output()
+	if err != nil {
+		return "", err
+	}
+	peer := 0
+	for _, l := range parseLinks(string(out)) {
+		if l.name == podInterface {
+			peer = l.peer
+		}
+	}
+	if peer == 0 {
+		return "", fmt.Errorf(i18n.T(interfaceNotFoundErrString), containerID)
+	}
+
+	// The trace pod is in the host network namespace
+	out, err = exec.Command("ip", "-o", "link").Output()
+	if err != nil {
+		return "", err
+	}
+	for _, l := range parseLinks(string(out)) {
+		if l.index == peer {
+			return l.name, nil
+		}
+	}
+	return "", fmt.Errorf(i18n.T(interfaceNotFoundErrString), containerID)
+}
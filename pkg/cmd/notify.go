@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+)
+
+const (
+	notificationCompleted = "completed"
+	notificationFailed    = "failed"
+
+	notifyTimeout   = 30 * time.Second
+	notifyErrString = "error notifying %s: %s"
+)
+
+// notification is the JSON payload the trace-runner posts when the tracer ends.
+// Text summarizes it for chat webhooks like the Slack ones.
+type notification struct {
+	Text      string    `json:"text"`
+	TraceID   string    `json:"traceID"`
+	Node      string    `json:"node"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+}
+
+// newNotification provides the notification of a run of the tracer, failed when
+// err is not nil.
+func newNotification(traceID, node string, start time.Time, err error) notification {
+	n := notification{
+		TraceID:   traceID,
+		Node:      node,
+		Status:    notificationCompleted,
+		StartTime: start.UTC(),
+		EndTime:   time.Now().UTC(),
+	}
+	if err != nil {
+		n.Status = notificationFailed
+		n.Error = err.Error()
+	}
+	n.Text = fmt.Sprintf("trace %s %s on node %s after %s", n.TraceID, n.Status, n.Node, n.EndTime.Sub(n.StartTime).Round(time.Second))
+	if err != nil {
+		n.Text += ": " + n.Error
+	}
+	return n
+}
+
+// notify posts the notification to url.
+func notify(url string, n notification) error {
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf(i18n.T(notifyErrString), url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf(i18n.T(notifyErrString), url, resp.Status)
+	}
+	return nil
+}
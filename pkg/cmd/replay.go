@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/recording"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+var (
+	replayShort = `Replay a recorded trace session`
+	replayLong  = replayShort + `
+
+The output recorded with --record when attaching is printed with the delays it was
+printed with, so that a session can be shared as evidence and watched again.`
+
+	replayExamples = `
+  # Record a trace session
+  %[1]s trace attach 656ee75a-ee3c-11e8-9e7a-8c164500a77e --record session.rec
+
+  # Replay it twice as fast
+  %[1]s trace replay session.rec --speed 2
+
+  # Print it at once
+  %[1]s trace replay session.rec --speed 0`
+
+	replayArgErrString     = "FILE is a required argument for the replay command"
+	speedNegativeErrString = "the speed must not be negative"
+)
+
+// ReplayOptions ...
+type ReplayOptions struct {
+	genericclioptions.IOStreams
+	file  string
+	speed float64
+}
+
+// NewReplayOptions provides an instance of ReplayOptions with default values.
+func NewReplayOptions(streams genericclioptions.IOStreams) *ReplayOptions {
+	return &ReplayOptions{
+		IOStreams: streams,
+		speed:     1,
+	}
+}
+
+// NewReplayCommand provides the replay command wrapping ReplayOptions.
+func NewReplayCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewReplayOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "replay FILE",
+		Short:        i18n.T(replayShort),
+		Long:         templates.LongDesc(i18n.T(replayLong)),
+		Example:      templates.Examples(fmt.Sprintf(i18n.T(replayExamples), "kubectl")),
+		SilenceUsage: true,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Float64Var(&o.speed, "speed", o.speed, "How many times faster than recorded to replay, 0 prints everything at once")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating ReplayOptions accordingly.
+func (o *ReplayOptions) Validate(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf(i18n.T(replayArgErrString))
+	}
+	if o.speed < 0 {
+		return fmt.Errorf(i18n.T(speedNegativeErrString))
+	}
+	o.file = args[0]
+	return nil
+}
+
+// Run prints the recorded session.
+func (o *ReplayOptions) Run() error {
+	f, err := os.Open(o.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return recording.Replay(f, o.Out, o.speed)
+}
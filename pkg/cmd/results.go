@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	resultsShort = `Download the results of a trace`
+	resultsLong  = resultsShort + `
+
+The output and the artifacts of traces run with --results-claim are saved to the claim,
+one directory per run. They are downloaded through a short lived pod mounting the claim,
+so that they are available once the trace is deleted.`
+
+	resultsExamples = `
+  # Download the results of a trace to the current directory
+  %[1]s trace results 656ee75a-ee3c-11e8-9e7a-8c164500a77e
+
+  # Download the results of a deleted trace from its claim
+  %[1]s trace results 656ee75a-ee3c-11e8-9e7a-8c164500a77e --claim traces -d /tmp/traces`
+
+	resultsArgErrString     = "(TRACE_ID | TRACE_NAME) is a required argument for the results command"
+	resultsClaimErrString   = "no results claim found for the trace, specify it with --claim"
+	resultsIDErrString      = "the full ID of a deleted trace is required to find its results"
+	resultsTimeoutErrString = "timed out waiting for the pod reading the results"
+	resultsPathErrString    = "invalid path %s in the results"
+	resultsPodErrString     = "the pod reading the results %s cannot run: %s"
+
+	// resultsPodTimeout is how long to wait for the pod reading the results to run.
+	resultsPodTimeout = 2 * time.Minute
+)
+
+// ResultsOptions ...
+type ResultsOptions struct {
+	genericclioptions.IOStreams
+	traceID      *types.UID
+	traceName    *string
+	namespace    string
+	clientConfig *rest.Config
+
+	claim string
+	dir   string
+}
+
+// NewResultsOptions provides an instance of ResultsOptions with default values.
+func NewResultsOptions(streams genericclioptions.IOStreams) *ResultsOptions {
+	return &ResultsOptions{
+		IOStreams: streams,
+		dir:       ".",
+	}
+}
+
+// NewResultsCommand provides the results command wrapping ResultsOptions.
+func NewResultsCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewResultsOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "results (TRACE_ID | TRACE_NAME)",
+		Short:        i18n.T(resultsShort),
+		Long:         templates.LongDesc(i18n.T(resultsLong)),
+		Example:      templates.Examples(fmt.Sprintf(i18n.T(resultsExamples), "kubectl")),
+		SilenceUsage: true,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&o.claim, "claim", o.claim, "PersistentVolumeClaim holding the results, by default the one of the trace")
+	cmd.Flags().StringVarP(&o.dir, "dir", "d", o.dir, "Directory to download the results to, in a directory named after the trace ID")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating ResultsOptions accordingly.
+func (o *ResultsOptions) Validate(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf(i18n.T(resultsArgErrString))
+	}
+	o.traceName, o.traceID = parseTraceArg(args[0])
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *ResultsOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.clientConfig, err = factory.ToRESTConfig()
+	return err
+}
+
+// Run downloads the results of the trace from its claim.
+func (o *ResultsOptions) Run() error {
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	id, claim, err := o.traceClaim(jobsClient.Jobs(o.namespace))
+	if err != nil {
+		return err
+	}
+
+	pods := coreClient.Pods(o.namespace)
+	pod, err := pods.Create(newResultsPod(claim))
+	if err != nil {
+		return err
+	}
+	defer pods.Delete(pod.Name, metav1.NewDeleteOptions(0))
+
+	err = wait.PollImmediate(time.Second, resultsPodTimeout, func() (bool, error) {
+		pod, err = pods.Get(pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if reason := tracejob.PodFailureReason(*pod); len(reason) > 0 {
+			return false, fmt.Errorf(i18n.T(resultsPodErrString), pod.Name, reason)
+		}
+		return pod.Status.Phase == v1.PodRunning, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf(i18n.T(resultsTimeoutErrString))
+	}
+	if err != nil {
+		return err
+	}
+
+	dest := filepath.Join(o.dir, string(id))
+	pr, pw := io.Pipe()
+	go func() {
+		cmd := []string{"tar", "-C", tracejob.ResultsPath + "/" + string(id), "-cf", "-", "."}
+		pw.CloseWithError(execInContainer(coreClient.RESTClient(), o.clientConfig, *pod, pod.Spec.Containers[0].Name, cmd, pw, o.ErrOut))
+	}()
+	if err := extractTar(pr, dest); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(o.Out, "results of trace %s downloaded to %s\n", id, dest)
+	return nil
+}
+
+// traceClaim provides the ID and the results claim of the trace, from its job
+// when it still exists.
+func (o *ResultsOptions) traceClaim(jobs batchv1client.JobInterface) (types.UID, string, error) {
+	tc := &tracejob.TraceJobClient{
+		JobClient: jobs,
+	}
+	ctx := context.Background()
+	tf, err := tc.ResolveIDPrefix(ctx, tracejob.TraceJobFilter{
+		Name: o.traceName,
+		ID:   o.traceID,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	tjs, err := tc.GetJob(ctx, tf)
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(tjs) == 0 {
+		if o.traceID == nil || len(*o.traceID) != tracejob.IDLength {
+			return "", "", fmt.Errorf(i18n.T(resultsIDErrString))
+		}
+		if len(o.claim) == 0 {
+			return "", "", fmt.Errorf(i18n.T(resultsClaimErrString))
+		}
+		return *o.traceID, o.claim, nil
+	}
+
+	tj := tjs[0]
+	claim := o.claim
+	if len(claim) == 0 {
+		jl, err := jobs.List(metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, tj.ID),
+		})
+		if err != nil {
+			return "", "", err
+		}
+		for _, j := range jl.Items {
+			for _, v := range j.Spec.Template.Spec.Volumes {
+				if v.Name == tracejob.ResultsVolume && v.PersistentVolumeClaim != nil {
+					claim = v.PersistentVolumeClaim.ClaimName
+				}
+			}
+		}
+	}
+	if len(claim) == 0 {
+		return "", "", fmt.Errorf(i18n.T(resultsClaimErrString))
+	}
+	return tj.ID, claim, nil
+}
+
+// newResultsPod provides a pod mounting the claim, idle while the results are read.
+func newResultsPod(claim string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("%sresults-%s", meta.ObjectNamePrefix, uuid.NewUUID()),
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				v1.Container{
+					Name:    "results",
+					Image:   meta.ImageNameTag,
+					Command: []string{"sleep", fmt.Sprintf("%d", int(resultsPodTimeout.Seconds())*10)},
+					VolumeMounts: []v1.VolumeMount{
+						v1.VolumeMount{
+							Name:      tracejob.ResultsVolume,
+							MountPath: tracejob.ResultsPath,
+							ReadOnly:  true,
+						},
+					},
+				},
+			},
+			Volumes: []v1.Volume{
+				v1.Volume{
+					Name: tracejob.ResultsVolume,
+					VolumeSource: v1.VolumeSource{
+						PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+							ClaimName: claim,
+							ReadOnly:  true,
+						},
+					},
+				},
+			},
+			RestartPolicy: v1.RestartPolicyNever,
+		},
+	}
+}
+
+// extractTar extracts the regular files and directories of a tar archive into
+// dest, refusing the paths going out of it.
+func extractTar(r io.Reader, dest string) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dest, h.Name)
+		if path != filepath.Clean(dest) && !strings.HasPrefix(path, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf(i18n.T(resultsPathErrString), h.Name)
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -2,26 +2,51 @@ package cmd
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
 
-	"github.com/fntlnz/kubectl-trace/pkg/attacher"
+	"github.com/fntlnz/kubectl-trace/pkg/client"
 	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/histogram"
+	"github.com/fntlnz/kubectl-trace/pkg/history"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
 	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/nodepolicy"
+	"github.com/fntlnz/kubectl-trace/pkg/setup"
 	"github.com/fntlnz/kubectl-trace/pkg/signals"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
 	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"github.com/fntlnz/kubectl-trace/pkg/upload"
+	"github.com/golang/glog"
 	"github.com/spf13/cobra"
+	batchv1 "k8s.io/api/batch/v1"
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericclioptions/printers"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes/scheme"
-	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 )
 
 var (
-	runShort = `Execute a bpftrace program on resources` // Wrap with i18n.T()
+	runShort = `Execute a bpftrace program on resources`
 
 	runLong = runShort
 
@@ -32,6 +57,36 @@ var (
   # Execute a bpftrace program from file on a specific node
   %[1]s trace run node/kubernetes-node-emt8.c.myproject.internal -f read.bt
 
+  # Execute a bpftrace program from file with an additional probe
+  %[1]s trace run node/kubernetes-node-emt8.c.myproject.internal -f read.bt -e 'interval:s:10 { exit(); }'
+
+  # Execute a bpftrace program from file with positional parameters, available as $1 and $2
+  %[1]s trace run node/kubernetes-node-emt8.c.myproject.internal -f tcpretrans.bt --args 8080,10
+
+  # Execute a bpftrace program for 10 minutes, the maps are printed before it terminates
+  %[1]s trace run node/kubernetes-node-emt8.c.myproject.internal -f read.bt --duration 10m
+
+  # Sample the stacks of a specific node with perf for 30 seconds
+  %[1]s trace run node/kubernetes-node-emt8.c.myproject.internal --tracer perf --duration 30s
+
+  # Profile the Python interpreter running in a pod container with py-spy for 30 seconds
+  %[1]s trace run pod/web -c web --tracer pyspy --duration 30s
+
+  # Capture an off-CPU profile of a node every hour
+  %[1]s trace run node/kubernetes-node-emt8.c.myproject.internal -f offcpu.bt --duration 1m --schedule "0 * * * *"
+
+  # Print the objects that would be created to run a bpftrace program, without creating them
+  %[1]s trace run node/kubernetes-node-emt8.c.myproject.internal -f read.bt --dry-run=client
+
+  # Run a bpftrace program and print the created objects as JSON
+  %[1]s trace run node/kubernetes-node-emt8.c.myproject.internal -f read.bt -o json
+
+  # Execute a bpftrace program on a node of a specific zone
+  %[1]s trace run -l topology.kubernetes.io/zone=us-east-1a -f read.bt
+
+  # Execute a bpftrace program on all the nodes of a specific zone
+  %[1]s trace run -l topology.kubernetes.io/zone=us-east-1a -f read.bt --all-matching
+
   # Run an bpftrace inline program on a pod container
   %[1]s trace run pod/nginx -c nginx -e "tracepoint:syscalls:sys_enter_* { @[probe] = count(); }"
   %[1]s trace run pod/nginx nginx -e "tracepoint:syscalls:sys_enter_* { @[probe] = count(); }"
@@ -42,8 +97,150 @@ var (
 	requiredArgErrString          = fmt.Sprintf("%s is a required argument for the %s command", usageString, runCommand)
 	containerAsArgOrFlagErrString = "specify container inline as argument or via its flag"
 	bpftraceMissingErrString      = "the bpftrace program is mandatory"
-	bpftraceDoubleErrString       = "specify the bpftrace program either via an external file or via a literal string, not both"
 	bpftraceEmptyErrString        = "the bpftrace programm cannot be empty"
+	tracerUnknownErrString        = "unknown tracer %s, supported tracers are: %s"
+	tracerNoProgramErrString      = "the %s tracer does not accept a program"
+	tracerNoArgsErrString         = "the %s tracer does not accept program arguments"
+	durationNegativeErrString     = "the duration must be positive"
+	ttlNegativeErrString          = "the ttl must not be negative"
+	backoffLimitErrString         = "the backoff limit must not be negative"
+	restartPolicyErrString        = "invalid restart policy %s, must be one of: %s, %s"
+	memlockErrString              = "invalid memlock limit %s, must be unlimited or a quantity like 64Mi"
+	imagePullPolicyErrString      = "invalid image pull policy %s, must be one of: %s, %s, %s"
+	resourceListErrString         = "invalid resource list %s, must be in the form cpu=100m,memory=64Mi"
+	tolerationErrString           = "invalid toleration %s, must be in the form key[=value][:effect]"
+	runAsUserNegativeErrString    = "the user to run as cannot be negative"
+	profileErrString              = "invalid %s profile %s, must be one of: %s or localhost/<profile>"
+	volumeErrString               = "invalid volume %s, must be in the form name:hostPath|configMap|pvc:source"
+	volumeReservedErrString       = "the volume name %s is reserved"
+	volumeMountErrString          = "invalid volume mount %s, must be in the form name:path[:ro]"
+	volumeMountUnknownErrString   = "the volume mount %s does not refer to any volume"
+	envErrString                  = "invalid environment variable %s, must be in the form KEY=VALUE"
+	nameErrString                 = "invalid trace name %s, must be lowercase alphanumeric characters or '-', of at most %d characters"
+	nameIDErrString               = "the trace name %s cannot be told from a trace ID, it must have a character other than 0-9, a-f and '-'"
+	labelErrString                = "invalid label %s, must be in the form KEY=VALUE: %s"
+	annotationErrString           = "invalid annotation %s, must be in the form KEY=VALUE: %s"
+	metaReservedErrString         = "the key %s is reserved by kubectl-trace"
+	tracerEnvErrString            = "invalid bpftrace setting %s, must be in the form NAME=VALUE, e.g. BPFTRACE_STRLEN=200"
+	tracerEnvTracerErrString      = "--tracer-env only applies to the %s tracer"
+	overridesErrString            = "the overrides must be a JSON object"
+	btfErrString                  = "invalid btf value %s, must be one of: %s, %s, %s"
+	securityModeErrString         = "invalid security mode %s, must be either %q or %q"
+	restrictedErrString           = "the %s security mode cannot be combined with %s"
+	podTargetUnsupportedErrString = "the %s tracer can only target nodes"
+	unitTracerErrString           = "the %s tracer cannot target a unit"
+	unitPodErrString              = "the unit only applies to node targets, the processes of a pod are traced by targeting the pod"
+	networkProgramErrString       = "the %s tracer requires a compiled BPF object given with --filename"
+	networkFlagsErrString         = "--interface, --direction and --section only apply to the %s and %s tracers"
+	directionErrString            = "invalid direction %s, must be either %q or %q"
+	directionTracerErrString      = "--direction only applies to the %s tracer"
+	interfaceRequiredErrString    = "the %s tracer requires --interface on node targets"
+	commandMissingErrString       = "the %s tracer requires the command to run after --, e.g. --command -- bpftool prog show"
+	commandTracerErrString        = "--command cannot be combined with the %s tracer"
+	commandArgsErrString          = "the arguments after -- are only accepted with --command"
+	bpftraceVersionErrString      = "invalid bpftrace version %s, must be a release like v0.9.4"
+	bpftraceVersionImageErrString = "--bpftrace-version cannot be combined with --imagename, the tag of the image tells the version"
+	podTargetRequiredErrString    = "the %s tracer can only target pods"
+	containerNotFoundErrString    = "container %s not found in pod %s"
+	containerNotRunningErrString  = "container %s in pod %s is not running"
+	podNotScheduledErrString      = "pod %s is not scheduled on any node yet"
+
+	scheduleAttachErrString   = "scheduled traces cannot be attached to when created"
+	scheduleWaitErrString     = "scheduled traces never end, they cannot be waited for"
+	scheduleDurationErrString = "scheduled bpftrace programs require a duration"
+
+	selectorArgErrString     = "specify either a resource or a node selector, not both"
+	allMatchingErrString     = "--all-matching requires a node selector"
+	selectorNoMatchErrString = "no node matches the selector %s"
+
+	checkTracerErrString  = "only bpftrace programs can be checked"
+	checkLocalErrString   = "bpftrace is not available locally to check the program"
+	checkFailedErrString  = "the program is not valid:\n%s"
+	checkTimeoutErrString = "timed out checking the program"
+	checkJobTimeout       = 2 * time.Minute
+	checkJobPollInterval  = time.Second
+
+	// attachDrainPeriod is how long the attachment outlives the traces, to
+	// print the output they wrote last
+	attachDrainPeriod = 2 * time.Second
+
+	dryRunUnknownErrString = "invalid dry-run value %s, must be either %q or %q"
+	dryRunAttachErrString  = "dry-run traces cannot be attached to"
+	dryRunWaitErrString    = "dry-run traces cannot be waited for"
+
+	nodePolicyErrString = "refusing to trace node %s, %s by the node policy, use --force to trace it anyway"
+	nodeForcedWarning   = "warning: tracing node %s though %s by the node policy\n"
+
+	// maxCronJobNameLength is the maximum length of the names of cron jobs,
+	// their jobs being named after them with a suffix
+	maxCronJobNameLength = 52
+	// nameIDLength is the length of the start of the ID appended to the names of
+	// the traces on several nodes
+	nameIDLength = 8
+
+	maxConcurrentErrString = "the maximum of concurrent traces must not be negative"
+	// maxConcurrentWait is how long the traces being started are waited for
+	// before starting the next ones anyway, e.g. when their image cannot be pulled
+	maxConcurrentWait = 2 * time.Minute
+
+	outputFileAttachErrString = "--output-file and --record require --attach"
+	renderAttachErrString     = "--render requires --attach"
+	renderFormatErrString     = "--render cannot be combined with --output-format %s"
+	renderErrString           = "invalid render mode %s, must be one of: %s"
+
+	outputUnknownErrString = "invalid output format %s, must be either %q or %q"
+	quietOutputErrString   = "--quiet cannot be combined with --output %s"
+
+	outputFormatErrString       = "invalid output format %s, must be either %q or %q"
+	outputFormatTracerErrString = "only bpftrace programs can have a json output format"
+	metricsPortErrString        = "the metrics port must be between 1 and 65535"
+	metricsPortTracerErrString  = "only the maps of bpftrace programs can be exported as metrics"
+	uploadSecretErrString       = "--upload-secret requires --upload-url"
+	notifyURLErrString          = "invalid notify URL %s, must be an http or https URL"
+
+	dryRunNone   = "none"
+	dryRunClient = "client"
+
+	outputJSON = "json"
+	outputYAML = "yaml"
+	outputID   = "id"
+	outputName = "name"
+
+	outputFormatText = "text"
+
+	defaultProfileDuration = 30 * time.Second
+
+	// cosHeadersURL is where Container-Optimized OS provides the headers of its builds,
+	// as the cos-toolbox does.
+	cosHeadersURL    = "https://storage.googleapis.com/cos-tools/{{.BuildID}}/kernel-headers.tgz"
+	cosOSImagePrefix = "Container-Optimized OS"
+
+	bottlerocketOSImagePrefix = "Bottlerocket OS"
+	bottlerocketSELinuxType   = "super_t"
+	amazonLinuxOSImagePrefix  = "Amazon Linux"
+
+	btfAuto     = "auto"
+	btfEnabled  = "true"
+	btfDisabled = "false"
+
+	// unprivilegedCapabilities are enough to load BPF programs and read the
+	// processes of the node on kernels supporting CAP_BPF and CAP_PERFMON.
+	unprivilegedCapabilities = []string{"BPF", "PERFMON", "SYS_RESOURCE", "SYS_PTRACE"}
+
+	// imageTagRegexp matches the valid tags of images.
+	imageTagRegexp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+	// bpftraceEnvPrefix prefixes the environment variables bpftrace is tuned with.
+	bpftraceEnvPrefix = "BPFTRACE_"
+	// tracerEnvRegexp matches the names of the settings of bpftrace.
+	tracerEnvRegexp = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+	securityModePrivileged = "privileged"
+	securityModeRestricted = "restricted"
+
+	// restrictedCapabilities are enough to load BPF programs on kernels accounting
+	// their memory to the cgroup, from 5.11.
+	restrictedCapabilities = []string{"BPF", "PERFMON"}
 )
 
 // RunOptions ...
@@ -52,23 +249,127 @@ type RunOptions struct {
 
 	namespace         string
 	explicitNamespace bool
+	// traceNamespace is where the trace objects are created, when not in the
+	// namespace of the target
+	traceNamespace string
 
 	// Local to this command
 	container   string
-	eval        string
+	eval        []string
 	program     string
 	resourceArg string
 	attach      bool
+	wait        bool
+	tracer      string
+	command     bool
+	// name is the name of the traces, their ID when empty
+	name     string
+	duration time.Duration
+	schedule string
+	crd      bool
+	dryRun   string
+	output   string
+	quiet    bool
+	// traceOutput prints only the ID or the name of each created trace, for scripts
+	traceOutput  string
+	outputFile   string
+	outFormat    string
+	metricsPort  int32
+	resultsClaim string
+	uploadURL    string
+	uploadSecret string
+	recordFile   string
+	render       string
+
+	programSecret bool
+	requestedBy   string
+	notifyURL     string
+
+	imageName       string
+	imageNameSet    bool
+	bpftraceVersion string
+	imagePullPolicy string
+	pullSecrets     []string
+	requests        string
+	limits          string
+	resources       v1.ResourceRequirements
+	serviceAccount  string
+	tolerationArgs  []string
+	tolerateAll     bool
+	tolerations     []v1.Toleration
+	unprivileged    bool
+	securityMode    string
+	capabilities    []string
+	runAsUser       int64
+	runAsUserSet    bool
+	seccompProfile  string
+	appArmorProfile string
+	priorityClass   string
+	hostPID         bool
+	hostNetwork     bool
+	volumeArgs      []string
+	mountArgs       []string
+	volumes         []v1.Volume
+	volumeMounts    []v1.VolumeMount
+	envArgs         []string
+	labelArgs       []string
+	annotationArgs  []string
+	labels          map[string]string
+	annotations     map[string]string
+	tracerEnvArgs   []string
+	env             []v1.EnvVar
+	overrides       string
+	args            []string
+	btf             string
+	fetchHeaders    bool
+	headersURL      string
+	seLinuxType     string
+	ttl             time.Duration
+	backoffLimit    int32
+	memlock         string
+	restartPolicy   string
+	iface           string
+	direction       string
+	section         string
+
+	selector      string
+	allMatching   bool
+	check         bool
+	maxConcurrent int
 
-	nodeName string
+	allowNodes []string
+	denyNodes  []string
+	force      bool
+	nodePolicy *nodepolicy.Policy
+
+	nodes        []traceNode
+	containerID  string
+	targetPod    string
+	unit         string
+	cgroupFilter bool
 
 	clientConfig *rest.Config
+
+	// traceIDs are the IDs of the traces created by Run
+	traceIDs []string
+	// exitCode is the exit status told by Run, how the waited traces ended
+	exitCode int
 }
 
 // NewRunOptions provides an instance of RunOptions with default values.
 func NewRunOptions(streams genericclioptions.IOStreams) *RunOptions {
 	return &RunOptions{
-		IOStreams: streams,
+		IOStreams:     streams,
+		tracer:        string(tracejob.BpftraceTracer),
+		imageName:     meta.ImageNameTag,
+		btf:           btfAuto,
+		securityMode:  securityModePrivileged,
+		dryRun:        dryRunNone,
+		ttl:           tracejob.DefaultTTL,
+		backoffLimit:  tracejob.DefaultBackoffLimit,
+		restartPolicy: string(v1.RestartPolicyNever),
+		outFormat:     outputFormatText,
+		cgroupFilter:  true,
 	}
 }
 
@@ -78,9 +379,9 @@ func NewRunCommand(factory factory.Factory, streams genericclioptions.IOStreams)
 
 	cmd := &cobra.Command{
 		Use:          fmt.Sprintf("%s %s [-c CONTAINER] [--attach]", runCommand, usageString),
-		Short:        runShort,
-		Long:         runLong,                             // Wrap with templates.LongDesc()
-		Example:      fmt.Sprintf(runExamples, "kubectl"), // Wrap with templates.Examples()
+		Short:        i18n.T(runShort),
+		Long:         templates.LongDesc(i18n.T(runLong)),
+		Example:      templates.Examples(fmt.Sprintf(i18n.T(runExamples), "kubectl")),
 		SilenceUsage: true,
 		PreRunE: func(c *cobra.Command, args []string) error {
 			return o.Validate(c, args)
@@ -89,26 +390,121 @@ func NewRunCommand(factory factory.Factory, streams genericclioptions.IOStreams)
 			if err := o.Complete(factory, c, args); err != nil {
 				return err
 			}
-			if err := o.Run(); err != nil {
+			err := o.Run()
+			if o.dryRun != dryRunClient {
+				o.recordHistory(err)
+			}
+			if err != nil {
 				fmt.Fprintln(o.ErrOut, err.Error())
+				// Scripts attached to or waiting for the traces tell failures by the exit status
+				if o.attach || o.wait {
+					return exitWith(c, 1)
+				}
 				return nil
 			}
+			if o.exitCode != 0 {
+				return exitWith(c, o.exitCode)
+			}
 			return nil
 		},
 	}
 
 	cmd.Flags().StringVarP(&o.container, "container", "c", o.container, "Specify the container")
+	cmd.MarkFlagCustom("container", "__kubectl_trace_get_containers")
+	cmd.Flags().StringVar(&o.unit, "unit", o.unit, "Node service to trace on node targets, a systemd unit like kubelet, containerd or crio, or else the command name of its processes. Its host PID is available as {{.UnitPID}}")
+	cmd.Flags().BoolVar(&o.cgroupFilter, "cgroup-filter", o.cgroupFilter, "Scope the probes of bpftrace programs tracing a container or a unit to its cgroup, except BEGIN, END and interval probes, so that the trace only sees its activity. Requires the unified cgroup hierarchy")
 	cmd.Flags().BoolVarP(&o.attach, "attach", "a", o.attach, "Wheter or not to attach to the trace program once it is created")
-	cmd.Flags().StringVarP(&o.eval, "eval", "e", "", "Literal string to be evaluated as a bpftrace program")
-	cmd.Flags().StringVarP(&o.program, "filename", "f", "", "File containing a bpftrace program")
+	cmd.Flags().BoolVar(&o.wait, "wait", o.wait, "Wait for the traces to end, exiting with the exit code of the tracer unless they all completed")
+	cmd.Flags().StringVar(&o.dryRun, "dry-run", o.dryRun, fmt.Sprintf("Must be %q or %q, with %q the objects that would be created are only printed", dryRunNone, dryRunClient, dryRunClient))
+	cmd.Flags().Lookup("dry-run").NoOptDefVal = dryRunClient
+	cmd.Flags().StringVarP(&o.selector, "selector", "l", o.selector, "Label selector of the nodes to run the trace on, in place of a resource")
+	cmd.Flags().BoolVar(&o.allMatching, "all-matching", o.allMatching, "Run the trace on all the nodes matching the selector instead of the first one")
+	cmd.Flags().IntVar(&o.maxConcurrent, "max-concurrent", o.maxConcurrent, "Start at most this many traces at once, the next ones being created and attached to once their pods started, so that many nodes do not pull the tracer image at the same time. 0 starts them all at once")
+	cmd.Flags().StringArrayVar(&o.allowNodes, "allow-node", o.allowNodes, "Node that may be traced, by name with wildcards like ip-10-0-* or by label selector like env=staging, can be repeated. Once set other nodes are refused without --force, usually set in the config file")
+	cmd.Flags().StringArrayVar(&o.denyNodes, "deny-node", o.denyNodes, "Node that is refused without --force, by name with wildcards like ip-10-0-* or by label selector like env=prod, can be repeated. Usually set in the config file")
+	cmd.Flags().BoolVar(&o.force, "force", o.force, "Trace the nodes refused by --allow-node and --deny-node anyway")
+	cmd.Flags().BoolVar(&o.check, "check", o.check, "Check the program before creating the trace, with the local bpftrace when available or else with a short lived job")
+	cmd.Flags().BoolVarP(&o.quiet, "quiet", "q", o.quiet, fmt.Sprintf("Only print the ID of each created trace, like --output %s", outputID))
+	o.addJobFlags(cmd)
+	cmd.Flags().Lookup("output").Usage = fmt.Sprintf("Print the created objects instead of the trace ID, one of: %s, %s. Or print only the ID or the job name of each trace, one per line, with %s or %s", outputJSON, outputYAML, outputID, outputName)
 
 	return cmd
 }
 
+// addJobFlags adds the flags describing the trace job, shared by the commands building one.
+func (o *RunOptions) addJobFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&o.eval, "eval", "e", o.eval, "Literal string to be evaluated as a bpftrace program, can be repeated and combined with a file to append probes to it")
+	cmd.Flags().StringVarP(&o.program, "filename", "f", "", "File containing a bpftrace program")
+	cmd.Flags().StringSliceVar(&o.args, "args", o.args, "Positional parameters of the bpftrace program, available as $1, $2...")
+	cmd.Flags().StringVar(&o.name, "name", o.name, fmt.Sprintf("Name of the trace, e.g. checkout-latency, prefixed with %s. The trace ID is still recorded in its labels, and traces on several nodes get the start of their ID appended", meta.ObjectNamePrefix))
+	cmd.Flags().StringVar(&o.tracer, "tracer", o.tracer, fmt.Sprintf("Tracer to use, one of: %s", tracersString()))
+	cmd.Flags().BoolVar(&o.command, "command", o.command, fmt.Sprintf("Run the command given after -- instead of a program, like the %s tracer. Its arguments are templates like programs, e.g. {{.ContainerPID}}, and the image must have the trace-runner", tracejob.CommandTracer))
+	cmd.Flags().StringVar(&o.schedule, "schedule", o.schedule, "Cron schedule to run the trace periodically, e.g. \"0 * * * *\"")
+	cmd.Flags().StringVar(&o.traceNamespace, "trace-namespace", o.traceNamespace, "Namespace to create the trace in, e.g. one dedicated to privileged workloads, while the target pod is looked up in the namespace of the command")
+	cmd.Flags().BoolVar(&o.crd, "crd", o.crd, "Declare the trace as a TraceJob resource reconciled by the in-cluster controller")
+	cmd.Flags().StringVarP(&o.output, "output", "o", o.output, fmt.Sprintf("Print the created objects instead of the trace ID, one of: %s, %s", outputJSON, outputYAML))
+	cmd.Flags().StringVar(&o.outFormat, "output-format", o.outFormat, fmt.Sprintf("Output format of bpftrace, one of: %s, %s. With %s the attached output has a JSON event per line, along with the trace ID, node and time", outputFormatText, tracejob.OutputFormatJSON, tracejob.OutputFormatJSON))
+	cmd.Flags().Int32Var(&o.metricsPort, "metrics-port", o.metricsPort, "Port of a sidecar exposing the maps printed by the program as Prometheus metrics, along with a Service. The program prints them with print(), e.g. every 10s with interval:s:10")
+	cmd.Flags().StringVar(&o.resultsClaim, "results-claim", o.resultsClaim, "PersistentVolumeClaim to save the output and the artifacts of the trace to, to be downloaded with the results command")
+	cmd.Flags().StringVar(&o.uploadURL, "upload-url", o.uploadURL, "Bucket to upload the output and the artifacts of the trace to when it ends, one of: s3://BUCKET/PREFIX, gs://BUCKET/PREFIX, azblob://ACCOUNT/CONTAINER/PREFIX")
+	cmd.Flags().StringVar(&o.uploadSecret, "upload-secret", o.uploadSecret, "Secret holding the credentials of the upload bucket as environment variables, e.g. AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_REGION")
+	cmd.Flags().StringVar(&o.notifyURL, "notify-url", o.notifyURL, "URL the trace pod POSTs a JSON notification to when the trace completes or fails, e.g. a Slack incoming webhook")
+	cmd.Flags().BoolVar(&o.programSecret, "program-secret", o.programSecret, "Store the program in a Secret rather than a ConfigMap, for programs embedding sensitive paths, tokens or hostnames")
+	cmd.Flags().StringVar(&o.outputFile, "output-file", o.outputFile, "File to also write the output of the trace to while attached")
+	cmd.Flags().StringVar(&o.recordFile, "record", o.recordFile, "File to record the output of the trace to with the time of each line while attached, to be replayed with the replay command")
+	cmd.Flags().StringVar(&o.render, "render", o.render, fmt.Sprintf("Render the histograms printed by bpftrace while attached, one of: %s", strings.Join(histogram.Modes, ", ")))
+	cmd.Flags().StringVar(&o.imageName, "imagename", o.imageName, "Name of the image running the tracer, with its tag. By default the tag matches the architecture of the node")
+	cmd.Flags().StringVar(&o.bpftraceVersion, "bpftrace-version", o.bpftraceVersion, fmt.Sprintf("Release of bpftrace to run, e.g. v0.9.4, with the tracer image tagged %sVERSION", meta.BpftraceTagPrefix))
+	cmd.Flags().StringVar(&o.imagePullPolicy, "image-pull-policy", o.imagePullPolicy, fmt.Sprintf("Pull policy of the tracer image, one of: %s, %s, %s", v1.PullAlways, v1.PullIfNotPresent, v1.PullNever))
+	cmd.Flags().StringSliceVar(&o.pullSecrets, "image-pull-secret", o.pullSecrets, "Name of a secret to pull the tracer image with, can be repeated")
+	cmd.Flags().StringVar(&o.requests, "requests", o.requests, "Resource requests of the tracer container, e.g. cpu=100m,memory=64Mi")
+	cmd.Flags().StringVar(&o.limits, "limits", o.limits, "Resource limits of the tracer container, e.g. cpu=500m,memory=256Mi")
+	cmd.Flags().StringVar(&o.serviceAccount, "serviceaccount", o.serviceAccount, "Service account to run the trace pod with")
+	cmd.Flags().StringArrayVar(&o.tolerationArgs, "toleration", o.tolerationArgs, "Toleration of the trace pod in the form key[=value][:effect], can be repeated")
+	cmd.Flags().BoolVar(&o.tolerateAll, "tolerate-all", o.tolerateAll, "Tolerate all the taints, to trace any node")
+	cmd.Flags().BoolVar(&o.unprivileged, "unprivileged", o.unprivileged, fmt.Sprintf("Run the tracer unprivileged with the %s capabilities, requires a kernel supporting CAP_BPF and CAP_PERFMON", strings.Join(unprivilegedCapabilities, ", ")))
+	cmd.Flags().StringVar(&o.securityMode, "security-mode", o.securityMode, fmt.Sprintf("Security of the trace pod, either %s or %s. A %s trace pod has no host namespaces nor host mounts, only the %s capabilities and the runtime default seccomp profile. It requires a kernel with BTF from 5.11 and can only trace the kernel", securityModePrivileged, securityModeRestricted, securityModeRestricted, strings.Join(restrictedCapabilities, ", ")))
+	cmd.Flags().StringSliceVar(&o.capabilities, "capabilities", o.capabilities, "Run the tracer unprivileged with only these capabilities, e.g. SYS_ADMIN,SYS_RESOURCE on older kernels")
+	cmd.Flags().Int64Var(&o.runAsUser, "run-as-user", o.runAsUser, "User ID to run the tracer as, capabilities are only effective for non-root users when the tracer binaries have them as file capabilities")
+	cmd.Flags().StringVar(&o.seccompProfile, "seccomp-profile", o.seccompProfile, "Seccomp profile of the trace pod, e.g. runtime/default, unconfined or localhost/<profile>")
+	cmd.Flags().StringVar(&o.appArmorProfile, "apparmor-profile", o.appArmorProfile, "AppArmor profile of the tracer container, e.g. runtime/default, unconfined or localhost/<profile>")
+	cmd.Flags().StringVar(&o.priorityClass, "priority-class-name", o.priorityClass, "Priority class of the trace pod")
+	cmd.Flags().BoolVar(&o.hostPID, "host-pid", o.hostPID, "Run the trace pod in the host PID namespace, always the case when tracing a container")
+	cmd.Flags().BoolVar(&o.hostNetwork, "host-network", o.hostNetwork, "Run the trace pod in the host network namespace, e.g. for tc or socket tracing")
+	cmd.Flags().StringVar(&o.iface, "interface", o.iface, fmt.Sprintf("Network interface of the node the %s and %s tracers attach to, the host side of the interface of the pod for pod targets", tracejob.TcTracer, tracejob.XDPTracer))
+	cmd.Flags().StringVar(&o.direction, "direction", o.direction, fmt.Sprintf("Traffic seen by the %s tracer, %s by default or %s", tracejob.TcTracer, tracejob.DirectionIngress, tracejob.DirectionEgress))
+	cmd.Flags().StringVar(&o.section, "section", o.section, fmt.Sprintf("ELF section of the BPF object of the %s and %s tracers, the iproute2 default by default", tracejob.TcTracer, tracejob.XDPTracer))
+	cmd.Flags().StringArrayVar(&o.volumeArgs, "volume", o.volumeArgs, "Volume of the trace pod in the form name:hostPath|configMap|pvc:source, can be repeated")
+	cmd.Flags().StringArrayVar(&o.mountArgs, "volume-mount", o.mountArgs, "Mount of a volume in the tracer container in the form name:path[:ro], can be repeated")
+	cmd.Flags().StringArrayVar(&o.envArgs, "env", o.envArgs, "Environment variable of the tracer container in the form KEY=VALUE, can be repeated. NODE_NAME, TRACE_ID and TARGET_POD for pods are always set")
+	cmd.Flags().StringArrayVar(&o.tracerEnvArgs, "tracer-env", o.tracerEnvArgs, fmt.Sprintf("Setting of bpftrace in the form NAME=VALUE, the %s prefix being optional, e.g. MAP_KEYS_MAX=65536, STRLEN=200 or MAX_PROBES=1024. Can be repeated", bpftraceEnvPrefix))
+	cmd.Flags().StringArrayVar(&o.labelArgs, "label", o.labelArgs, "Label of the objects of the trace in the form KEY=VALUE, e.g. team=payments, can be repeated")
+	cmd.Flags().StringArrayVar(&o.annotationArgs, "annotation", o.annotationArgs, "Annotation of the objects of the trace in the form KEY=VALUE, e.g. ticket=INC-1234, can be repeated")
+	cmd.Flags().StringVar(&o.overrides, "overrides", o.overrides, "Inline JSON merge patch applied to the generated Job, or to the job template of scheduled traces")
+	cmd.Flags().StringVar(&o.btf, "btf", o.btf, fmt.Sprintf("Whether the node kernel has BTF, so that its headers are not mounted, one of: %s, %s, %s. With %s nodes labeled %s=true or %s=true have it", btfAuto, btfEnabled, btfDisabled, btfAuto, meta.BTFLabelKey, meta.NFDBTFLabelKey))
+	cmd.Flags().BoolVar(&o.fetchHeaders, "fetch-headers", o.fetchHeaders, "Fetch the kernel headers in an init container, from the kernel when built with CONFIG_IKHEADERS or else from --headers-url")
+	cmd.Flags().StringVar(&o.headersURL, "headers-url", o.headersURL, "URL template of a tar.gz archive of the kernel headers, e.g. https://mirror/linux-headers-{{.KernelRelease}}.tar.gz, implies --fetch-headers")
+	cmd.Flags().DurationVar(&o.ttl, "ttl", o.ttl, "How long the trace is kept once finished so that its output can be read, 0 keeps it until deleted. Requires the TTL controller of the cluster")
+	cmd.Flags().Int32Var(&o.backoffLimit, "backoff-limit", o.backoffLimit, "How many times a failed tracer is retried, every retry attaches the probes again. 0 never retries")
+	cmd.Flags().StringVar(&o.restartPolicy, "restart-policy", o.restartPolicy, fmt.Sprintf("Restart policy of the trace pod, one of: %s, %s. With %s a failed tracer is retried in the same pod", v1.RestartPolicyNever, v1.RestartPolicyOnFailure, v1.RestartPolicyOnFailure))
+	cmd.Flags().StringVar(&o.memlock, "memlock", o.memlock, fmt.Sprintf("Locked memory limit of the tracer, unlimited or a quantity like 64Mi. The maps of BPF programs count against it on kernels older than 5.11. Defaults to %s for privileged tracers and those having SYS_RESOURCE", tracejob.DefaultMemlock))
+	cmd.Flags().StringVar(&o.seLinuxType, "selinux-type", o.seLinuxType, fmt.Sprintf("SELinux type of the tracer container, defaults to %s on Bottlerocket nodes", bottlerocketSELinuxType))
+	cmd.Flags().DurationVar(&o.duration, "duration", o.duration, fmt.Sprintf("How long the trace runs before being interrupted, profiling tracers default to %s while bpftrace runs until deleted", defaultProfileDuration))
+}
+
 // Validate validates the arguments and flags populating RunOptions accordingly.
 func (o *RunOptions) Validate(cmd *cobra.Command, args []string) error {
+	args, err := o.splitCommand(cmd, args)
+	if err != nil {
+		return err
+	}
 	containerFlagDefined := cmd.Flag("container").Changed
 	switch len(args) {
+	case 0:
+		if len(o.selector) == 0 {
+			return fmt.Errorf(i18n.T(requiredArgErrString))
+		}
+		break
 	case 1:
 		o.resourceArg = args[0]
 		break
@@ -117,37 +513,557 @@ func (o *RunOptions) Validate(cmd *cobra.Command, args []string) error {
 		o.resourceArg = args[0]
 		o.container = args[1]
 		if containerFlagDefined {
-			return fmt.Errorf(containerAsArgOrFlagErrString)
+			return fmt.Errorf(i18n.T(containerAsArgOrFlagErrString))
 		}
 		break
 	default:
-		return fmt.Errorf(requiredArgErrString)
+		return fmt.Errorf(i18n.T(requiredArgErrString))
+	}
+
+	if len(o.selector) > 0 && len(args) > 0 {
+		return fmt.Errorf(i18n.T(selectorArgErrString))
+	}
+	if o.allMatching && len(o.selector) == 0 {
+		return fmt.Errorf(i18n.T(allMatchingErrString))
+	}
+	if o.maxConcurrent < 0 {
+		return fmt.Errorf(i18n.T(maxConcurrentErrString))
+	}
+	if len(o.selector) > 0 && tracejob.Tracer(o.tracer).TargetsProcess() {
+		return fmt.Errorf(i18n.T(podTargetRequiredErrString), o.tracer)
+	}
+
+	if o.check && tracejob.Tracer(o.tracer) != tracejob.BpftraceTracer {
+		return fmt.Errorf(i18n.T(checkTracerErrString))
+	}
+
+	if o.dryRun != dryRunNone && o.dryRun != dryRunClient {
+		return fmt.Errorf(i18n.T(dryRunUnknownErrString), o.dryRun, dryRunNone, dryRunClient)
+	}
+	if o.dryRun == dryRunClient && o.attach {
+		return fmt.Errorf(i18n.T(dryRunAttachErrString))
+	}
+	if o.dryRun == dryRunClient && o.wait {
+		return fmt.Errorf(i18n.T(dryRunWaitErrString))
+	}
+	if o.nodePolicy, err = nodepolicy.New(o.allowNodes, o.denyNodes); err != nil {
+		return err
+	}
+	if o.quiet {
+		if len(o.output) > 0 && o.output != outputID {
+			return fmt.Errorf(i18n.T(quietOutputErrString), o.output)
+		}
+		o.output = outputID
+	}
+	if o.output == outputID || o.output == outputName {
+		o.traceOutput, o.output = o.output, ""
+	}
+	if (len(o.outputFile) > 0 || len(o.recordFile) > 0) && !o.attach {
+		return fmt.Errorf(i18n.T(outputFileAttachErrString))
+	}
+	if len(o.render) > 0 {
+		if err := validateRender(o.render); err != nil {
+			return err
+		}
+		if !o.attach {
+			return fmt.Errorf(i18n.T(renderAttachErrString))
+		}
+		if o.outFormat == tracejob.OutputFormatJSON {
+			return fmt.Errorf(i18n.T(renderFormatErrString), o.outFormat)
+		}
+	}
+
+	return o.validateJob(cmd)
+}
+
+// splitCommand takes the arguments after the dash as the command of the
+// command tracer, selected by --command, providing the arguments before it.
+func (o *RunOptions) splitCommand(cmd *cobra.Command, args []string) ([]string, error) {
+	if o.command {
+		if cmd.Flag("tracer").Changed && tracejob.Tracer(o.tracer) != tracejob.CommandTracer {
+			return nil, fmt.Errorf(i18n.T(commandTracerErrString), o.tracer)
+		}
+		o.tracer = string(tracejob.CommandTracer)
+	}
+
+	dash := cmd.ArgsLenAtDash()
+	if tracejob.Tracer(o.tracer) != tracejob.CommandTracer {
+		if dash >= 0 {
+			return nil, fmt.Errorf(i18n.T(commandArgsErrString))
+		}
+		return args, nil
+	}
+	if dash < 0 || dash == len(args) {
+		return nil, fmt.Errorf(i18n.T(commandMissingErrString), o.tracer)
+	}
+	o.args = args[dash:]
+	return args[:dash], nil
+}
+
+// validateJob validates the flags added by addJobFlags.
+func (o *RunOptions) validateJob(cmd *cobra.Command) error {
+	if err := o.validateTracer(cmd); err != nil {
+		return err
+	}
+	if err := o.validateSchedule(cmd); err != nil {
+		return err
+	}
+	if len(o.output) > 0 && o.output != outputJSON && o.output != outputYAML {
+		return fmt.Errorf(i18n.T(outputUnknownErrString), o.output, outputJSON, outputYAML)
+	}
+	var err error
+	if o.resources.Requests, err = parseResourceList(o.requests); err != nil {
+		return err
+	}
+	if o.resources.Limits, err = parseResourceList(o.limits); err != nil {
+		return err
+	}
+	if o.tolerateAll {
+		o.tolerations = append(o.tolerations, v1.Toleration{Operator: v1.TolerationOpExists})
+	}
+	for _, t := range o.tolerationArgs {
+		toleration, err := parseToleration(t)
+		if err != nil {
+			return err
+		}
+		o.tolerations = append(o.tolerations, toleration)
+	}
+	if err := o.validateName(); err != nil {
+		return err
+	}
+	o.runAsUserSet = cmd.Flag("run-as-user").Changed
+	if o.runAsUserSet && o.runAsUser < 0 {
+		return fmt.Errorf(i18n.T(runAsUserNegativeErrString))
+	}
+	if err := o.validateSecurityMode(cmd); err != nil {
+		return err
+	}
+	if o.unprivileged && len(o.capabilities) == 0 {
+		o.capabilities = append([]string{}, unprivilegedCapabilities...)
+	}
+	for i, c := range o.capabilities {
+		o.capabilities[i] = strings.TrimPrefix(strings.ToUpper(c), "CAP_")
+	}
+	if err := validateProfile("seccomp", o.seccompProfile, v1.SeccompProfileRuntimeDefault, v1.DeprecatedSeccompProfileDockerDefault, "unconfined"); err != nil {
+		return err
+	}
+	if err := validateProfile("AppArmor", o.appArmorProfile, "runtime/default", "unconfined"); err != nil {
+		return err
+	}
+	if err := o.validateVolumes(); err != nil {
+		return err
+	}
+	for _, kv := range o.envArgs {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return fmt.Errorf(i18n.T(envErrString), kv)
+		}
+		o.env = append(o.env, v1.EnvVar{Name: parts[0], Value: parts[1]})
+	}
+	if len(o.tracerEnvArgs) > 0 && tracejob.Tracer(o.tracer) != tracejob.BpftraceTracer {
+		return fmt.Errorf(i18n.T(tracerEnvTracerErrString), tracejob.BpftraceTracer)
+	}
+	for _, kv := range o.tracerEnvArgs {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || len(parts[1]) == 0 || !tracerEnvRegexp.MatchString(parts[0]) {
+			return fmt.Errorf(i18n.T(tracerEnvErrString), kv)
+		}
+		name := parts[0]
+		if !strings.HasPrefix(name, bpftraceEnvPrefix) {
+			name = bpftraceEnvPrefix + name
+		}
+		o.env = append(o.env, v1.EnvVar{Name: name, Value: parts[1]})
+	}
+	if o.labels, err = parseMeta(o.labelArgs, labelErrString, true); err != nil {
+		return err
+	}
+	if o.annotations, err = parseMeta(o.annotationArgs, annotationErrString, false); err != nil {
+		return err
+	}
+	o.imageNameSet = cmd.Flag("imagename").Changed
+	if len(o.bpftraceVersion) > 0 {
+		if o.imageNameSet {
+			return fmt.Errorf(i18n.T(bpftraceVersionImageErrString))
+		}
+		if !imageTagRegexp.MatchString(o.bpftraceVersion) {
+			return fmt.Errorf(i18n.T(bpftraceVersionErrString), o.bpftraceVersion)
+		}
+		// The releases of bpftrace are tagged with a v
+		if o.bpftraceVersion[0] >= '0' && o.bpftraceVersion[0] <= '9' {
+			o.bpftraceVersion = "v" + o.bpftraceVersion
+		}
+	}
+	if o.btf != btfAuto && o.btf != btfEnabled && o.btf != btfDisabled {
+		return fmt.Errorf(i18n.T(btfErrString), o.btf, btfAuto, btfEnabled, btfDisabled)
+	}
+	if len(o.headersURL) > 0 {
+		o.fetchHeaders = true
+	}
+	if len(o.overrides) > 0 {
+		overrides := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(o.overrides), &overrides); err != nil {
+			return fmt.Errorf(i18n.T(overridesErrString))
+		}
+	}
+	switch v1.PullPolicy(o.imagePullPolicy) {
+	case "", v1.PullAlways, v1.PullIfNotPresent, v1.PullNever:
+	default:
+		return fmt.Errorf(i18n.T(imagePullPolicyErrString), o.imagePullPolicy, v1.PullAlways, v1.PullIfNotPresent, v1.PullNever)
+	}
+	if tracejob.Tracer(o.tracer) != tracejob.BpftraceTracer {
+		return nil
 	}
 
 	if !cmd.Flag("eval").Changed && !cmd.Flag("filename").Changed {
-		return fmt.Errorf(bpftraceMissingErrString)
+		return fmt.Errorf(i18n.T(bpftraceMissingErrString))
+	}
+	if cmd.Flag("filename").Changed && len(o.program) == 0 {
+		return fmt.Errorf(i18n.T(bpftraceEmptyErrString))
+	}
+	for _, e := range o.eval {
+		if len(strings.TrimSpace(e)) == 0 {
+			return fmt.Errorf(i18n.T(bpftraceEmptyErrString))
+		}
+	}
+
+	return nil
+}
+
+func (o *RunOptions) validateTracer(cmd *cobra.Command) error {
+	tracer := tracejob.Tracer(o.tracer)
+	known := false
+	for _, t := range tracejob.Tracers {
+		if t == tracer {
+			known = true
+		}
+	}
+	if !known {
+		return fmt.Errorf(i18n.T(tracerUnknownErrString), o.tracer, tracersString())
+	}
+
+	if cmd.Flag("duration").Changed && o.duration <= 0 {
+		return fmt.Errorf(i18n.T(durationNegativeErrString))
+	}
+	if o.ttl < 0 {
+		return fmt.Errorf(i18n.T(ttlNegativeErrString))
+	}
+	if o.backoffLimit < 0 {
+		return fmt.Errorf(i18n.T(backoffLimitErrString))
+	}
+	if len(o.memlock) > 0 {
+		if _, err := parseMemlock(o.memlock); err != nil {
+			return fmt.Errorf(i18n.T(memlockErrString), o.memlock)
+		}
+	}
+	switch v1.RestartPolicy(o.restartPolicy) {
+	case v1.RestartPolicyNever, v1.RestartPolicyOnFailure:
+	default:
+		return fmt.Errorf(i18n.T(restartPolicyErrString), o.restartPolicy, v1.RestartPolicyNever, v1.RestartPolicyOnFailure)
+	}
+	if o.outFormat != outputFormatText && o.outFormat != tracejob.OutputFormatJSON {
+		return fmt.Errorf(i18n.T(outputFormatErrString), o.outFormat, outputFormatText, tracejob.OutputFormatJSON)
+	}
+	if o.outFormat == tracejob.OutputFormatJSON && tracer != tracejob.BpftraceTracer {
+		return fmt.Errorf(i18n.T(outputFormatTracerErrString))
+	}
+	if cmd.Flag("metrics-port").Changed {
+		if o.metricsPort < 1 || o.metricsPort > 65535 {
+			return fmt.Errorf(i18n.T(metricsPortErrString))
+		}
+		if tracer != tracejob.BpftraceTracer {
+			return fmt.Errorf(i18n.T(metricsPortTracerErrString))
+		}
+	}
+	if len(o.notifyURL) > 0 {
+		if u, err := url.Parse(o.notifyURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf(i18n.T(notifyURLErrString), o.notifyURL)
+		}
+	}
+	if len(o.uploadURL) > 0 {
+		if err := upload.ValidateURL(o.uploadURL); err != nil {
+			return err
+		}
+	} else if len(o.uploadSecret) > 0 {
+		return fmt.Errorf(i18n.T(uploadSecretErrString))
+	}
+
+	if tracer != tracejob.BpftraceTracer {
+		if len(o.unit) > 0 && tracer != tracejob.CommandTracer {
+			return fmt.Errorf(i18n.T(unitTracerErrString), o.tracer)
+		}
+		if cmd.Flag("eval").Changed || (cmd.Flag("filename").Changed && !tracer.IsNetwork()) {
+			return fmt.Errorf(i18n.T(tracerNoProgramErrString), o.tracer)
+		}
+		if cmd.Flag("args").Changed {
+			return fmt.Errorf(i18n.T(tracerNoArgsErrString), o.tracer)
+		}
+		if tracer.IsProfiler() && o.duration == 0 {
+			o.duration = defaultProfileDuration
+		}
+	}
+
+	if !tracer.IsNetwork() {
+		if len(o.iface)+len(o.direction)+len(o.section) > 0 {
+			return fmt.Errorf(i18n.T(networkFlagsErrString), tracejob.TcTracer, tracejob.XDPTracer)
+		}
+		return nil
+	}
+	// The BPF objects are compiled, e.g. with clang -target bpf
+	if !cmd.Flag("filename").Changed {
+		return fmt.Errorf(i18n.T(networkProgramErrString), o.tracer)
+	}
+	switch {
+	case len(o.direction) == 0:
+	case tracer != tracejob.TcTracer:
+		return fmt.Errorf(i18n.T(directionTracerErrString), tracejob.TcTracer)
+	case o.direction != tracejob.DirectionIngress && o.direction != tracejob.DirectionEgress:
+		return fmt.Errorf(i18n.T(directionErrString), o.direction, tracejob.DirectionIngress, tracejob.DirectionEgress)
+	}
+	return nil
+}
+
+func (o *RunOptions) validateSchedule(cmd *cobra.Command) error {
+	if !cmd.Flag("schedule").Changed {
+		return nil
+	}
+	if o.attach {
+		return fmt.Errorf(i18n.T(scheduleAttachErrString))
+	}
+	if o.wait {
+		return fmt.Errorf(i18n.T(scheduleWaitErrString))
+	}
+	// Every capture must end for the next one to start
+	if o.duration == 0 {
+		return fmt.Errorf(i18n.T(scheduleDurationErrString))
+	}
+	return nil
+}
+
+// parseResourceList parses a list of cpu and memory quantities like cpu=100m,memory=64Mi.
+func parseResourceList(s string) (v1.ResourceList, error) {
+	if len(s) == 0 {
+		return nil, nil
 	}
-	if cmd.Flag("eval").Changed == cmd.Flag("filename").Changed {
-		return fmt.Errorf(bpftraceDoubleErrString)
+	rl := v1.ResourceList{}
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf(i18n.T(resourceListErrString), s)
+		}
+		name := v1.ResourceName(strings.TrimSpace(parts[0]))
+		if name != v1.ResourceCPU && name != v1.ResourceMemory {
+			return nil, fmt.Errorf(i18n.T(resourceListErrString), s)
+		}
+		q, err := resource.ParseQuantity(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf(i18n.T(resourceListErrString), s)
+		}
+		rl[name] = q
 	}
-	if (cmd.Flag("eval").Changed && len(o.eval) == 0) || (cmd.Flag("filename").Changed && len(o.program) == 0) {
-		return fmt.Errorf(bpftraceEmptyErrString)
+	return rl, nil
+}
+
+// validateSecurityMode checks the flags requiring host access are not given to
+// restricted trace pods, which only have the restricted capabilities and BTF.
+func (o *RunOptions) validateSecurityMode(cmd *cobra.Command) error {
+	switch o.securityMode {
+	case securityModePrivileged:
+		return nil
+	case securityModeRestricted:
+	default:
+		return fmt.Errorf(i18n.T(securityModeErrString), o.securityMode, securityModePrivileged, securityModeRestricted)
 	}
 
+	// The flags of the targets are only known to run
+	for _, f := range []string{"unprivileged", "capabilities", "host-pid", "host-network", "fetch-headers", "headers-url", "unit"} {
+		if flag := cmd.Flag(f); flag != nil && flag.Changed {
+			return fmt.Errorf(i18n.T(restrictedErrString), o.securityMode, "--"+f)
+		}
+	}
+	if o.btf == btfDisabled {
+		return fmt.Errorf(i18n.T(restrictedErrString), o.securityMode, "--btf="+btfDisabled)
+	}
+	// Network tracers attach to the interfaces of the host network namespace
+	if tracejob.Tracer(o.tracer).IsNetwork() {
+		return fmt.Errorf(i18n.T(restrictedErrString), o.securityMode, "the "+o.tracer+" tracer")
+	}
+	o.btf = btfEnabled
+	o.capabilities = append([]string{}, restrictedCapabilities...)
+	if len(o.seccompProfile) == 0 {
+		o.seccompProfile = v1.SeccompProfileRuntimeDefault
+	}
 	return nil
 }
 
+// validateVolumes parses the volumes and their mounts, each mount must refer to a volume.
+func (o *RunOptions) validateVolumes() error {
+	names := map[string]bool{}
+	for _, n := range tracejob.ReservedVolumes {
+		names[n] = true
+	}
+
+	for _, arg := range o.volumeArgs {
+		vol, err := parseVolume(arg)
+		if err != nil {
+			return err
+		}
+		if names[vol.Name] {
+			return fmt.Errorf(i18n.T(volumeReservedErrString), vol.Name)
+		}
+		names[vol.Name] = true
+		o.volumes = append(o.volumes, vol)
+	}
+
+	for _, arg := range o.mountArgs {
+		parts := strings.Split(arg, ":")
+		if len(parts) < 2 || len(parts) > 3 || len(parts[0]) == 0 || !strings.HasPrefix(parts[1], "/") {
+			return fmt.Errorf(i18n.T(volumeMountErrString), arg)
+		}
+		if len(parts) == 3 && parts[2] != "ro" {
+			return fmt.Errorf(i18n.T(volumeMountErrString), arg)
+		}
+		if !names[parts[0]] {
+			return fmt.Errorf(i18n.T(volumeMountUnknownErrString), arg)
+		}
+		o.volumeMounts = append(o.volumeMounts, v1.VolumeMount{
+			Name:      parts[0],
+			MountPath: parts[1],
+			ReadOnly:  len(parts) == 3,
+		})
+	}
+	return nil
+}
+
+// parseVolume parses a volume like symbols:hostPath:/opt/symbols.
+func parseVolume(s string) (v1.Volume, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 || len(parts[0]) == 0 || len(parts[2]) == 0 {
+		return v1.Volume{}, fmt.Errorf(i18n.T(volumeErrString), s)
+	}
+
+	vol := v1.Volume{Name: parts[0]}
+	switch parts[1] {
+	case "hostPath":
+		vol.HostPath = &v1.HostPathVolumeSource{Path: parts[2]}
+	case "configMap":
+		vol.ConfigMap = &v1.ConfigMapVolumeSource{
+			LocalObjectReference: v1.LocalObjectReference{Name: parts[2]},
+		}
+	case "pvc":
+		vol.PersistentVolumeClaim = &v1.PersistentVolumeClaimVolumeSource{ClaimName: parts[2]}
+	default:
+		return vol, fmt.Errorf(i18n.T(volumeErrString), s)
+	}
+	return vol, nil
+}
+
+// validateProfile checks a seccomp or AppArmor profile is either a well known one or a localhost one.
+func validateProfile(kind, profile string, known ...string) error {
+	if len(profile) == 0 || strings.HasPrefix(profile, "localhost/") {
+		return nil
+	}
+	for _, k := range known {
+		if profile == k {
+			return nil
+		}
+	}
+	return fmt.Errorf(i18n.T(profileErrString), kind, profile, strings.Join(known, ", "))
+}
+
+// validateName prefixes the name of the traces and checks it fits the names of
+// their jobs, along with the start of their ID when they run on several nodes.
+func (o *RunOptions) validateName() error {
+	if len(o.name) == 0 {
+		return nil
+	}
+	name := strings.TrimPrefix(o.name, meta.ObjectNamePrefix)
+	if idRegexp.MatchString(name) {
+		return fmt.Errorf(i18n.T(nameIDErrString), o.name)
+	}
+	o.name = meta.ObjectNamePrefix + name
+
+	// The job names of cron jobs have a suffix of their own
+	max := validation.DNS1123LabelMaxLength
+	if len(o.schedule) > 0 {
+		max = maxCronJobNameLength
+	}
+	if o.allMatching {
+		max -= 1 + nameIDLength
+	}
+	if len(o.name) > max || len(validation.IsDNS1123Label(o.name)) > 0 {
+		return fmt.Errorf(i18n.T(nameErrString), name, max-len(meta.ObjectNamePrefix))
+	}
+	return nil
+}
+
+// parseMeta parses the labels, or the annotations, in the form key=value. The
+// keys of kubectl-trace are reserved.
+func parseMeta(kvs []string, errString string, label bool) (map[string]string, error) {
+	if len(kvs) == 0 {
+		return nil, nil
+	}
+	m := map[string]string{}
+	for _, kv := range kvs {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf(i18n.T(errString), kv, "missing =")
+		}
+		errs := validation.IsQualifiedName(parts[0])
+		if label {
+			errs = append(errs, validation.IsValidLabelValue(parts[1])...)
+		}
+		if len(errs) > 0 {
+			return nil, fmt.Errorf(i18n.T(errString), kv, strings.Join(errs, ", "))
+		}
+		if prefix := strings.SplitN(parts[0], "/", 2); len(prefix) == 2 && (prefix[0] == meta.ReservedKeyDomain || strings.HasSuffix(prefix[0], "."+meta.ReservedKeyDomain)) {
+			return nil, fmt.Errorf(i18n.T(metaReservedErrString), parts[0])
+		}
+		m[parts[0]] = parts[1]
+	}
+	return m, nil
+}
+
+// parseToleration parses a toleration like the taints of kubectl taint, key=value:NoSchedule.
+// Without a value any value of the key is tolerated, without an effect any effect is.
+func parseToleration(s string) (v1.Toleration, error) {
+	t := v1.Toleration{Operator: v1.TolerationOpExists}
+
+	kv := s
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		kv = s[:i]
+		t.Effect = v1.TaintEffect(s[i+1:])
+		switch t.Effect {
+		case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+		default:
+			return t, fmt.Errorf(i18n.T(tolerationErrString), s)
+		}
+	}
+
+	parts := strings.SplitN(kv, "=", 2)
+	t.Key = parts[0]
+	if len(t.Key) == 0 {
+		return t, fmt.Errorf(i18n.T(tolerationErrString), s)
+	}
+	if len(parts) == 2 {
+		t.Operator = v1.TolerationOpEqual
+		t.Value = parts[1]
+	}
+	return t, nil
+}
+
+func tracersString() string {
+	tracers := []string{}
+	for _, t := range tracejob.Tracers {
+		tracers = append(tracers, string(t))
+	}
+	return strings.Join(tracers, ", ")
+}
+
 // Complete completes the setup of the command.
 func (o *RunOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
 	// Prepare program
-	if len(o.program) > 0 {
-		b, err := ioutil.ReadFile(o.program)
-		if err != nil {
-			return fmt.Errorf("error opening program file")
-		}
-		o.program = string(b)
-	} else {
-		o.program = o.eval
+	if err := o.completeProgram(); err != nil {
+		return err
 	}
 
 	// Prepare namespace
@@ -157,6 +1073,125 @@ func (o *RunOptions) Complete(factory factory.Factory, cmd *cobra.Command, args
 		return err
 	}
 
+	if len(o.selector) > 0 {
+		if err := o.completeSelector(factory); err != nil {
+			return err
+		}
+	} else if err := o.completeResource(factory); err != nil {
+		return err
+	}
+	// The target is resolved, the trace goes to its own namespace if any
+	if len(o.traceNamespace) > 0 {
+		o.namespace = o.traceNamespace
+	}
+	if tracejob.Tracer(o.tracer).IsNetwork() && len(o.iface) == 0 && len(o.containerID) == 0 {
+		return fmt.Errorf(i18n.T(interfaceRequiredErrString), o.tracer)
+	}
+
+	// Prepare client
+	o.clientConfig, err = factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+	o.requestedBy = requestingUser(factory, cmd, o.clientConfig)
+
+	// OpenShift rejects the privileged trace pods of the default service account
+	if len(o.serviceAccount) == 0 && o.dryRun == dryRunNone {
+		if d, err := factory.ToDiscoveryClient(); err == nil {
+			if scc, _ := servesSCC(d); scc {
+				fmt.Fprintf(o.ErrOut, i18n.T(sccWarning), setup.DefaultName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// recordHistory records the run in the history, failed when err is not nil.
+func (o *RunOptions) recordHistory(err error) {
+	e := history.Entry{
+		Namespace:   o.namespace,
+		ProgramHash: history.ProgramHash(o.program),
+		TraceIDs:    o.traceIDs,
+	}
+	for _, n := range o.nodes {
+		e.Targets = append(e.Targets, n.hostname)
+	}
+	if len(o.targetPod) > 0 {
+		e.Targets = append(e.Targets, "pod/"+o.targetPod)
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	recordHistory(e)
+}
+
+// newGroupID provides a random ID grouping the traces of one invocation.
+func newGroupID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// requestingUser provides who requests the trace as known from the client
+// configuration: the impersonated user, the user name when authenticating with
+// one, otherwise the name of the kubeconfig user given by --user or by the
+// context, given by --context or the current one.
+func requestingUser(factory factory.Factory, cmd *cobra.Command, config *rest.Config) string {
+	if len(config.Impersonate.UserName) > 0 {
+		return config.Impersonate.UserName
+	}
+	if len(config.Username) > 0 {
+		return config.Username
+	}
+	if f := cmd.Flag("user"); f != nil && len(f.Value.String()) > 0 {
+		return f.Value.String()
+	}
+	raw, err := factory.ToRawKubeConfigLoader().RawConfig()
+	if err != nil {
+		return ""
+	}
+	contextName := raw.CurrentContext
+	if f := cmd.Flag("context"); f != nil && len(f.Value.String()) > 0 {
+		contextName = f.Value.String()
+	}
+	if ctx, ok := raw.Contexts[contextName]; ok {
+		return ctx.AuthInfo
+	}
+	return ""
+}
+
+// completeSelector resolves the nodes matching the selector, only the first one unless all are wanted.
+func (o *RunOptions) completeSelector(factory factory.Factory) error {
+	clientset, err := factory.KubernetesClientSet()
+	if err != nil {
+		return err
+	}
+	nl, err := clientset.CoreV1().Nodes().List(metav1.ListOptions{
+		LabelSelector: o.selector,
+	})
+	if err != nil {
+		return err
+	}
+	if len(nl.Items) == 0 {
+		return fmt.Errorf(i18n.T(selectorNoMatchErrString), o.selector)
+	}
+	if !o.allMatching {
+		nl.Items = nl.Items[:1]
+	}
+
+	for i := range nl.Items {
+		if err := o.addNode(&nl.Items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// completeResource resolves the node or the pod the trace runs on.
+func (o *RunOptions) completeResource(factory factory.Factory) error {
 	// Look for the target object
 	x := factory.
 		NewBuilder().
@@ -172,78 +1207,661 @@ func (o *RunOptions) Complete(factory factory.Factory, cmd *cobra.Command, args
 	}
 
 	// Check we got a pod or a node
-	// isPod := false
+	tracer := tracejob.Tracer(o.tracer)
 	switch v := obj.(type) {
 	case *v1.Pod:
-		// isPod = true
-		// if len(o.container) == 0 {
-		// todo > get the default container or the first one, see https://github.com/fntlnz/kubectl-trace/pull/1#issuecomment-441331255
-		// } else {
-		// todo > check the pod has the provided container (o.container)
-		// }
-		return fmt.Errorf("running bpftrace programs against pods is not supported yet, see: https://github.com/fntlnz/kubectl-trace/issues/3")
+		if tracer == tracejob.PerfTracer {
+			return fmt.Errorf(i18n.T(podTargetUnsupportedErrString), o.tracer)
+		}
+		if len(o.unit) > 0 {
+			return fmt.Errorf(i18n.T(unitPodErrString))
+		}
+		if err := o.completePod(factory, v); err != nil {
+			return err
+		}
 		break
 	case *v1.Node:
-		labels := v.GetLabels()
-		val, ok := labels["kubernetes.io/hostname"]
-		if !ok {
-			return fmt.Errorf("label kubernetes.io/hostname not found in node")
+		if tracer.TargetsProcess() {
+			return fmt.Errorf(i18n.T(podTargetRequiredErrString), o.tracer)
+		}
+		if err := o.addNode(v); err != nil {
+			return err
 		}
-		o.nodeName = val
 		break
 	default:
-		return fmt.Errorf("first argument must be %s", usageString)
+		return fmt.Errorf(i18n.T("first argument must be %s"), usageString)
 	}
 
-	// Prepare client
-	o.clientConfig, err = factory.ToRESTConfig()
+	return nil
+}
+
+// completeProgram reads the program from its file, if any, followed by the fragments of the eval flags.
+// The BPF objects of network tracers are read as is.
+func (o *RunOptions) completeProgram() error {
+	fragments := []string{}
+	if len(o.program) > 0 {
+		b, err := ioutil.ReadFile(o.program)
+		if err != nil {
+			return fmt.Errorf(i18n.T("error opening program file"))
+		}
+		if tracejob.Tracer(o.tracer).IsNetwork() {
+			o.program = string(b)
+			return nil
+		}
+		fragments = append(fragments, strings.TrimRight(string(b), "\n"))
+	}
+	o.program = strings.Join(append(fragments, o.eval...), "\n")
+	return nil
+}
+
+// completePod resolves the container to trace in the pod and the node the pod runs on.
+func (o *RunOptions) completePod(factory factory.Factory, pod *v1.Pod) error {
+	if len(o.container) == 0 {
+		// todo > use the default container annotation when present, see https://github.com/fntlnz/kubectl-trace/pull/1#issuecomment-441331255
+		o.container = pod.Spec.Containers[0].Name
+	}
+
+	found := false
+	for _, c := range pod.Spec.Containers {
+		if c.Name == o.container {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf(i18n.T(containerNotFoundErrString), o.container, pod.Name)
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == o.container && cs.State.Running != nil {
+			// Container IDs are in the <runtime>://<id> form
+			parts := strings.SplitN(cs.ContainerID, "://", 2)
+			o.containerID = parts[len(parts)-1]
+		}
+	}
+	if len(o.containerID) == 0 {
+		return fmt.Errorf(i18n.T(containerNotRunningErrString), o.container, pod.Name)
+	}
+	// Only the host PID namespace shows the processes of the container
+	if o.securityMode == securityModeRestricted {
+		return fmt.Errorf(i18n.T(restrictedErrString), o.securityMode, "container targets")
+	}
+
+	if len(pod.Spec.NodeName) == 0 {
+		return fmt.Errorf(i18n.T(podNotScheduledErrString), pod.Name)
+	}
+	o.targetPod = pod.Name
+	clientset, err := factory.KubernetesClientSet()
+	if err != nil {
+		return err
+	}
+	node, err := clientset.CoreV1().Nodes().Get(pod.Spec.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	return o.addNode(node)
+}
+
+// traceNode is a node to run the trace on, with what the trace job depends on.
+type traceNode struct {
+	hostname string
+	btf      bool
+	// headersURL is where the kernel headers of the node can be downloaded from, if known.
+	headersURL string
+	// seLinuxType is the SELinux type required by the node for tracing, if any.
+	seLinuxType string
+	// arch is the architecture of the node, like amd64.
+	arch string
+}
+
+// addNode adds a node to run the trace on.
+func (o *RunOptions) addNode(node *v1.Node) error {
+	hostname, err := nodeHostname(node)
 	if err != nil {
 		return err
 	}
 
+	labels := node.GetLabels()
+	if reason := o.nodePolicy.Check(node.Name, labels); len(reason) > 0 {
+		if !o.force {
+			return fmt.Errorf(i18n.T(nodePolicyErrString), node.Name, reason)
+		}
+		fmt.Fprintf(o.ErrOut, i18n.T(nodeForcedWarning), node.Name, reason)
+	}
+	n := traceNode{
+		hostname: hostname,
+		arch:     labels[meta.ArchLabelKey],
+	}
+	if len(n.arch) == 0 {
+		n.arch = node.Status.NodeInfo.Architecture
+	}
+	switch o.btf {
+	case btfAuto:
+		n.btf = labels[meta.BTFLabelKey] == "true" || labels[meta.NFDBTFLabelKey] == "true"
+	case btfEnabled:
+		n.btf = true
+	}
+
+	// Some distributions need adjustments, like the headers they don't ship on their nodes
+	info := node.Status.NodeInfo
+	switch {
+	case strings.HasPrefix(info.OSImage, cosOSImagePrefix):
+		if !n.btf {
+			n.headersURL = cosHeadersURL
+		}
+	case strings.HasPrefix(info.OSImage, bottlerocketOSImagePrefix):
+		// Bottlerocket kernels have BTF and its SELinux policy confines containers
+		n.btf = o.btf != btfDisabled
+		n.seLinuxType = bottlerocketSELinuxType
+	case strings.HasPrefix(info.OSImage, amazonLinuxOSImagePrefix):
+		// Amazon Linux kernels have BTF from 5.10, older nodes need kernel-devel installed
+		if o.btf == btfAuto && kernelAtLeast(info.KernelVersion, 5, 10) {
+			n.btf = true
+		}
+	}
+
+	glog.V(2).Infof("tracing node %s: arch %q, btf %t, image %s, kernel %s", n.hostname, n.arch, n.btf, info.OSImage, info.KernelVersion)
+	o.nodes = append(o.nodes, n)
 	return nil
 }
 
+// kernelAtLeast tells whether a kernel version like 5.10.118-111.515.amzn2.x86_64 is at least major.minor.
+func kernelAtLeast(version string, major, minor int) bool {
+	var vmajor, vminor int
+	if _, err := fmt.Sscanf(version, "%d.%d", &vmajor, &vminor); err != nil {
+		return false
+	}
+	return vmajor > major || (vmajor == major && vminor >= minor)
+}
+
+func nodeHostname(node *v1.Node) (string, error) {
+	val, ok := node.GetLabels()["kubernetes.io/hostname"]
+	if !ok {
+		return "", fmt.Errorf(i18n.T("label kubernetes.io/hostname not found in node"))
+	}
+	return val, nil
+}
+
 // Run executes the run command.
 func (o *RunOptions) Run() error {
-	juid := uuid.NewUUID()
-	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	// The traces of one invocation are managed as one unit through their group
+	group, err := newGroupID()
 	if err != nil {
 		return err
 	}
+	tjs := []tracejob.TraceJob{}
+	for _, n := range o.nodes {
+		tj := o.traceJob(n)
+		tj.Group = group
+		tjs = append(tjs, tj)
+	}
+
+	if o.dryRun == dryRunClient {
+		if o.check {
+			if err := o.checkLocally(); err != nil {
+				return err
+			}
+		}
+		if len(o.traceOutput) > 0 {
+			for _, tj := range tjs {
+				o.printTrace(tj)
+			}
+			return nil
+		}
+		objs := []runtime.Object{}
+		for _, tj := range tjs {
+			tobjs, err := o.objects(tj)
+			if err != nil {
+				return err
+			}
+			objs = append(objs, tobjs...)
+		}
+		return o.printObjects(objs)
+	}
 
-	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	c, err := client.New(o.clientConfig)
 	if err != nil {
 		return err
 	}
+	tc := c.TraceJobClient(o.namespace)
 
-	tc := &tracejob.TraceJobClient{
-		JobClient:    jobsClient.Jobs(o.namespace),
-		ConfigClient: coreClient.ConfigMaps(o.namespace),
+	ctx := context.Background()
+	if o.check {
+		if err := o.checkProgram(ctx, tc, c.CoreV1(), o.nodes[0]); err != nil {
+			return err
+		}
 	}
 
-	tj := tracejob.TraceJob{
-		Name:      fmt.Sprintf("%s%s", meta.ObjectNamePrefix, string(juid)),
-		Namespace: o.namespace,
-		ID:        juid,
-		Hostname:  o.nodeName,
-		Program:   o.program,
+	objs := []runtime.Object{}
+	starting := []string{}
+	for _, tj := range tjs {
+		// Scheduled traces start later, on their own
+		if o.maxConcurrent > 0 && len(starting) == o.maxConcurrent && len(o.schedule) == 0 {
+			if err := waitStarted(ctx, c.CoreV1(), o.namespace, starting); err != nil {
+				return err
+			}
+			starting = starting[:0]
+		}
+		tobjs, action, err := o.create(ctx, tc, tj)
+		if err != nil {
+			return err
+		}
+		starting = append(starting, string(tj.ID))
+		o.traceIDs = append(o.traceIDs, string(tj.ID))
+		switch {
+		case len(o.traceOutput) > 0:
+			o.printTrace(tj)
+		case len(o.output) > 0:
+			objs = append(objs, tobjs...)
+		default:
+			fmt.Fprintf(o.IOStreams.Out, "trace %s %s\n", tj.ID, action)
+		}
+	}
+	if len(o.output) > 0 {
+		if err := o.printObjects(objs); err != nil {
+			return err
+		}
+	} else if len(tjs) > 1 && len(o.traceOutput) == 0 {
+		fmt.Fprintf(o.IOStreams.Out, "trace group %s\n", group)
 	}
 
-	job, err := tc.CreateJob(tj)
+	if !o.attach && !o.wait {
+		return nil
+	}
+	ctx = signals.WithStandardSignals(ctx)
+	waitFunc := func(ctx context.Context) ([]tracejob.TraceJob, error) {
+		return o.waitGroup(ctx, c, group, len(tjs))
+	}
+
+	// The output of traces on multiple nodes is interleaved, prefixed by node
+	var attachFunc func(context.Context) error
+	if o.attach {
+		a := c.NewAttacher(o.IOStreams)
+		if !colored(o.Out) {
+			a.WithoutColor()
+		}
+		closeOutputs, err := attachOutputs(a, o.outputFile, o.recordFile)
+		if err != nil {
+			return err
+		}
+		defer closeOutputs()
+		if o.outFormat == tracejob.OutputFormatJSON {
+			a.WithJSONEvents()
+		}
+		if len(o.render) > 0 {
+			a.WithRender(o.render)
+		}
+		if o.maxConcurrent > 0 {
+			a.WithMaxConcurrent(o.maxConcurrent)
+		}
+		attachFunc = func(ctx context.Context) error {
+			return c.Attach(ctx, a, tjs)
+		}
+	}
+
+	// A trace pod that cannot run never ends, there is nothing to wait for
+	w, err := attachWaiting(ctx, waitFunc, attachFunc)
 	if err != nil {
 		return err
 	}
+	// Interrupting the attachment detaches from the traces, which go on, and
+	// the attachment does not depend on telling their end
+	if w.err != nil && !o.wait {
+		glog.V(1).Infof("the end of the traces cannot be told: %v", w.err)
+		return nil
+	}
+	if w.err != nil && ctx.Err() != nil {
+		return fmt.Errorf(i18n.T(waitInterruptedErrString))
+	}
+	if w.err != nil {
+		return w.err
+	}
+	// The end of the traces does not mix with their output, nor with what scripts read
+	out := o.Out
+	if o.attach || len(o.output) > 0 || len(o.traceOutput) > 0 {
+		out = o.ErrOut
+	}
+	o.exitCode = printEnded(out, w.tjs)
+	return nil
+}
+
+// waited is the end of the traces waited for.
+type waited struct {
+	tjs []tracejob.TraceJob
+	err error
+}
 
-	fmt.Fprintf(o.IOStreams.Out, "trace %s created\n", tj.ID)
+// attachWaiting waits for the traces to end while attached to them with attach,
+// if any. The attachment ends once they ended, left attachDrainPeriod to print
+// their last lines, and goes on until ctx is done when they cannot be waited for.
+func attachWaiting(ctx context.Context, wait func(context.Context) ([]tracejob.TraceJob, error), attach func(context.Context) error) (waited, error) {
+	attachCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ended := make(chan waited, 1)
+	go func() {
+		tjs, err := wait(ctx)
+		ended <- waited{tjs: tjs, err: err}
+		if err == nil {
+			time.AfterFunc(attachDrainPeriod, cancel)
+		}
+	}()
 
-	if o.attach {
-		ctx := context.Background()
-		ctx = signals.WithStandardSignals(ctx)
-		a := attacher.NewAttacher(coreClient, o.clientConfig, o.IOStreams)
-		a.WithContext(ctx)
-		a.AttachJob(tj.ID, job.Namespace)
+	if attach != nil {
+		if err := attach(attachCtx); err != nil {
+			return waited{}, err
+		}
+	}
+	return <-ended, nil
+}
+
+// waitGroup waits for the n traces of the group to end. The jobs of declared
+// traces are created by the controller, they are waited for to exist first.
+func (o *RunOptions) waitGroup(ctx context.Context, c *client.Client, group string, n int) ([]tracejob.TraceJob, error) {
+	filter := tracejob.TraceJobFilter{Group: group}
+	if o.crd {
+		tc := c.TraceJobClient(o.namespace)
+		err := wait.PollImmediateUntil(time.Second, func() (bool, error) {
+			tjs, err := tc.GetJob(ctx, filter)
+			return len(tjs) >= n, err
+		}, ctx.Done())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.Wait(ctx, o.namespace, filter)
+}
+
+// waitStarted waits for the pods of the traces to start, that is to be past
+// pulling their image, for at most maxConcurrentWait.
+func waitStarted(ctx context.Context, coreClient corev1client.CoreV1Interface, namespace string, ids []string) error {
+	selector := fmt.Sprintf("%s in (%s)", meta.TraceIDLabelKey, strings.Join(ids, ","))
+	err := wait.PollImmediate(time.Second, maxConcurrentWait, func() (bool, error) {
+		pods, err := coreClient.Pods(namespace).List(metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return false, err
+		}
+		started := map[string]bool{}
+		for _, p := range pods.Items {
+			if p.Status.Phase != v1.PodPending || len(tracejob.PodFailureReason(p)) > 0 {
+				started[p.Labels[meta.TraceIDLabelKey]] = true
+			}
+		}
+		return len(started) == len(ids), nil
+	})
+	if err == wait.ErrWaitTimeout {
+		glog.V(1).Infof("traces %s not started after %s, starting the next ones", strings.Join(ids, ", "), maxConcurrentWait)
+		return nil
+	}
+	return err
+}
+
+// validateRender validates the mode the histograms are rendered in.
+func validateRender(mode string) error {
+	for _, m := range histogram.Modes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf(i18n.T(renderErrString), mode, strings.Join(histogram.Modes, ", "))
+}
+
+// checkJob provides the trace job checking the program on the node. It is named
+// after its ID, so that it does not hold the name given to the trace while being
+// deleted.
+func (o *RunOptions) checkJob(n traceNode) tracejob.TraceJob {
+	tj := o.traceJob(n)
+	tj.Name = fmt.Sprintf("%s%s", meta.ObjectNamePrefix, string(tj.ID))
+	tj.Check = true
+	tj.Duration = metav1.Duration{}
+	tj.Schedule = ""
+	return tj
+}
+
+// checkProgram checks the program can be parsed, with the local bpftrace when available
+// or else with a check job on the node.
+func (o *RunOptions) checkProgram(ctx context.Context, tc *tracejob.TraceJobClient, coreClient corev1client.CoreV1Interface, n traceNode) error {
+	if _, err := exec.LookPath("bpftrace"); err == nil {
+		return o.checkLocally()
+	}
+
+	tj := o.checkJob(n)
+	if _, err := tc.Create(ctx, tj); err != nil {
+		return err
+	}
+	defer func() {
+		tc.WithOutStream(ioutil.Discard)
+		tc.DeleteJobs(ctx, tracejob.TraceJobFilter{ID: &tj.ID})
+	}()
+
+	var job *batchv1.Job
+	err := wait.PollImmediate(checkJobPollInterval, checkJobTimeout, func() (bool, error) {
+		var err error
+		job, err = tc.JobClient.Get(tj.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return job.Status.Succeeded > 0 || job.Status.Failed > 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf(i18n.T(checkTimeoutErrString))
+	}
+	if err != nil {
+		return err
+	}
+	if job.Status.Succeeded > 0 {
+		return nil
 	}
 
+	pl, err := coreClient.Pods(tj.Namespace).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, tj.ID),
+	})
+	if err != nil {
+		return err
+	}
+	if len(pl.Items) == 0 {
+		return fmt.Errorf(i18n.T(checkFailedErrString), "no output")
+	}
+	b, err := coreClient.Pods(tj.Namespace).GetLogs(pl.Items[0].Name, &v1.PodLogOptions{}).Do().Raw()
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf(i18n.T(checkFailedErrString), strings.TrimSpace(string(b)))
+}
+
+// checkLocally checks the program can be parsed by the local bpftrace, the templates
+// are rendered with an empty trace context.
+func (o *RunOptions) checkLocally() error {
+	if _, err := exec.LookPath("bpftrace"); err != nil {
+		return fmt.Errorf(i18n.T(checkLocalErrString))
+	}
+
+	f, err := ioutil.TempFile("", "kubectl-trace-check")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := renderTemplate(o.program, ProgramContext{}, f); err != nil {
+		return err
+	}
+
+	c := exec.Command("bpftrace", "-d", f.Name())
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf(i18n.T(checkFailedErrString), lastLines(string(out), 10))
+	}
 	return nil
 }
+
+// lastLines provides the last n lines of s, where errors are reported.
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// create creates the trace job, or declares it, and provides the created objects
+// along with the action performed.
+func (o *RunOptions) create(ctx context.Context, tc *tracejob.TraceJobClient, tj tracejob.TraceJob) ([]runtime.Object, string, error) {
+	if o.crd {
+		u, err := o.createResource(tj)
+		if err != nil {
+			return nil, "", err
+		}
+		return []runtime.Object{u}, "declared", nil
+	}
+
+	glog.V(1).Infof("creating trace %s on node %s with image %s", tj.ID, tj.Hostname, tj.ImageNameTag)
+	objs, err := tc.Create(ctx, tj)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(tj.Schedule) > 0 {
+		return objs, "scheduled", nil
+	}
+	return objs, "created", nil
+}
+
+// traceJob provides the trace job described by the options for a node, with a new trace ID.
+func (o *RunOptions) traceJob(n traceNode) tracejob.TraceJob {
+	juid := uuid.NewUUID()
+	name := fmt.Sprintf("%s%s", meta.ObjectNamePrefix, string(juid))
+	if len(o.name) > 0 {
+		name = o.name
+		if len(o.nodes) > 1 {
+			name = fmt.Sprintf("%s-%s", o.name, string(juid)[:nameIDLength])
+		}
+	}
+	tj := tracejob.TraceJob{
+		Name:        name,
+		Namespace:   o.namespace,
+		ID:          juid,
+		Hostname:    n.hostname,
+		Program:     o.program,
+		Args:        o.args,
+		Tracer:      tracejob.Tracer(o.tracer),
+		Duration:    metav1.Duration{Duration: o.duration},
+		ContainerID: o.containerID,
+		TargetPod:   o.targetPod,
+		Schedule:    o.schedule,
+		TTL:         &metav1.Duration{Duration: o.ttl},
+
+		BackoffLimit:  &o.backoffLimit,
+		RestartPolicy: v1.RestartPolicy(o.restartPolicy),
+		Memlock:       o.memlock,
+
+		ImageNameTag:      o.imageName,
+		ImagePullPolicy:   v1.PullPolicy(o.imagePullPolicy),
+		ImagePullSecrets:  o.pullSecrets,
+		Resources:         o.resources,
+		ServiceAccount:    o.serviceAccount,
+		Tolerations:       o.tolerations,
+		SeccompProfile:    o.seccompProfile,
+		AppArmorProfile:   o.appArmorProfile,
+		PriorityClassName: o.priorityClass,
+		HostPID:           o.hostPID,
+		HostNetwork:       o.hostNetwork,
+		Restricted:        o.securityMode == securityModeRestricted,
+		Volumes:           o.volumes,
+		VolumeMounts:      o.volumeMounts,
+		Env:               o.env,
+		Labels:            o.labels,
+		Annotations:       o.annotations,
+		Overrides:         o.overrides,
+		BTF:               n.btf,
+		FetchHeaders:      o.fetchHeaders || len(n.headersURL) > 0,
+		HeadersURL:        o.headersURL,
+	}
+	if o.outFormat == tracejob.OutputFormatJSON {
+		tj.OutputFormat = o.outFormat
+	}
+	tj.MetricsPort = o.metricsPort
+	tj.ResultsClaim = o.resultsClaim
+	tj.UploadURL = o.uploadURL
+	tj.UploadSecret = o.uploadSecret
+	tj.ProgramSecret = o.programSecret
+	tj.RequestedBy = o.requestedBy
+	tj.NotifyURL = o.notifyURL
+	tj.Unit = o.unit
+	tj.Interface = o.iface
+	tj.Direction = o.direction
+	tj.Section = o.section
+	// The profilers of interpreters already target the container process
+	tj.CgroupFilter = o.cgroupFilter && len(o.containerID)+len(o.unit) > 0 && tj.Tracer == tracejob.BpftraceTracer
+	if len(tj.HeadersURL) == 0 {
+		tj.HeadersURL = n.headersURL
+	}
+	if !o.imageNameSet {
+		tj.ImageNameTag = meta.ImageNameTagForBpftrace(o.bpftraceVersion, n.arch)
+	}
+	tj.SELinuxType = o.seLinuxType
+	if len(tj.SELinuxType) == 0 {
+		tj.SELinuxType = n.seLinuxType
+	}
+	for _, c := range o.capabilities {
+		tj.Capabilities = append(tj.Capabilities, v1.Capability(c))
+	}
+	if o.runAsUserSet {
+		uid := o.runAsUser
+		tj.RunAsUser = &uid
+	}
+	return tj
+}
+
+// objects provides the objects that would be created for the trace job.
+func (o *RunOptions) objects(tj tracejob.TraceJob) ([]runtime.Object, error) {
+	if o.crd {
+		u, err := tj.ToUnstructured()
+		if err != nil {
+			return nil, err
+		}
+		return []runtime.Object{u}, nil
+	}
+	return tracejob.Objects(tj)
+}
+
+// printTrace prints the ID or the job name of the trace, alone on its line.
+func (o *RunOptions) printTrace(tj tracejob.TraceJob) {
+	if o.traceOutput == outputName {
+		fmt.Fprintln(o.Out, tj.Name)
+		return
+	}
+	fmt.Fprintln(o.Out, tj.ID)
+}
+
+// printObjects prints the objects of the trace job in the output format, YAML by default.
+func (o *RunOptions) printObjects(objs []runtime.Object) error {
+	var p printers.ResourcePrinter = &printers.YAMLPrinter{}
+	if o.output == outputJSON {
+		p = &printers.JSONPrinter{}
+	}
+	// Objects returned by the typed clients have no type information
+	p = printers.NewTypeSetter(scheme.Scheme).ToPrinter(p)
+
+	for i, obj := range objs {
+		if i > 0 && o.output != outputJSON {
+			fmt.Fprintln(o.Out, "---")
+		}
+		if err := p.PrintObj(obj, o.Out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createResource declares the trace as a TraceJob resource, the controller creates the trace job for it.
+func (o *RunOptions) createResource(tj tracejob.TraceJob) (*unstructured.Unstructured, error) {
+	client, err := dynamic.NewForConfig(o.clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := tj.ToUnstructured()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Resource(tracejob.TraceJobResource).Namespace(tj.Namespace).Create(u, metav1.CreateOptions{})
+}
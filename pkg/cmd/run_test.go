@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestCheckJobName(t *testing.T) {
+	o := NewRunOptions(genericclioptions.NewTestIOStreamsDiscard())
+	o.name = "checkout-latency"
+	o.check = true
+	o.program = "BEGIN { exit(); }"
+	o.nodes = []traceNode{{hostname: "n1"}}
+	if err := o.validateName(); err != nil {
+		t.Fatal(err)
+	}
+
+	tj := o.traceJob(o.nodes[0])
+	if tj.Name != "kubectl-trace-checkout-latency" {
+		t.Errorf("got trace %s, want kubectl-trace-checkout-latency", tj.Name)
+	}
+	check := o.checkJob(o.nodes[0])
+	if check.Name == tj.Name {
+		t.Errorf("the check job has the name of the trace %s", tj.Name)
+	}
+	if check.Name != meta.ObjectNamePrefix+string(check.ID) {
+		t.Errorf("got check job %s, want it named after its ID %s", check.Name, check.ID)
+	}
+	if !check.Check {
+		t.Error("the check job does not check the program")
+	}
+}
+
+func TestAttachWaiting(t *testing.T) {
+	defer func(d time.Duration) { attachDrainPeriod = d }(attachDrainPeriod)
+	attachDrainPeriod = 10 * time.Millisecond
+
+	tests := []struct {
+		name     string
+		waitErr  error
+		detached bool
+	}{
+		{name: "traces ended", detached: true},
+		{name: "traces cannot be waited for", waitErr: fmt.Errorf("no trace found")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*attachDrainPeriod)
+			defer cancel()
+			wait := func(context.Context) ([]tracejob.TraceJob, error) {
+				return nil, tt.waitErr
+			}
+			detached := false
+			attach := func(attachCtx context.Context) error {
+				<-attachCtx.Done()
+				// Only the end of the traces ends the attachment before ctx
+				detached = ctx.Err() == nil
+				return nil
+			}
+
+			w, err := attachWaiting(ctx, wait, attach)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w.err != tt.waitErr {
+				t.Errorf("got wait error %v, want %v", w.err, tt.waitErr)
+			}
+			if detached != tt.detached {
+				t.Errorf("got detached %t, want %t", detached, tt.detached)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/setup"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/spf13/cobra"
+	apiv1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericclioptions/printers"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+var (
+	setupShort = `Create the service account and the policies the trace pods need`
+	setupLong  = setupShort + `
+
+The trace pods are privileged, in the host PID namespace and mount host paths. The
+setup creates their service account in the namespace, and when the cluster enforces
+pod security policies, a privileged policy along with the cluster role and binding
+granting its use to the service account. On OpenShift, it creates privileged security
+context constraints for the service account. The traces are then run with --serviceaccount.`
+
+	setupExamples = `
+  # Review what would be created
+  %[1]s trace setup -n tracing --dry-run
+
+  # Create it and run the traces with it
+  %[1]s trace setup -n tracing
+  %[1]s trace run -n tracing --serviceaccount kubectl-trace node/ip-180-12-0-152.ec2.internal -f read.bt`
+
+	setupPSPErrString = "unknown --pod-security-policy %q, must be one of: %s, %s, %s"
+	setupSCCErrString = "unknown --security-context-constraints %q, must be one of: %s, %s, %s"
+
+	// sccWarning tells how to run the trace pods on OpenShift, which rejects them
+	// for the default service account
+	sccWarning = "warning: OpenShift rejects privileged pods unless their service account is allowed by security context constraints, create one with kubectl trace setup and run the trace with --serviceaccount %s\n"
+)
+
+const (
+	pspAuto     = "auto"
+	pspEnabled  = "true"
+	pspDisabled = "false"
+)
+
+// SetupOptions ...
+type SetupOptions struct {
+	genericclioptions.IOStreams
+	name              string
+	namespace         string
+	dryRun            string
+	output            string
+	podSecurityPolicy string
+	scc               string
+
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface
+	discovery discovery.DiscoveryInterface
+}
+
+// NewSetupOptions provides an instance of SetupOptions with default values.
+func NewSetupOptions(streams genericclioptions.IOStreams) *SetupOptions {
+	return &SetupOptions{
+		IOStreams:         streams,
+		name:              setup.DefaultName,
+		dryRun:            dryRunNone,
+		output:            outputYAML,
+		podSecurityPolicy: pspAuto,
+		scc:               pspAuto,
+	}
+}
+
+// NewSetupCommand provides the setup command wrapping SetupOptions.
+func NewSetupCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewSetupOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "setup [--dry-run]",
+		Short:        i18n.T(setupShort),
+		Long:         templates.LongDesc(i18n.T(setupLong)),
+		Example:      templates.Examples(fmt.Sprintf(i18n.T(setupExamples), "kubectl")),
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&o.name, "name", o.name, "Name of the service account, and of the cluster wide objects")
+	cmd.Flags().StringVar(&o.dryRun, "dry-run", o.dryRun, fmt.Sprintf("Must be %q or %q, with %q the objects that would be created are only printed", dryRunNone, dryRunClient, dryRunClient))
+	cmd.Flags().Lookup("dry-run").NoOptDefVal = dryRunClient
+	cmd.Flags().StringVarP(&o.output, "output", "o", o.output, fmt.Sprintf("Format of the objects printed with --dry-run, one of: %s, %s", outputJSON, outputYAML))
+	cmd.Flags().StringVar(&o.podSecurityPolicy, "pod-security-policy", o.podSecurityPolicy, fmt.Sprintf("Whether to create a pod security policy, one of: %s, %s, %s. With %s it is created when the cluster serves them", pspAuto, pspEnabled, pspDisabled, pspAuto))
+	cmd.Flags().StringVar(&o.scc, "security-context-constraints", o.scc, fmt.Sprintf("Whether to create OpenShift security context constraints, one of: %s, %s, %s. With %s they are created on OpenShift", pspAuto, pspEnabled, pspDisabled, pspAuto))
+
+	return cmd
+}
+
+// Validate validates the flags populating SetupOptions accordingly.
+func (o *SetupOptions) Validate(cmd *cobra.Command, args []string) error {
+	if o.dryRun != dryRunNone && o.dryRun != dryRunClient {
+		return fmt.Errorf(i18n.T(dryRunUnknownErrString), o.dryRun, dryRunNone, dryRunClient)
+	}
+	if o.output != outputJSON && o.output != outputYAML {
+		return fmt.Errorf(i18n.T(outputUnknownErrString), o.output, outputJSON, outputYAML)
+	}
+	if o.podSecurityPolicy != pspAuto && o.podSecurityPolicy != pspEnabled && o.podSecurityPolicy != pspDisabled {
+		return fmt.Errorf(i18n.T(setupPSPErrString), o.podSecurityPolicy, pspAuto, pspEnabled, pspDisabled)
+	}
+	if o.scc != pspAuto && o.scc != pspEnabled && o.scc != pspDisabled {
+		return fmt.Errorf(i18n.T(setupSCCErrString), o.scc, pspAuto, pspEnabled, pspDisabled)
+	}
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *SetupOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	// The dry run doesn't need the cluster, unless it is asked what it enforces
+	if o.dryRun == dryRunClient && o.podSecurityPolicy != pspAuto && o.scc != pspAuto {
+		return nil
+	}
+	o.discovery, err = factory.ToDiscoveryClient()
+	if err != nil {
+		return err
+	}
+	o.dynamic, err = factory.DynamicClient()
+	if err != nil {
+		return err
+	}
+	o.clientset, err = factory.KubernetesClientSet()
+	return err
+}
+
+// Run creates the objects of the setup, or prints them with --dry-run.
+func (o *SetupOptions) Run() error {
+	psp := o.podSecurityPolicy == pspEnabled
+	if o.podSecurityPolicy == pspAuto {
+		var err error
+		psp, err = serves(o.discovery, policyv1beta1.SchemeGroupVersion.String(), "podsecuritypolicies")
+		if err != nil {
+			return err
+		}
+	}
+	scc := o.scc == pspEnabled
+	if o.scc == pspAuto {
+		var err error
+		scc, err = servesSCC(o.discovery)
+		if err != nil {
+			return err
+		}
+	}
+	objs := setup.Objects(setup.Options{
+		Name:                       o.name,
+		Namespace:                  o.namespace,
+		PodSecurityPolicy:          psp,
+		SecurityContextConstraints: scc,
+	})
+
+	if o.dryRun == dryRunClient {
+		return o.printObjects(objs)
+	}
+	for _, obj := range objs {
+		kind, err := o.create(obj)
+		if errors.IsAlreadyExists(err) {
+			fmt.Fprintf(o.Out, "%s/%s already exists\n", kind, o.name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(o.Out, "%s/%s created\n", kind, o.name)
+	}
+	fmt.Fprintf(o.Out, "run the traces with: --namespace %s --serviceaccount %s\n", o.namespace, o.name)
+	return nil
+}
+
+// create creates an object of the setup, providing its kind.
+func (o *SetupOptions) create(obj runtime.Object) (string, error) {
+	var err error
+	switch obj := obj.(type) {
+	case *apiv1.ServiceAccount:
+		_, err = o.clientset.CoreV1().ServiceAccounts(obj.Namespace).Create(obj)
+		return "serviceaccount", err
+	case *policyv1beta1.PodSecurityPolicy:
+		_, err = o.clientset.PolicyV1beta1().PodSecurityPolicies().Create(obj)
+		return "podsecuritypolicy", err
+	case *rbacv1.ClusterRole:
+		_, err = o.clientset.RbacV1().ClusterRoles().Create(obj)
+		return "clusterrole", err
+	case *rbacv1.ClusterRoleBinding:
+		_, err = o.clientset.RbacV1().ClusterRoleBindings().Create(obj)
+		return "clusterrolebinding", err
+	case *unstructured.Unstructured:
+		_, err = o.dynamic.Resource(setup.SecurityContextConstraintsResource).Create(obj, metav1.CreateOptions{})
+		return "securitycontextconstraints", err
+	}
+	return "", fmt.Errorf(i18n.T("unexpected setup object %T"), obj)
+}
+
+func (o *SetupOptions) printObjects(objs []runtime.Object) error {
+	var p printers.ResourcePrinter = &printers.YAMLPrinter{}
+	if o.output == outputJSON {
+		p = &printers.JSONPrinter{}
+	}
+	p = printers.NewTypeSetter(scheme.Scheme).ToPrinter(p)
+
+	for i, obj := range objs {
+		if i > 0 && o.output != outputJSON {
+			fmt.Fprintln(o.Out, "---")
+		}
+		if err := p.PrintObj(obj, o.Out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// servesSCC tells whether the cluster is OpenShift, enforcing security context constraints.
+func servesSCC(d discovery.DiscoveryInterface) (bool, error) {
+	r := setup.SecurityContextConstraintsResource
+	return serves(d, r.GroupVersion().String(), r.Resource)
+}
+
+// serves tells whether the cluster serves the resource of the group version.
+func serves(d discovery.DiscoveryInterface, groupVersion, resource string) (bool, error) {
+	rl, err := d.ServerResourcesForGroupVersion(groupVersion)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, r := range rl.APIResources {
+		if r.Name == resource {
+			return true, nil
+		}
+	}
+	return false, nil
+}
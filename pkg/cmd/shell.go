@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fntlnz/kubectl-trace/pkg/client"
+	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/kubernetes/pkg/kubectl/util/term"
+)
+
+var (
+	shellShort = `Open a shell in the pod of a running trace`
+	shellLong  = shellShort + `
+
+The shell runs in the tracer container, along with the program in /programs and
+the kernel headers in /kheaders when fetched, to run bpftrace by hand when the
+trace isn't behaving.`
+
+	shellExamples = `
+  # Open a shell in the pod of a trace
+  %[1]s trace shell 656ee75a
+
+  # Run a command in the pod of a trace
+  %[1]s trace shell 656ee75a -- bpftrace -l 'tracepoint:syscalls:*'`
+
+	shellArgErrString = "(TRACE_ID | TRACE_NAME) is a required argument for the shell command"
+)
+
+// defaultShellCommand is the shell run without command, the tracer images have it.
+var defaultShellCommand = []string{"/bin/sh"}
+
+// ShellOptions ...
+type ShellOptions struct {
+	genericclioptions.IOStreams
+	traceID      *types.UID
+	traceName    *string
+	command      []string
+	namespace    string
+	clientConfig *rest.Config
+}
+
+// NewShellOptions provides an instance of ShellOptions with default values.
+func NewShellOptions(streams genericclioptions.IOStreams) *ShellOptions {
+	return &ShellOptions{
+		IOStreams: streams,
+		command:   defaultShellCommand,
+	}
+}
+
+// NewShellCommand provides the shell command wrapping ShellOptions.
+func NewShellCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewShellOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "shell (TRACE_ID | TRACE_NAME) [-- COMMAND [args...]]",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T(shellShort),
+		Long:                  templates.LongDesc(i18n.T(shellLong)),
+		Example:               templates.Examples(fmt.Sprintf(i18n.T(shellExamples), "kubectl")),
+		SilenceUsage:          true,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// Validate validates the arguments populating ShellOptions accordingly.
+func (o *ShellOptions) Validate(cmd *cobra.Command, args []string) error {
+	traceArgs := args
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		traceArgs = args[:dash]
+		if len(args) > dash {
+			o.command = args[dash:]
+		}
+	}
+	if len(traceArgs) != 1 {
+		return fmt.Errorf(i18n.T(shellArgErrString))
+	}
+	o.traceName, o.traceID = parseTraceArg(traceArgs[0])
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *ShellOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.clientConfig, err = factory.ToRESTConfig()
+	return err
+}
+
+// Run runs the shell in the tracer container of the running pod of the trace.
+func (o *ShellOptions) Run() error {
+	c, err := client.New(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tjs, err := c.Get(context.Background(), o.namespace, tracejob.TraceJobFilter{
+		Name: o.traceName,
+		ID:   o.traceID,
+	})
+	if err != nil {
+		return err
+	}
+	if len(tjs) == 0 {
+		return fmt.Errorf(i18n.T(traceNotFoundErr))
+	}
+	tj := tjs[0]
+
+	pl, err := c.CoreV1().Pods(tj.Namespace).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, tj.ID),
+		FieldSelector: "status.phase=" + string(v1.PodRunning),
+	})
+	if err != nil {
+		return err
+	}
+	pod := latestPod(pl.Items)
+	if pod == nil {
+		return fmt.Errorf(i18n.T(noRunningPodErrString))
+	}
+
+	req := c.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(pod.Namespace).
+		SubResource("exec")
+
+	// The shell is interactive on a terminal, input is forwarded otherwise
+	t := term.TTY{In: o.In, Out: o.Out, Raw: true}
+	if !t.IsTerminalIn() || !t.IsTerminalOut() {
+		t.Raw = false
+	}
+	req.VersionedParams(&v1.PodExecOptions{
+		Container: tj.Name,
+		Command:   o.command,
+		Stdin:     true,
+		Stdout:    true,
+		Stderr:    !t.Raw,
+		TTY:       t.Raw,
+	}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(o.clientConfig, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+	opts := remotecommand.StreamOptions{
+		Stdin:  o.In,
+		Stdout: o.Out,
+		Tty:    t.Raw,
+	}
+	if t.Raw {
+		opts.TerminalSizeQueue = t.MonitorSize(t.GetSize())
+	} else {
+		opts.Stderr = o.ErrOut
+	}
+	return t.Safe(func() error {
+		return exec.Stream(opts)
+	})
+}
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes/scheme"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+var (
+	stopShort = `Stop a trace gracefully, keeping its output`
+	stopLong  = stopShort + `
+
+The tracer is interrupted like with Ctrl-C, so that bpftrace prints its maps and
+histograms before exiting. The output can then be read with the logs command, while
+delete would kill the trace and lose them.`
+
+	stopExamples = `
+  # Stop a trace and print its output
+  %[1]s trace stop 656ee75a-ee3c-11e8-9e7a-8c164500a77e
+  %[1]s trace logs 656ee75a-ee3c-11e8-9e7a-8c164500a77e
+
+  # Stop all the traces created by one invocation on many nodes
+  %[1]s trace stop --group 4f9c2a1b`
+
+	stopArgErrString      = "(TRACE_ID | TRACE_NAME) or --group is a required argument for the stop command"
+	noRunningPodErrString = "no running pod found for the trace"
+)
+
+// StopOptions ...
+type StopOptions struct {
+	genericclioptions.IOStreams
+	traceID      *types.UID
+	traceName    *string
+	namespace    string
+	clientConfig *rest.Config
+	group        string
+}
+
+// NewStopOptions provides an instance of StopOptions with default values.
+func NewStopOptions(streams genericclioptions.IOStreams) *StopOptions {
+	return &StopOptions{
+		IOStreams: streams,
+	}
+}
+
+// NewStopCommand provides the stop command wrapping StopOptions.
+func NewStopCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewStopOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "stop (TRACE_ID | TRACE_NAME | --group GROUP)",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T(stopShort),
+		Long:                  templates.LongDesc(i18n.T(stopLong)),
+		Example:               templates.Examples(fmt.Sprintf(i18n.T(stopExamples), "kubectl")),
+		SilenceUsage:          true,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&o.group, "group", o.group, "Stop all the traces of this group, created by one invocation")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating StopOptions accordingly.
+func (o *StopOptions) Validate(cmd *cobra.Command, args []string) error {
+	switch {
+	case len(args) == 1:
+		o.traceName, o.traceID = parseTraceArg(args[0])
+	case len(args) > 1 || len(o.group) == 0:
+		return fmt.Errorf(i18n.T(stopArgErrString))
+	}
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *StopOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.clientConfig, err = factory.ToRESTConfig()
+	return err
+}
+
+// Run interrupts the tracer of the running pods of the trace.
+func (o *StopOptions) Run() error {
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient: jobsClient.Jobs(o.namespace),
+	}
+
+	ctx := context.Background()
+	tf, err := tc.ResolveIDPrefix(ctx, tracejob.TraceJobFilter{
+		Name:  o.traceName,
+		ID:    o.traceID,
+		Group: o.group,
+	})
+	if err != nil {
+		return err
+	}
+	tjs, err := tc.GetJob(ctx, tf)
+	if err != nil {
+		return err
+	}
+	if len(tjs) == 0 {
+		return fmt.Errorf(i18n.T(traceNotFoundErr))
+	}
+	if len(o.group) == 0 {
+		tjs = tjs[:1]
+	}
+
+	stopped := false
+	for _, tj := range tjs {
+		pl, err := coreClient.Pods(tj.Namespace).List(metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, tj.ID),
+		})
+		if err != nil {
+			return err
+		}
+
+		running := false
+		for _, p := range pl.Items {
+			if p.Status.Phase != v1.PodRunning {
+				continue
+			}
+			// The trace-runner forwards the interrupt to the tracer
+			if err := execInContainer(coreClient.RESTClient(), o.clientConfig, p, tj.Name, []string{"/bin/trace-runner", "stop"}, o.Out, o.ErrOut); err != nil {
+				return err
+			}
+			running = true
+		}
+		if running {
+			fmt.Fprintf(o.Out, "trace %s stopped\n", tj.ID)
+			stopped = true
+		}
+	}
+	if !stopped {
+		return fmt.Errorf(i18n.T(noRunningPodErrString))
+	}
+	return nil
+}
+
+// execInContainer runs a command in a container of a pod.
+func execInContainer(client rest.Interface, config *rest.Config, pod v1.Pod, container string, command []string, stdout, stderr io.Writer) error {
+	req := client.Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(pod.Namespace).
+		SubResource("exec")
+	req.VersionedParams(&v1.PodExecOptions{
+		Container: container,
+		Command:   command,
+		Stdout:    true,
+		Stderr:    true,
+	}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+	return exec.Stream(remotecommand.StreamOptions{
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fntlnz/kubectl-trace/pkg/client"
+	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/signals"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/fntlnz/kubectl-trace/pkg/top"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/rest"
+	"k8s.io/kubernetes/pkg/kubectl/util/term"
+)
+
+var (
+	topShort = `Show the maps of a running trace as a table refreshed in place`
+	topLong  = topShort + `
+
+The trace is attached to and the maps it prints, e.g. with print() in an interval probe,
+are aggregated into a table of their latest values instead of scrolling by. Each dump of
+a map replaces the previous one, so that cleared keys go away. Interrupt to exit, the
+trace keeps running.`
+
+	topExamples = `
+  # Run a trace printing the reads by process every second
+  %[1]s trace run node/ip-180-12-0-152.ec2.internal -e 'tracepoint:syscalls:sys_enter_read { @reads[comm] = count(); } interval:s:1 { print(@reads); clear(@reads); }'
+
+  # Show its processes reading the most
+  %[1]s trace top 656ee75a-ee3c-11e8-9e7a-8c164500a77e
+
+  # Only show the keys of the reads map matching nginx, sorted by key
+  %[1]s trace top 656ee75a-ee3c-11e8-9e7a-8c164500a77e --map reads --filter nginx --sort key`
+
+	topArgErrString      = "(TRACE_ID | TRACE_NAME) is a required argument for the top command"
+	topSortErrString     = "the sort must be one of %s"
+	topFilterErrString   = "invalid filter: %v"
+	topIntervalErrString = "the refresh interval must be positive"
+
+	// clearScreen moves the cursor home and clears the terminal.
+	clearScreen = "\x1b[H\x1b[2J"
+)
+
+// TopOptions ...
+type TopOptions struct {
+	genericclioptions.IOStreams
+	traceID      *types.UID
+	traceName    *string
+	namespace    string
+	clientConfig *rest.Config
+
+	sort     string
+	mapName  string
+	filter   string
+	interval time.Duration
+	options  top.Options
+}
+
+// NewTopOptions provides an instance of TopOptions with default values.
+func NewTopOptions(streams genericclioptions.IOStreams) *TopOptions {
+	return &TopOptions{
+		IOStreams: streams,
+		sort:      top.SortByValue,
+		interval:  2 * time.Second,
+	}
+}
+
+// NewTopCommand provides the top command wrapping TopOptions.
+func NewTopCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewTopOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "top (TRACE_ID | TRACE_NAME) [--sort value|key] [--map MAP] [--filter REGEXP]",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T(topShort),
+		Long:                  templates.LongDesc(i18n.T(topLong)),
+		Example:               templates.Examples(fmt.Sprintf(i18n.T(topExamples), "kubectl")),
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&o.sort, "sort", o.sort, fmt.Sprintf("Sort the rows by %s, the values decreasing", strings.Join(top.Sorts, " or ")))
+	cmd.Flags().StringVar(&o.mapName, "map", o.mapName, "Only show the rows of this map")
+	cmd.Flags().StringVar(&o.filter, "filter", o.filter, "Only show the rows whose map and key, e.g. @reads[nginx], match this regular expression")
+	cmd.Flags().DurationVar(&o.interval, "interval", o.interval, "How often to refresh the table")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating TopOptions accordingly.
+func (o *TopOptions) Validate(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf(i18n.T(topArgErrString))
+	}
+	o.traceName, o.traceID = parseTraceArg(args[0])
+
+	valid := false
+	for _, s := range top.Sorts {
+		valid = valid || s == o.sort
+	}
+	if !valid {
+		return fmt.Errorf(i18n.T(topSortErrString), strings.Join(top.Sorts, ", "))
+	}
+	if o.interval <= 0 {
+		return fmt.Errorf(i18n.T(topIntervalErrString))
+	}
+
+	o.options = top.Options{Sort: o.sort, Map: o.mapName}
+	if len(o.filter) > 0 {
+		filter, err := regexp.Compile(o.filter)
+		if err != nil {
+			return fmt.Errorf(i18n.T(topFilterErrString), err)
+		}
+		o.options.Filter = filter
+	}
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *TopOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.clientConfig, err = factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Run attaches to the trace and refreshes the table of its maps until
+// interrupted.
+func (o *TopOptions) Run() error {
+	ctx := signals.WithStandardSignals(context.Background())
+	c, err := client.New(factory.WithContext(ctx, o.clientConfig))
+	if err != nil {
+		return err
+	}
+
+	jobs, err := c.Get(ctx, o.namespace, tracejob.TraceJobFilter{
+		Name: o.traceName,
+		ID:   o.traceID,
+	})
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		return fmt.Errorf(i18n.T(traceNotFoundErrString))
+	}
+
+	// The output of the trace goes to the table, without TTY
+	table := top.NewTable()
+	a := c.NewAttacher(genericclioptions.IOStreams{Out: table, ErrOut: o.ErrOut})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Attach(ctx, a, jobs[:1])
+	}()
+
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-errc:
+			return err
+		case <-ticker.C:
+			if err := o.render(table, jobs[0].Name); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// render redraws the table, fitting the terminal if the output is one,
+// otherwise it is printed after the previous one.
+func (o *TopOptions) render(table *top.Table, name string) error {
+	rows := table.Rows(o.options)
+	limit := 0
+	if term.IsTerminal(o.Out) {
+		fmt.Fprint(o.Out, clearScreen)
+		// The header, the blank line and the column names
+		if size := (term.TTY{Out: o.Out}).GetSize(); size != nil && size.Height > 3 {
+			limit = int(size.Height) - 3
+		}
+	}
+
+	fmt.Fprintf(o.Out, "%s - %s - %d rows\n\n", name, time.Now().Format("15:04:05"), len(rows))
+	return top.Render(o.Out, rows, limit)
+}
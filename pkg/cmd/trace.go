@@ -2,8 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
 
 	"github.com/spf13/cobra"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
@@ -19,16 +23,23 @@ These commands help you trace existing application resources.
   %[1]s trace run kubernetes-node-emt8.c.myproject.internal -f read.bt
 
   # Get all bpftrace programs in all namespaces
-  %[1]s trace get --all-namespaces
+  %[1]s trace get -A
 
   # Delete all bpftrace programs in a specific namespace
   %[1]s trace delete -n myns
 `
+
+	// translationsEnv tells the directory of the translations, overriding the
+	// translations directory of kubectl-trace in the home directory.
+	translationsEnv     = "KUBECTL_TRACE_TRANSLATIONS"
+	translationsDir     = "translations"
+	translationsWarning = "Warning: the translations are not loaded: %v\n"
 )
 
 // TraceOptions ...
 type TraceOptions struct {
 	configFlags *genericclioptions.ConfigFlags
+	configFile  string
 
 	genericclioptions.IOStreams
 }
@@ -46,33 +57,87 @@ func NewTraceOptions(streams genericclioptions.IOStreams) *TraceOptions {
 func NewTraceCommand(streams genericclioptions.IOStreams) *cobra.Command {
 	o := NewTraceOptions(streams)
 
+	// The messages are translated as the commands are built
+	if err := i18n.LoadTranslations(translationsPath(os.Getenv), os.Getenv); err != nil {
+		fmt.Fprintf(streams.ErrOut, translationsWarning, err)
+	}
+
 	cmd := &cobra.Command{
-		Use:                   "trace",
-		DisableFlagsInUseLine: true,
-		Short:                 `Execute and manage bpftrace programs`, // Wrap with i18n.T()
-		Long:                  traceLong,                              // Wrap with templates.LongDesc()
-		Example:               fmt.Sprintf(traceExamples, "kubectl"),  // Wrap with templates.Examples()
+		Use:                    "trace",
+		DisableFlagsInUseLine:  true,
+		Short:                  i18n.T(`Execute and manage bpftrace programs`),
+		Long:                   templates.LongDesc(i18n.T(traceLong)),
+		Example:                templates.Examples(fmt.Sprintf(i18n.T(traceExamples), "kubectl")),
+		BashCompletionFunction: bashCompletionFunc,
 		Run: func(c *cobra.Command, args []string) {
 			c.SetOutput(streams.ErrOut)
 			cobra.NoArgs(c, args)
 			c.Help()
 		},
+		// The flags not given on the command line default to the environment,
+		// then to the config file
+		PersistentPreRunE: func(c *cobra.Command, args []string) error {
+			if err := applyDefaults(c.Flags(), envDefaults(c.Flags(), os.Getenv), "environment"); err != nil {
+				return err
+			}
+			config, err := loadConfig(o.configFile)
+			if err != nil {
+				return err
+			}
+			return applyDefaults(c.Flags(), config, "config file")
+		},
 	}
 
 	flags := cmd.PersistentFlags()
 	o.configFlags.AddFlags(flags)
+	flags.StringVar(&o.configFile, "config", o.configFile, "Path of the config file holding the defaults of the flags, ~/.kubectl-trace/config.yaml by default")
 
 	matchVersionFlags := factory.NewMatchVersionFlags(o.configFlags)
 	matchVersionFlags.AddFlags(flags)
 
-	// flags.AddGoFlagSet(flag.CommandLine) // todo(leodido) > evaluate whether we need this or not
+	rateLimitFlags := factory.NewRateLimitFlags(matchVersionFlags)
+	rateLimitFlags.AddFlags(flags)
+
+	addLogFlags(flags)
+	addColorFlags(flags)
 
-	f := factory.NewFactory(matchVersionFlags)
+	f := factory.NewFactory(rateLimitFlags)
 
 	cmd.AddCommand(NewRunCommand(f, streams))
+	cmd.AddCommand(NewGenerateCommand(f, streams))
 	cmd.AddCommand(NewGetCommand(f, streams))
+	cmd.AddCommand(NewDescribeCommand(f, streams))
+	cmd.AddCommand(NewDiagnoseCommand(f, streams))
 	cmd.AddCommand(NewAttachCommand(f, streams))
+	cmd.AddCommand(NewLogsCommand(f, streams))
+	cmd.AddCommand(NewTopCommand(f, streams))
+	cmd.AddCommand(NewResultsCommand(f, streams))
+	cmd.AddCommand(NewReplayCommand(f, streams))
+	cmd.AddCommand(NewHistoryCommand(streams))
 	cmd.AddCommand(NewDeleteCommand(f, streams))
+	cmd.AddCommand(NewStopCommand(f, streams))
+	cmd.AddCommand(NewWaitCommand(f, streams))
+	cmd.AddCommand(NewShellCommand(f, streams))
+	cmd.AddCommand(NewKillCommand(f, streams))
+	cmd.AddCommand(NewFlamegraphCommand(f, streams))
+	cmd.AddCommand(NewControllerCommand(f, streams))
+	cmd.AddCommand(NewSetupCommand(f, streams))
+	cmd.AddCommand(NewVersionCommand(f, streams))
+	cmd.AddCommand(NewCompletionCommand(streams))
+	cmd.AddCommand(NewCompleteCommand(f, streams))
 
 	return cmd
 }
+
+// translationsPath provides the directory of the translations, empty when there
+// is none.
+func translationsPath(getenv func(string) string) string {
+	if dir := getenv(translationsEnv); len(dir) > 0 {
+		return dir
+	}
+	home, err := homeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, traceHomeDir, translationsDir)
+}
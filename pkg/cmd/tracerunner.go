@@ -0,0 +1,752 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/fntlnz/kubectl-trace/pkg/bpftrace"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"github.com/fntlnz/kubectl-trace/pkg/upload"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var (
+	traceRunnerShort = `Execute the tracer inside a trace job`
+	traceRunnerLong  = traceRunnerShort + `
+
+This command is meant to be the entrypoint of the trace job container and is not
+intended to be used directly.`
+
+	perfDataPath                = "/tmp/perf.data"
+	profileDataPath             = "/tmp/profile.txt"
+	renderedProgramPath         = "/tmp/program.bt"
+	filteredProgramPath         = "/tmp/program-filtered.bt"
+	runnerPIDPath               = "/tmp/trace-runner.pid"
+	resultsOutputFile           = "output.txt"
+	resultsTimeFormat           = "20060102T150405Z"
+	uploadResultsDir            = "/tmp/results"
+	procPath                    = "/proc"
+	cgroupRootPath              = "/sys/fs/cgroup"
+	cgroupHybridPath            = "/sys/fs/cgroup/unified"
+	cgroupSystemdPath           = "/sys/fs/cgroup/systemd"
+	containerPIDErrString       = "unable to find a process for container %s"
+	containerIDMissingErrString = "the %s tracer requires a container id"
+	interfaceMissingErrString   = "the %s tracer requires an interface or a container id"
+	unitPIDErrString            = "unable to find a process for unit %s"
+	memlockWarning              = "warning: unable to set the memlock limit to %s: %v\n"
+	memlockUnlimited            = "unlimited"
+	cgroupFilterErrString       = "filtering by cgroup requires a container id or a unit and the bpftrace tracer"
+	cgroupUnifiedErrString      = "process %d is not in the unified cgroup hierarchy, which filtering by cgroup requires"
+)
+
+// TraceRunnerOptions ...
+type TraceRunnerOptions struct {
+	tracer      string
+	program     string
+	duration    time.Duration
+	containerID string
+	unit        string
+	cgroup      bool
+	iface       string
+	direction   string
+	section     string
+	memlock     string
+	args        []string
+	check       bool
+	format      string
+	metricsOut  string
+	resultsDir  string
+	uploadURL   string
+	notifyURL   string
+
+	// stdout is where the output of the tracer goes, along with the results if any
+	stdout     io.Writer
+	runResults string
+}
+
+// NewTraceRunnerOptions provides an instance of TraceRunnerOptions with default values.
+func NewTraceRunnerOptions() *TraceRunnerOptions {
+	return &TraceRunnerOptions{
+		tracer: string(tracejob.BpftraceTracer),
+		stdout: os.Stdout,
+	}
+}
+
+// NewTraceRunnerCommand provides the trace-runner command wrapping TraceRunnerOptions.
+func NewTraceRunnerCommand() *cobra.Command {
+	o := NewTraceRunnerOptions()
+
+	cmd := &cobra.Command{
+		Use:          "trace-runner [-- ARGS...]",
+		Short:        i18n.T(traceRunnerShort),
+		Long:         templates.LongDesc(i18n.T(traceRunnerLong)),
+		SilenceUsage: true,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			err := o.Run()
+			// The trace pod exits like the tracer, e.g. when bpftrace cannot compile the program
+			if e, ok := err.(*exec.ExitError); ok {
+				return exitWith(c, tracerExitCode(e))
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&o.tracer, "tracer", o.tracer, "Tracer to execute")
+	cmd.Flags().StringVar(&o.program, "program", o.program, "Path of the program to execute")
+	cmd.Flags().DurationVar(&o.duration, "duration", o.duration, "How long the tracer should run")
+	cmd.Flags().StringVar(&o.containerID, "container-id", o.containerID, "Runtime ID of the container to trace")
+	cmd.Flags().StringVar(&o.unit, "unit", o.unit, "Node service to trace, a systemd unit or the command name of its processes")
+	cmd.Flags().BoolVar(&o.cgroup, "cgroup-filter", o.cgroup, "Scope the probes of the program to the cgroup of the container or of the unit")
+	cmd.Flags().StringVar(&o.iface, "interface", o.iface, "Network interface to attach the BPF object to, the host side of the interface of the container by default")
+	cmd.Flags().StringVar(&o.direction, "direction", o.direction, "Traffic seen by tc programs, ingress or egress")
+	cmd.Flags().StringVar(&o.section, "section", o.section, "ELF section of the BPF object to attach")
+	cmd.Flags().StringVar(&o.memlock, "memlock", o.memlock, "Locked memory limit of the tracer, unlimited or a quantity like 64Mi")
+	cmd.Flags().BoolVar(&o.check, "check", o.check, "Only check the bpftrace program can be parsed")
+	cmd.Flags().StringVar(&o.format, "output-format", o.format, "Output format of bpftrace, text or json")
+	cmd.Flags().StringVar(&o.metricsOut, "metrics-output", o.metricsOut, "File to also write the output of bpftrace to, for the exporter")
+	cmd.Flags().StringVar(&o.resultsDir, "results-dir", o.resultsDir, "Directory to save the output and the artifacts of each run of the tracer in")
+	cmd.Flags().StringVar(&o.uploadURL, "upload-url", o.uploadURL, "Bucket to upload the output and the artifacts of each run of the tracer to once it ends")
+	cmd.Flags().StringVar(&o.notifyURL, "notify-url", o.notifyURL, "URL to POST a JSON notification to when the tracer completes or fails")
+
+	cmd.AddCommand(NewHeadersCommand())
+	cmd.AddCommand(newRunnerStopCommand())
+	cmd.AddCommand(NewExporterCommand())
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating TraceRunnerOptions accordingly.
+func (o *TraceRunnerOptions) Validate(cmd *cobra.Command, args []string) error {
+	o.args = args
+	tracer := tracejob.Tracer(o.tracer)
+	switch {
+	case tracer == tracejob.BpftraceTracer:
+		if len(o.program) == 0 {
+			return fmt.Errorf(i18n.T("the %s tracer requires a program"), o.tracer)
+		}
+	case tracer.IsProfiler():
+		if o.duration <= 0 {
+			return fmt.Errorf(i18n.T("the %s tracer requires a duration"), o.tracer)
+		}
+		if tracer.TargetsProcess() && len(o.containerID) == 0 {
+			return fmt.Errorf(i18n.T(containerIDMissingErrString), o.tracer)
+		}
+	case tracer.IsNetwork():
+		if len(o.program) == 0 {
+			return fmt.Errorf(i18n.T("the %s tracer requires a program"), o.tracer)
+		}
+		if len(o.iface) == 0 && len(o.containerID) == 0 {
+			return fmt.Errorf(i18n.T(interfaceMissingErrString), o.tracer)
+		}
+	case tracer == tracejob.CommandTracer:
+		if len(o.args) == 0 {
+			return fmt.Errorf(i18n.T("the %s tracer requires a command"), o.tracer)
+		}
+	default:
+		return fmt.Errorf(i18n.T("unknown tracer %s"), o.tracer)
+	}
+	if len(o.unit) > 0 && tracer != tracejob.BpftraceTracer && tracer != tracejob.CommandTracer {
+		return fmt.Errorf(i18n.T(unitTracerErrString), o.tracer)
+	}
+	if o.cgroup && (tracer != tracejob.BpftraceTracer || len(o.containerID)+len(o.unit) == 0) {
+		return fmt.Errorf(i18n.T(cgroupFilterErrString))
+	}
+
+	if len(o.uploadURL) > 0 {
+		if err := upload.ValidateURL(o.uploadURL); err != nil {
+			return err
+		}
+		// The results to upload are kept locally when there is no claim for them
+		if len(o.resultsDir) == 0 {
+			o.resultsDir = uploadResultsDir
+		}
+	}
+
+	return nil
+}
+
+// Run executes the tracer.
+func (o *TraceRunnerOptions) Run() error {
+	// Trace pods sharing the host PID namespace have another process as PID 1,
+	// the stop command finds the runner to interrupt with this file.
+	if err := ioutil.WriteFile(runnerPIDPath, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		return err
+	}
+
+	// Scheduled traces run many times, each run has its own results
+	if len(o.resultsDir) > 0 {
+		o.runResults = filepath.Join(o.resultsDir, time.Now().UTC().Format(resultsTimeFormat))
+		if err := os.MkdirAll(o.runResults, 0755); err != nil {
+			return err
+		}
+		f, err := os.Create(filepath.Join(o.runResults, resultsOutputFile))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		o.stdout = io.MultiWriter(os.Stdout, f)
+	}
+
+	// The tracer inherits the limit, without it may fail to create its maps
+	if len(o.memlock) > 0 {
+		if err := setMemlock(o.memlock); err != nil {
+			fmt.Fprintf(os.Stderr, i18n.T(memlockWarning), o.memlock, err)
+		}
+	}
+
+	start := time.Now()
+	err := o.runTracer()
+	if len(o.uploadURL) > 0 {
+		// The results are uploaded even when the tracer fails, they may tell why
+		if uerr := o.uploadResults(); uerr != nil {
+			if err != nil {
+				fmt.Fprintln(os.Stderr, uerr.Error())
+			} else {
+				err = uerr
+			}
+		}
+	}
+	if len(o.notifyURL) > 0 {
+		// Failing to notify does not fail the trace
+		if nerr := notify(o.notifyURL, newNotification(os.Getenv("TRACE_ID"), os.Getenv("NODE_NAME"), start, err)); nerr != nil {
+			fmt.Fprintln(os.Stderr, nerr.Error())
+		}
+	}
+	return err
+}
+
+// runTracer executes the tracer, writing its output to stdout.
+func (o *TraceRunnerOptions) runTracer() error {
+	switch tracejob.Tracer(o.tracer) {
+	case tracejob.PerfTracer:
+		return o.runPerf()
+	case tracejob.PyspyTracer, tracejob.RbspyTracer:
+		return o.runInterpreterProfiler()
+	case tracejob.TcTracer, tracejob.XDPTracer:
+		return o.runNetwork()
+	case tracejob.CommandTracer:
+		return o.runTracerCommand()
+	default:
+		program, err := o.renderProgram()
+		if err != nil {
+			return err
+		}
+		if o.cgroup {
+			if program, err = o.filterProgram(program); err != nil {
+				return err
+			}
+		}
+		if o.check {
+			return bpftraceCheck(program)
+		}
+		// Arguments are the positional parameters of the program, $1, $2...
+		bpftraceArgs := append([]string{program}, o.args...)
+		if len(o.format) > 0 {
+			bpftraceArgs = append([]string{"-f", o.format}, bpftraceArgs...)
+		}
+		c := exec.Command("bpftrace", bpftraceArgs...)
+		c.Stdout = o.stdout
+		if len(o.metricsOut) == 0 {
+			return runForwardingSignals(c, o.duration)
+		}
+		return o.runExported(c)
+	}
+}
+
+// uploadResults uploads the results of the run to the bucket, under the ID of
+// the trace and the time of the run.
+func (o *TraceRunnerOptions) uploadResults() error {
+	u, err := upload.New(o.uploadURL, os.Getenv)
+	if err != nil {
+		return err
+	}
+	prefix := path.Join(os.Getenv("TRACE_ID"), filepath.Base(o.runResults))
+	return filepath.Walk(o.runResults, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		body, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(o.runResults, p)
+		if err != nil {
+			return err
+		}
+		return u.Upload(path.Join(prefix, filepath.ToSlash(rel)), body)
+	})
+}
+
+// runExported runs bpftrace writing its output to the metrics output as well,
+// telling the exporter when it ends.
+func (o *TraceRunnerOptions) runExported(c *exec.Cmd) error {
+	f, err := os.Create(o.metricsOut)
+	if err != nil {
+		return err
+	}
+	defer ioutil.WriteFile(o.metricsOut+doneSuffix, nil, 0644)
+	defer f.Close()
+
+	c.Stdout = io.MultiWriter(o.stdout, f)
+	return runForwardingSignals(c, o.duration)
+}
+
+// newRunnerStopCommand provides the command interrupting the running tracer,
+// executed in the trace job container by the stop command.
+func newRunnerStopCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:          "stop",
+		Short:        i18n.T("Interrupt the tracer so that it reports what it collected"),
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			b, err := ioutil.ReadFile(runnerPIDPath)
+			if err != nil {
+				return err
+			}
+			pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+			if err != nil {
+				return err
+			}
+			p, err := os.FindProcess(pid)
+			if err != nil {
+				return err
+			}
+			return p.Signal(os.Interrupt)
+		},
+	}
+}
+
+func (o *TraceRunnerOptions) runPerf() error {
+	seconds := strconv.Itoa(int(o.duration.Seconds()))
+	// The samples are kept along with the results, if any
+	data := perfDataPath
+	if len(o.runResults) > 0 {
+		data = filepath.Join(o.runResults, filepath.Base(perfDataPath))
+	}
+	record := exec.Command("perf", "record", "-F", "99", "-a", "-g", "-o", data, "--", "sleep", seconds)
+	if err := runForwardingSignals(record, 0); err != nil {
+		return err
+	}
+	script := exec.Command("perf", "script", "-i", data)
+	script.Stdout = o.stdout
+	return runForwardingSignals(script, 0)
+}
+
+// runInterpreterProfiler samples the stacks of the target container process
+// and prints them in the collapsed format understood by flamegraph tools.
+func (o *TraceRunnerOptions) runInterpreterProfiler() error {
+	pid, err := findContainerPID(o.containerID)
+	if err != nil {
+		return err
+	}
+
+	seconds := strconv.Itoa(int(o.duration.Seconds()))
+	var c *exec.Cmd
+	switch tracejob.Tracer(o.tracer) {
+	case tracejob.PyspyTracer:
+		c = exec.Command("py-spy", "record", "--pid", strconv.Itoa(pid), "--duration", seconds, "--format", "raw", "--output", profileDataPath)
+	default:
+		c = exec.Command("rbspy", "record", "--pid", strconv.Itoa(pid), "--duration", seconds, "--format", "collapsed", "--file", profileDataPath)
+	}
+	if err := runForwardingSignals(c, 0); err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadFile(profileDataPath)
+	if err != nil {
+		return err
+	}
+	_, err = o.stdout.Write(b)
+	return err
+}
+
+// runTracerCommand runs the command of the trace job, its arguments being
+// templates rendered with the trace context like programs.
+func (o *TraceRunnerOptions) runTracerCommand() error {
+	args := o.args
+	if strings.Contains(strings.Join(args, " "), "{{") {
+		ctx, err := o.programContext()
+		if err != nil {
+			return err
+		}
+		args = make([]string, len(o.args))
+		for i, a := range o.args {
+			var b bytes.Buffer
+			if err := renderTemplate(a, ctx, &b); err != nil {
+				return err
+			}
+			args[i] = b.String()
+		}
+	}
+	c := exec.Command(args[0], args[1:]...)
+	c.Stdout = o.stdout
+	return runForwardingSignals(c, o.duration)
+}
+
+// ProgramContext is the trace context available to program templates, e.g. {{.ContainerPID}}.
+// The container fields are only set when tracing a container, the unit ones when
+// tracing a unit.
+type ProgramContext struct {
+	NodeName     string
+	TraceID      string
+	PodName      string
+	ContainerID  string
+	ContainerPID int
+	CgroupPath   string
+	Unit         string
+	UnitPID      int
+}
+
+// programContext provides the trace context, described by the environment of
+// the trace job container and by the processes of the target.
+func (o *TraceRunnerOptions) programContext() (ProgramContext, error) {
+	ctx := ProgramContext{
+		NodeName:    os.Getenv("NODE_NAME"),
+		TraceID:     os.Getenv("TRACE_ID"),
+		PodName:     os.Getenv("TARGET_POD"),
+		ContainerID: o.containerID,
+		Unit:        o.unit,
+	}
+	var err error
+	if len(o.unit) > 0 {
+		if ctx.UnitPID, err = findUnitPID(o.unit); err != nil {
+			return ctx, err
+		}
+	}
+	if len(o.containerID) > 0 {
+		if ctx.ContainerPID, err = findContainerPID(o.containerID); err != nil {
+			return ctx, err
+		}
+		if ctx.CgroupPath, err = findCgroupPath(ctx.ContainerPID, o.containerID); err != nil {
+			return ctx, err
+		}
+	}
+	return ctx, nil
+}
+
+// renderProgram renders the program template with the trace context, it provides
+// the path of the rendered program or of the program itself when it is not a template.
+func (o *TraceRunnerOptions) renderProgram() (string, error) {
+	program, b, err := readProgram(o.program)
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(string(b), "{{") {
+		return program, nil
+	}
+	ctx, err := o.programContext()
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Create(renderedProgramPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := renderTemplate(string(b), ctx, f); err != nil {
+		return "", err
+	}
+	return renderedProgramPath, nil
+}
+
+// filterProgram scopes the probes of the program at path to the cgroup of the
+// container or of the unit, it provides the path of the filtered program.
+func (o *TraceRunnerOptions) filterProgram(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	pid, err := o.targetPID()
+	if err != nil {
+		return "", err
+	}
+	cgroup, err := findUnifiedCgroup(pid, o.containerID)
+	if err != nil {
+		return "", err
+	}
+	filtered, err := bpftrace.FilterCgroup(string(b), cgroup)
+	if err != nil {
+		return "", err
+	}
+	return filteredProgramPath, ioutil.WriteFile(filteredProgramPath, []byte(filtered), 0644)
+}
+
+// readProgram reads the program at path, or its gzipped version next to it for
+// programs too large for a ConfigMap, which is decompressed for bpftrace to read.
+// It provides the path of the program to execute along with its content.
+func readProgram(path string) (string, []byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if !os.IsNotExist(err) {
+		return path, b, err
+	}
+	f, err := os.Open(path + ".gz")
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return "", nil, err
+	}
+	if b, err = ioutil.ReadAll(zr); err != nil {
+		return "", nil, err
+	}
+	return renderedProgramPath, b, ioutil.WriteFile(renderedProgramPath, b, 0644)
+}
+
+// renderTemplate renders a program template with the trace context.
+func renderTemplate(program string, ctx ProgramContext, w io.Writer) error {
+	tmpl, err := template.New("program").Option("missingkey=error").Parse(program)
+	if err != nil {
+		return fmt.Errorf(i18n.T("error parsing the program template: %v"), err)
+	}
+	if err := tmpl.Execute(w, ctx); err != nil {
+		return fmt.Errorf(i18n.T("error rendering the program template: %v"), err)
+	}
+	return nil
+}
+
+// bpftraceCheck parses a bpftrace program without running it, reporting the errors on stderr.
+func bpftraceCheck(path string) error {
+	c := exec.Command("bpftrace", "-d", path)
+	// The debug output is only useful to bpftrace developers
+	c.Stdout = ioutil.Discard
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// findCgroupPath provides the cgroup path of the container process, preferring
+// the unified hierarchy over the controllers of the legacy ones.
+func findCgroupPath(pid int, containerID string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(procPath, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", err
+	}
+
+	path := ""
+	for _, line := range strings.Split(string(b), "\n") {
+		// Lines are in the hierarchy-ID:controllers:path form
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 || !strings.Contains(parts[2], containerID) {
+			continue
+		}
+		if parts[0] == "0" {
+			return parts[2], nil
+		}
+		if len(path) == 0 {
+			path = parts[2]
+		}
+	}
+	if len(path) == 0 {
+		return "", fmt.Errorf(i18n.T(containerPIDErrString), containerID)
+	}
+	return path, nil
+}
+
+// targetPID provides the host PID of the container or of the unit traced.
+func (o *TraceRunnerOptions) targetPID() (int, error) {
+	if len(o.unit) > 0 {
+		return findUnitPID(o.unit)
+	}
+	return findContainerPID(o.containerID)
+}
+
+// findUnifiedCgroup provides the directory of the cgroup of the process in the
+// unified hierarchy, mounted on its own or next to the legacy ones, the cgroup
+// builtin of bpftrace being its ID. The cgroup must mention the container id
+// if any.
+func findUnifiedCgroup(pid int, containerID string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(procPath, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", err
+	}
+
+	root := cgroupRootPath
+	if _, err := os.Stat(filepath.Join(cgroupRootPath, "cgroup.controllers")); err != nil {
+		root = cgroupHybridPath
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "0::") && strings.Contains(line, containerID) {
+			return filepath.Join(root, strings.TrimPrefix(line, "0::")), nil
+		}
+	}
+	return "", fmt.Errorf(i18n.T(cgroupUnifiedErrString), pid)
+}
+
+// unitComms are the command names of the processes of the well known node
+// services whose unit is named otherwise, e.g. kubelet, containerd and crio
+// are named after their unit.
+var unitComms = map[string]string{
+	"docker": "dockerd",
+}
+
+// findUnitPID looks for the lowest host PID of the unit, in its systemd cgroup
+// or else by the command name of its processes for nodes without systemd.
+func findUnitPID(unit string) (int, error) {
+	name := strings.TrimSuffix(unit, ".service")
+	pids := []int{}
+	for _, root := range []string{cgroupRootPath, cgroupHybridPath, cgroupSystemdPath} {
+		b, err := ioutil.ReadFile(filepath.Join(root, "system.slice", name+".service", "cgroup.procs"))
+		if err != nil {
+			continue
+		}
+		for _, f := range strings.Fields(string(b)) {
+			if pid, err := strconv.Atoi(f); err == nil {
+				pids = append(pids, pid)
+			}
+		}
+		if len(pids) > 0 {
+			break
+		}
+	}
+
+	if len(pids) == 0 {
+		comm := name
+		if c, ok := unitComms[name]; ok {
+			comm = c
+		}
+		comms, err := filepath.Glob(filepath.Join(procPath, "*", "comm"))
+		if err != nil {
+			return 0, err
+		}
+		for _, c := range comms {
+			pid, err := strconv.Atoi(filepath.Base(filepath.Dir(c)))
+			if err != nil {
+				continue
+			}
+			if b, err := ioutil.ReadFile(c); err == nil && strings.TrimSpace(string(b)) == comm {
+				pids = append(pids, pid)
+			}
+		}
+	}
+
+	if len(pids) == 0 {
+		return 0, fmt.Errorf(i18n.T(unitPIDErrString), unit)
+	}
+	sort.Ints(pids)
+	return pids[0], nil
+}
+
+// findContainerPID looks for the lowest host PID whose cgroup mentions the
+// container id, that is the process started by the container runtime.
+func findContainerPID(containerID string) (int, error) {
+	cgroups, err := filepath.Glob(filepath.Join(procPath, "*", "cgroup"))
+	if err != nil {
+		return 0, err
+	}
+
+	pids := []int{}
+	for _, cg := range cgroups {
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(cg)))
+		if err != nil {
+			continue
+		}
+		b, err := ioutil.ReadFile(cg)
+		if err != nil {
+			continue
+		}
+		if strings.Contains(string(b), containerID) {
+			pids = append(pids, pid)
+		}
+	}
+
+	if len(pids) == 0 {
+		return 0, fmt.Errorf(i18n.T(containerPIDErrString), containerID)
+	}
+	sort.Ints(pids)
+	return pids[0], nil
+}
+
+// tracerExitCode is the exit code of the tracer, 128 plus the signal when
+// killed by one like shells tell.
+func tracerExitCode(e *exec.ExitError) int {
+	ws, ok := e.Sys().(syscall.WaitStatus)
+	if !ok {
+		return 1
+	}
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ws.ExitStatus()
+}
+
+// parseMemlock parses a locked memory limit, unlimited or a quantity like 64Mi,
+// into bytes.
+func parseMemlock(s string) (uint64, error) {
+	if s == memlockUnlimited {
+		return math.MaxUint64, nil
+	}
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return 0, err
+	}
+	if q.Sign() < 0 {
+		return 0, fmt.Errorf(i18n.T("negative limit %s"), s)
+	}
+	return uint64(q.Value()), nil
+}
+
+// runForwardingSignals runs c attached to the runner standard streams, unless its
+// output is already set, relaying interrupts so that tracers can print their
+// results before exiting.
+// When a duration is given, c is interrupted once it expires.
+func runForwardingSignals(c *exec.Cmd, duration time.Duration) error {
+	c.Stdin = os.Stdin
+	if c.Stdout == nil {
+		c.Stdout = os.Stdout
+	}
+	c.Stderr = os.Stderr
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Wait()
+	}()
+
+	var expired <-chan time.Time
+	if duration > 0 {
+		timer := time.NewTimer(duration)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case sig := <-sigCh:
+			c.Process.Signal(sig)
+		case <-expired:
+			c.Process.Signal(os.Interrupt)
+		case err := <-done:
+			return err
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"github.com/fntlnz/kubectl-trace/pkg/version"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	versionShort = `Print the versions of the plugin and of the tracer`
+	versionLong  = versionShort + `
+
+The version of the plugin and the default image of the tracer are printed. With --node
+a short lived pod runs the tracer image on the node to print its bpftrace version, to
+be included in bug reports.`
+
+	versionExamples = `
+  # Print the version of the plugin and the default tracer image
+  %[1]s trace version
+
+  # Also print the version of bpftrace on a node
+  %[1]s trace version --node ip-180-12-0-152.ec2.internal`
+
+	versionArgsErrString    = "the version command takes no arguments"
+	versionTimeoutErrString = "timed out waiting for the pod printing the bpftrace version"
+	versionPodErrString     = "the pod printing the bpftrace version %s cannot run: %s"
+
+	// versionPodTimeout is how long to wait for the pod printing the bpftrace
+	// version to complete, pulling the image included.
+	versionPodTimeout = 2 * time.Minute
+)
+
+// VersionOptions ...
+type VersionOptions struct {
+	genericclioptions.IOStreams
+	namespace    string
+	clientConfig *rest.Config
+
+	node      string
+	imageName string
+}
+
+// NewVersionOptions provides an instance of VersionOptions with default values.
+func NewVersionOptions(streams genericclioptions.IOStreams) *VersionOptions {
+	return &VersionOptions{
+		IOStreams: streams,
+	}
+}
+
+// NewVersionCommand provides the version command wrapping VersionOptions.
+func NewVersionCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewVersionOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "version [--node NODE]",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T(versionShort),
+		Long:                  templates.LongDesc(i18n.T(versionLong)),
+		Example:               templates.Examples(fmt.Sprintf(i18n.T(versionExamples), "kubectl")),
+		SilenceUsage:          true,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.node, "node", o.node, "Node to print the bpftrace version of the tracer image on")
+	cmd.Flags().StringVar(&o.imageName, "imagename", o.imageName, "Image of the tracer to print the bpftrace version of, by default the one of the architecture of the node")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating VersionOptions accordingly.
+func (o *VersionOptions) Validate(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf(i18n.T(versionArgsErrString))
+	}
+	return nil
+}
+
+// Complete completes the setup of the command, the cluster is only needed with --node.
+func (o *VersionOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	if len(o.node) == 0 {
+		return nil
+	}
+
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.clientConfig, err = factory.ToRESTConfig()
+	return err
+}
+
+// Run prints the versions, that of bpftrace on the node when requested.
+func (o *VersionOptions) Run() error {
+	fmt.Fprintf(o.Out, "Client Version: %s\n", version.Version)
+	if len(version.GitCommit) > 0 {
+		fmt.Fprintf(o.Out, "Git Commit: %s\n", version.GitCommit)
+	}
+	fmt.Fprintf(o.Out, "Tracer Image: %s\n", meta.ImageNameTag)
+	if len(o.node) == 0 {
+		return nil
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+	image := o.imageName
+	if len(image) == 0 {
+		node, err := coreClient.Nodes().Get(o.node, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		image = meta.ImageNameTagForArch(node.Labels[meta.ArchLabelKey])
+	}
+
+	bpftrace, err := o.bpftraceVersion(coreClient, image)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(o.Out, "Tracer Version: %s (%s on %s)\n", bpftrace, image, o.node)
+	return nil
+}
+
+// bpftraceVersion runs a pod printing the bpftrace version of the image on the
+// node, and provides what it printed.
+func (o *VersionOptions) bpftraceVersion(coreClient corev1client.CoreV1Interface, image string) (string, error) {
+	pods := coreClient.Pods(o.namespace)
+	pod, err := pods.Create(newVersionPod(o.node, image))
+	if err != nil {
+		return "", err
+	}
+	defer pods.Delete(pod.Name, metav1.NewDeleteOptions(0))
+
+	err = wait.PollImmediate(time.Second, versionPodTimeout, func() (bool, error) {
+		pod, err = pods.Get(pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if reason := tracejob.PodFailureReason(*pod); len(reason) > 0 {
+			return false, fmt.Errorf(i18n.T(versionPodErrString), pod.Name, reason)
+		}
+		return pod.Status.Phase == v1.PodSucceeded, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return "", fmt.Errorf(i18n.T(versionTimeoutErrString))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	logs, err := pods.GetLogs(pod.Name, &v1.PodLogOptions{}).Stream()
+	if err != nil {
+		return "", err
+	}
+	defer logs.Close()
+	var b bytes.Buffer
+	if _, err := io.Copy(&b, logs); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// newVersionPod provides a pod printing the bpftrace version of the image on
+// the node, tolerating its taints as traces can.
+func newVersionPod(node, image string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("%sversion-%s", meta.ObjectNamePrefix, uuid.NewUUID()),
+		},
+		Spec: v1.PodSpec{
+			NodeName: node,
+			Containers: []v1.Container{
+				v1.Container{
+					Name:    "version",
+					Image:   image,
+					Command: []string{"bpftrace", "--version"},
+				},
+			},
+			Tolerations: []v1.Toleration{
+				v1.Toleration{Operator: v1.TolerationOpExists},
+			},
+			RestartPolicy: v1.RestartPolicyNever,
+		},
+	}
+}
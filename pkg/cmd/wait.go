@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fntlnz/kubectl-trace/pkg/client"
+	"github.com/fntlnz/kubectl-trace/pkg/factory"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/signals"
+	"github.com/fntlnz/kubectl-trace/pkg/templates"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	waitShort = `Wait for a trace to end`
+	waitLong  = waitShort + `
+
+The command blocks until the trace is completed or failed, then exits with status 0
+when it completed and otherwise with the exit code of the tracer, or 1 when it has
+none, so that scripts and pipelines can tell whether the trace succeeded. Every trace
+of a group must complete for the group to succeed.`
+
+	waitExamples = `
+  # Wait for a trace to end
+  %[1]s trace wait 656ee75a-ee3c-11e8-9e7a-8c164500a77e
+
+  # Wait at most five minutes for the traces created by one invocation on many nodes
+  %[1]s trace wait --group 4f9c2a1b --timeout 5m`
+
+	waitArgErrString         = "(TRACE_ID | TRACE_NAME) or --group is a required argument for the wait command"
+	waitTimeoutErrString     = "timed out waiting for the trace to end"
+	waitInterruptedErrString = "interrupted waiting for the trace to end"
+)
+
+// WaitOptions ...
+type WaitOptions struct {
+	genericclioptions.IOStreams
+	traceID      *types.UID
+	traceName    *string
+	namespace    string
+	clientConfig *rest.Config
+	group        string
+	timeout      time.Duration
+}
+
+// NewWaitOptions provides an instance of WaitOptions with default values.
+func NewWaitOptions(streams genericclioptions.IOStreams) *WaitOptions {
+	return &WaitOptions{
+		IOStreams: streams,
+	}
+}
+
+// NewWaitCommand provides the wait command wrapping WaitOptions.
+func NewWaitCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewWaitOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "wait (TRACE_ID | TRACE_NAME | --group GROUP) [--timeout DURATION]",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T(waitShort),
+		Long:                  templates.LongDesc(i18n.T(waitLong)),
+		Example:               templates.Examples(fmt.Sprintf(i18n.T(waitExamples), "kubectl")),
+		SilenceUsage:          true,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			code, err := o.Run()
+			if err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return exitWith(c, 1)
+			}
+			if code != 0 {
+				return exitWith(c, code)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&o.group, "group", o.group, "Wait for all the traces of this group, created by one invocation")
+	cmd.Flags().DurationVar(&o.timeout, "timeout", o.timeout, "How long to wait for the trace to end, 0 waits forever")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating WaitOptions accordingly.
+func (o *WaitOptions) Validate(cmd *cobra.Command, args []string) error {
+	switch {
+	case len(args) == 1:
+		o.traceName, o.traceID = parseTraceArg(args[0])
+	case len(args) > 1 || len(o.group) == 0:
+		return fmt.Errorf(i18n.T(waitArgErrString))
+	}
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *WaitOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.clientConfig, err = factory.ToRESTConfig()
+	return err
+}
+
+// Run waits for the traces to end and provides the exit status telling how they ended.
+func (o *WaitOptions) Run() (int, error) {
+	ctx := signals.WithStandardSignals(context.Background())
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+
+	c, err := client.New(factory.WithContext(ctx, o.clientConfig))
+	if err != nil {
+		return 0, err
+	}
+	tjs, err := c.Wait(ctx, o.namespace, tracejob.TraceJobFilter{
+		Name:  o.traceName,
+		ID:    o.traceID,
+		Group: o.group,
+	})
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return 0, fmt.Errorf(i18n.T(waitTimeoutErrString))
+	}
+	if err != nil && ctx.Err() != nil {
+		return 0, fmt.Errorf(i18n.T(waitInterruptedErrString))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return printEnded(o.Out, tjs), nil
+}
+
+// printEnded tells how the traces ended and provides the exit status telling
+// whether they all completed, the exit code of the tracer of the first one that
+// did not or 1 when it has none.
+func printEnded(w io.Writer, tjs []tracejob.TraceJob) int {
+	code := 0
+	for _, tj := range tjs {
+		status := strings.ToLower(string(tj.Status))
+		if len(tj.Reason) > 0 {
+			status += ": " + tj.Reason
+		}
+		fmt.Fprintf(w, "trace %s %s\n", tj.ID, status)
+		if tj.Status == tracejob.TraceJobStatusCompleted || code != 0 {
+			continue
+		}
+		code = 1
+		if tj.ExitCode > 0 {
+			code = int(tj.ExitCode)
+		}
+	}
+	return code
+}
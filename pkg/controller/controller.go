@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// resyncPeriod is how long the controller waits before watching again
+// after the watch on the TraceJob resources ended.
+const resyncPeriod = 5 * time.Second
+
+// Controller reconciles TraceJob custom resources into trace jobs.
+type Controller struct {
+	client    dynamic.Interface
+	clientset kubernetes.Interface
+	namespace string
+	log       io.Writer
+}
+
+// NewController provides a controller for the TraceJob resources in namespace,
+// an empty namespace means all the namespaces.
+func NewController(client dynamic.Interface, clientset kubernetes.Interface, namespace string, log io.Writer) *Controller {
+	return &Controller{
+		client:    client,
+		clientset: clientset,
+		namespace: namespace,
+		log:       log,
+	}
+}
+
+// Run reconciles the TraceJob resources until the context is done.
+func (c *Controller) Run(ctx context.Context) error {
+	go c.runEvents(ctx)
+	for {
+		if err := c.watch(ctx); err != nil {
+			fmt.Fprintf(c.log, "error watching trace jobs: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(resyncPeriod):
+		}
+	}
+}
+
+func (c *Controller) watch(ctx context.Context) error {
+	// Watching from no resource version sends all the existing resources first
+	w, err := c.client.Resource(tracejob.TraceJobResource).Namespace(c.namespace).Watch(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.ResultChan():
+			if !ok {
+				return nil
+			}
+			if ev.Type != watch.Added && ev.Type != watch.Modified {
+				continue
+			}
+			u, ok := ev.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			if err := c.reconcile(ctx, u); err != nil {
+				fmt.Fprintf(c.log, "error reconciling trace job %s/%s: %v\n", u.GetNamespace(), u.GetName(), err)
+			}
+		}
+	}
+}
+
+func (c *Controller) reconcile(ctx context.Context, u *unstructured.Unstructured) error {
+	phase, _, _ := unstructured.NestedString(u.Object, "status", "phase")
+	if len(phase) > 0 {
+		return nil
+	}
+
+	nj, err := tracejob.FromUnstructured(u)
+	if err == nil {
+		nj.OwnerReferences = []metav1.OwnerReference{tracejob.ControllerReference(u)}
+		err = c.create(ctx, nj)
+	}
+
+	status := map[string]interface{}{
+		"phase":   string(tracejob.TraceJobPhaseCreated),
+		"traceID": string(nj.ID),
+		"jobName": nj.Name,
+	}
+	if err != nil {
+		status["phase"] = string(tracejob.TraceJobPhaseFailed)
+		status["message"] = err.Error()
+	}
+	u.Object["status"] = status
+
+	if _, uerr := c.client.Resource(tracejob.TraceJobResource).Namespace(u.GetNamespace()).Update(u, metav1.UpdateOptions{}); uerr != nil {
+		return uerr
+	}
+	if err == nil {
+		fmt.Fprintf(c.log, "trace %s created for %s/%s\n", nj.ID, u.GetNamespace(), u.GetName())
+	}
+	return err
+}
+
+func (c *Controller) create(ctx context.Context, nj tracejob.TraceJob) error {
+	tc := &tracejob.TraceJobClient{
+		JobClient:     c.clientset.BatchV1().Jobs(nj.Namespace),
+		CronJobClient: c.clientset.BatchV1beta1().CronJobs(nj.Namespace),
+		ConfigClient:  c.clientset.CoreV1().ConfigMaps(nj.Namespace),
+		ServiceClient: c.clientset.CoreV1().Services(nj.Namespace),
+		SecretClient:  c.clientset.CoreV1().Secrets(nj.Namespace),
+		EventClient:   c.clientset.CoreV1().Events(nj.Namespace),
+	}
+
+	_, err := tc.Create(ctx, nj)
+	// A previous attempt might have been interrupted before updating the status
+	if errors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/fntlnz/kubectl-trace/pkg/tracejob"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// runEvents records the lifecycle of the trace jobs as events on their jobs,
+// whatever created them, until the context is done.
+func (c *Controller) runEvents(ctx context.Context) {
+	for {
+		if err := c.watchJobs(ctx); err != nil {
+			fmt.Fprintf(c.log, "error watching the jobs of the traces: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resyncPeriod):
+		}
+	}
+}
+
+func (c *Controller) watchJobs(ctx context.Context) error {
+	w, err := c.clientset.BatchV1().Jobs(c.namespace).Watch(metav1.ListOptions{
+		LabelSelector: meta.TraceIDLabelKey,
+	})
+	if err != nil {
+		return err
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.ResultChan():
+			if !ok {
+				return nil
+			}
+			if ev.Type != watch.Added && ev.Type != watch.Modified {
+				continue
+			}
+			job, ok := ev.Object.(*batchv1.Job)
+			if !ok {
+				continue
+			}
+			if err := c.recordJobEvents(ctx, job); err != nil {
+				fmt.Fprintf(c.log, "error recording the events of job %s/%s: %v\n", job.Namespace, job.Name, err)
+			}
+		}
+	}
+}
+
+// recordJobEvents records the transitions the job went through, each of them
+// is recorded once.
+func (c *Controller) recordJobEvents(ctx context.Context, job *batchv1.Job) error {
+	tc := &tracejob.TraceJobClient{
+		EventClient: c.clientset.CoreV1().Events(job.Namespace),
+	}
+	record := func(eventType, reason, message string) error {
+		return tc.RecordEvent(ctx, job.ObjectMeta, "Job", batchv1.SchemeGroupVersion.String(), eventType, reason, message)
+	}
+
+	if job.Status.StartTime != nil {
+		if err := record(apiv1.EventTypeNormal, tracejob.EventReasonStarted, tracejob.EventMessage(job.ObjectMeta, "started")); err != nil {
+			return err
+		}
+	}
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != apiv1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			return record(apiv1.EventTypeNormal, tracejob.EventReasonCompleted, tracejob.EventMessage(job.ObjectMeta, "completed"))
+		case batchv1.JobFailed:
+			return record(apiv1.EventTypeWarning, tracejob.EventReasonFailed, tracejob.EventMessage(job.ObjectMeta, "failed: "+cond.Message))
+		}
+	}
+	return nil
+}
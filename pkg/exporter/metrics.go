@@ -0,0 +1,253 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+)
+
+// MetricPrefix prefixes the names of the metrics made of bpftrace maps.
+const MetricPrefix = "bpftrace_"
+
+// Metrics holds the latest values of the maps printed by bpftrace with the
+// json output format, exposed as Prometheus metrics.
+type Metrics struct {
+	mu sync.Mutex
+	// families are the rendered metrics of each map, by metric name
+	families map[string]string
+}
+
+// NewMetrics provides an instance of Metrics without any map.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		families: map[string]string{},
+	}
+}
+
+// event is a line printed by bpftrace with the json output format.
+type event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// bucket is a bucket of a bpftrace histogram, the first one has no min and
+// the last one no max.
+type bucket struct {
+	Min   *float64 `json:"min"`
+	Max   *float64 `json:"max"`
+	Count float64  `json:"count"`
+}
+
+// stats are the values of the count, avg and stats bpftrace functions.
+type stats struct {
+	Count   float64 `json:"count"`
+	Average float64 `json:"average"`
+	Total   float64 `json:"total"`
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// Update updates the metrics of the maps of a bpftrace JSON line, other lines
+// like printf ones are ignored.
+func (m *Metrics) Update(line []byte) error {
+	e := event{}
+	if err := json.Unmarshal(line, &e); err != nil {
+		return err
+	}
+	if e.Type != "map" && e.Type != "hist" && e.Type != "stats" {
+		return nil
+	}
+	maps := map[string]json.RawMessage{}
+	if err := json.Unmarshal(e.Data, &maps); err != nil {
+		return err
+	}
+
+	for mapName, data := range maps {
+		name := metricName(mapName)
+		var b bytes.Buffer
+		var err error
+		switch e.Type {
+		case "map":
+			err = renderMap(&b, name, data)
+		case "hist":
+			err = renderHist(&b, name, data)
+		case "stats":
+			err = renderStats(&b, name, data)
+		}
+		if err != nil {
+			return fmt.Errorf(i18n.T("invalid %s %s: %v"), e.Type, mapName, err)
+		}
+		m.mu.Lock()
+		m.families[name] = b.String()
+		m.mu.Unlock()
+	}
+	return nil
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := []string{}
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var written int64
+	for _, name := range names {
+		n, err := io.WriteString(w, m.families[name])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+// metricName provides the metric name of a map, e.g. bpftrace_reads for @reads.
+func metricName(mapName string) string {
+	name := strings.TrimPrefix(mapName, "@")
+	if len(name) == 0 {
+		name = "map"
+	}
+	return MetricPrefix + invalidNameChars.ReplaceAllString(name, "_")
+}
+
+// renderMap renders a map of values, keyed or not, as a gauge.
+func renderMap(w io.Writer, name string, data json.RawMessage) error {
+	fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+	var value float64
+	if err := json.Unmarshal(data, &value); err == nil {
+		fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+		return nil
+	}
+
+	values := map[string]float64{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s{key=%s} %s\n", name, quote(key), formatFloat(values[key]))
+	}
+	return nil
+}
+
+// renderHist renders histograms, keyed or not, as Prometheus histograms.
+func renderHist(w io.Writer, name string, data json.RawMessage) error {
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	buckets := []bucket{}
+	if err := json.Unmarshal(data, &buckets); err == nil {
+		renderBuckets(w, name, "", buckets)
+		return nil
+	}
+
+	keyed := map[string][]bucket{}
+	if err := json.Unmarshal(data, &keyed); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(keyed) {
+		renderBuckets(w, name, fmt.Sprintf("key=%s,", quote(key)), keyed[key])
+	}
+	return nil
+}
+
+func renderBuckets(w io.Writer, name, labels string, buckets []bucket) {
+	count := 0.0
+	for _, b := range buckets {
+		count += b.Count
+		// The last bucket has no upper bound
+		if b.Max != nil {
+			fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %s\n", name, labels, formatFloat(*b.Max), formatFloat(count))
+		}
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %s\n", name, labels, formatFloat(count))
+	if len(labels) == 0 {
+		fmt.Fprintf(w, "%s_count %s\n", name, formatFloat(count))
+	} else {
+		fmt.Fprintf(w, "%s_count{%s} %s\n", name, strings.TrimSuffix(labels, ","), formatFloat(count))
+	}
+}
+
+// renderStats renders the count, average and total of stats, keyed or not, as gauges.
+func renderStats(w io.Writer, name string, data json.RawMessage) error {
+	keyed := map[string]stats{}
+	s := stats{}
+	if err := json.Unmarshal(data, &s); err == nil && !isKeyed(data) {
+		keyed[""] = s
+	} else if err := json.Unmarshal(data, &keyed); err != nil {
+		return err
+	}
+
+	suffixes := []string{"count", "average", "total"}
+	for _, suffix := range suffixes {
+		fmt.Fprintf(w, "# TYPE %s_%s gauge\n", name, suffix)
+		for _, key := range sortedKeys(keyed) {
+			s := keyed[key]
+			value := map[string]float64{"count": s.Count, "average": s.Average, "total": s.Total}[suffix]
+			if len(key) == 0 {
+				fmt.Fprintf(w, "%s_%s %s\n", name, suffix, formatFloat(value))
+			} else {
+				fmt.Fprintf(w, "%s_%s{key=%s} %s\n", name, suffix, quote(key), formatFloat(value))
+			}
+		}
+	}
+	return nil
+}
+
+// isKeyed tells whether stats are keyed, their values being objects.
+func isKeyed(data json.RawMessage) bool {
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return false
+	}
+	for _, v := range values {
+		return bytes.HasPrefix(bytes.TrimSpace(v), []byte("{"))
+	}
+	return false
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	switch m := m.(type) {
+	case map[string]float64:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string][]bucket:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]stats:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// quote quotes a label value as the Prometheus text format expects.
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
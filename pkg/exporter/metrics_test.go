@@ -0,0 +1,72 @@
+package exporter
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{
+			name:  "scalar map",
+			lines: []string{`{"type": "map", "data": {"@reads": 12}}`},
+			want: "# TYPE bpftrace_reads gauge\n" +
+				"bpftrace_reads 12\n",
+		},
+		{
+			name: "keyed map updated",
+			lines: []string{
+				`{"type": "map", "data": {"@bytes": {"nginx": 1, "curl": 2}}}`,
+				`{"type": "map", "data": {"@bytes": {"nginx": 3, "my \"app\"": 4}}}`,
+			},
+			want: "# TYPE bpftrace_bytes gauge\n" +
+				"bpftrace_bytes{key=\"my \\\"app\\\"\"} 4\n" +
+				"bpftrace_bytes{key=\"nginx\"} 3\n",
+		},
+		{
+			name:  "histogram",
+			lines: []string{`{"type": "hist", "data": {"@usecs": [{"max": -1, "count": 0}, {"min": 0, "max": 1, "count": 2}, {"min": 2, "max": 3, "count": 5}, {"min": 4, "count": 1}]}}`},
+			want: "# TYPE bpftrace_usecs histogram\n" +
+				"bpftrace_usecs_bucket{le=\"-1\"} 0\n" +
+				"bpftrace_usecs_bucket{le=\"1\"} 2\n" +
+				"bpftrace_usecs_bucket{le=\"3\"} 7\n" +
+				"bpftrace_usecs_bucket{le=\"+Inf\"} 8\n" +
+				"bpftrace_usecs_count 8\n",
+		},
+		{
+			name:  "keyed stats",
+			lines: []string{`{"type": "stats", "data": {"@": {"read": {"count": 2, "average": 5, "total": 10}}}}`},
+			want: "# TYPE bpftrace_map_count gauge\n" +
+				"bpftrace_map_count{key=\"read\"} 2\n" +
+				"# TYPE bpftrace_map_average gauge\n" +
+				"bpftrace_map_average{key=\"read\"} 5\n" +
+				"# TYPE bpftrace_map_total gauge\n" +
+				"bpftrace_map_total{key=\"read\"} 10\n",
+		},
+		{
+			name:  "printf output",
+			lines: []string{`{"type": "printf", "data": "hello\n"}`},
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMetrics()
+			for _, l := range tt.lines {
+				if err := m.Update([]byte(l)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var b bytes.Buffer
+			m.WriteTo(&b)
+			if b.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package factory
+
+import (
+	"context"
+	"net/http"
+
+	"k8s.io/client-go/rest"
+)
+
+// WithContext provides a copy of the config whose clients abort their requests
+// in flight once the context is done, as the typed clients don't take contexts.
+func WithContext(ctx context.Context, config *rest.Config) *rest.Config {
+	c := rest.CopyConfig(config)
+	wrap := c.WrapTransport
+	c.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		if wrap != nil {
+			rt = wrap(rt)
+		}
+		return &contextRoundTripper{ctx: ctx, delegate: rt}
+	}
+	return c
+}
+
+// contextRoundTripper binds the requests without context to its context.
+type contextRoundTripper struct {
+	ctx      context.Context
+	delegate http.RoundTripper
+}
+
+func (rt *contextRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Context() == context.Background() {
+		req = req.WithContext(rt.ctx)
+	}
+	return rt.delegate.RoundTrip(req)
+}
@@ -0,0 +1,66 @@
+package factory
+
+import (
+	"github.com/spf13/pflag"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	flagQPS   = "qps"
+	flagBurst = "burst"
+)
+
+// RateLimitFlags is for setting the client-side rate limits of the requests,
+// which throttle the traces of many nodes in large clusters.
+type RateLimitFlags struct {
+	Delegate genericclioptions.RESTClientGetter
+
+	// QPS and Burst are those of client-go when zero.
+	QPS   float32
+	Burst int
+}
+
+var _ genericclioptions.RESTClientGetter = &RateLimitFlags{}
+
+// ToRESTConfig implements RESTClientGetter.
+func (f *RateLimitFlags) ToRESTConfig() (*rest.Config, error) {
+	clientConfig, err := f.Delegate.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	if f.QPS > 0 {
+		clientConfig.QPS = f.QPS
+	}
+	if f.Burst > 0 {
+		clientConfig.Burst = f.Burst
+	}
+	return clientConfig, nil
+}
+
+func (f *RateLimitFlags) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	return f.Delegate.ToRawKubeConfigLoader()
+}
+
+func (f *RateLimitFlags) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	return f.Delegate.ToDiscoveryClient()
+}
+
+func (f *RateLimitFlags) ToRESTMapper() (meta.RESTMapper, error) {
+	return f.Delegate.ToRESTMapper()
+}
+
+func (f *RateLimitFlags) AddFlags(flags *pflag.FlagSet) {
+	flags.Float32Var(&f.QPS, flagQPS, f.QPS, "Maximum queries per second to the API server, 5 when zero")
+	flags.IntVar(&f.Burst, flagBurst, f.Burst, "Maximum burst of queries to the API server above the QPS, 10 when zero")
+}
+
+func NewRateLimitFlags(delegate genericclioptions.RESTClientGetter) *RateLimitFlags {
+	return &RateLimitFlags{
+		Delegate: delegate,
+	}
+}
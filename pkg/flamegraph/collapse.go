@@ -0,0 +1,158 @@
+package flamegraph
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Folded maps a stack, with frames from the root to the leaf separated by semicolons,
+// to the number of times it was sampled.
+type Folded map[string]int
+
+var (
+	offsetRe    = regexp.MustCompile(`\+0x[0-9a-fA-F]+$|\+[0-9]+$`)
+	bpftraceKey = regexp.MustCompile(`^@[A-Za-z0-9_]*\[(.*)$`)
+	bpftraceEnd = regexp.MustCompile(`^\]:\s*([0-9]+)$`)
+)
+
+// Collapse reads the output of a profiling trace and folds its stacks.
+// It understands the collapsed format produced by py-spy and rbspy, the
+// output of perf script, and bpftrace maps keyed by kstack or ustack.
+func Collapse(r io.Reader) (Folded, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		// Trace jobs run with a TTY, get rid of the carriage returns
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, l := range lines {
+		if bpftraceKey.MatchString(l) {
+			return collapseBpftrace(lines), nil
+		}
+	}
+
+	folded := collapseFolded(lines)
+	if len(folded) > 0 {
+		return folded, nil
+	}
+	return collapsePerf(lines), nil
+}
+
+func collapseFolded(lines []string) Folded {
+	folded := Folded{}
+	for _, l := range lines {
+		i := strings.LastIndex(l, " ")
+		if i <= 0 || !strings.Contains(l[:i], ";") {
+			continue
+		}
+		count, err := strconv.Atoi(l[i+1:])
+		if err != nil {
+			continue
+		}
+		folded[l[:i]] += count
+	}
+	return folded
+}
+
+func collapsePerf(lines []string) Folded {
+	folded := Folded{}
+	comm := ""
+	frames := []string{}
+
+	flush := func() {
+		if len(comm) > 0 && len(frames) > 0 {
+			stack := []string{comm}
+			for i := len(frames) - 1; i >= 0; i-- {
+				stack = append(stack, frames[i])
+			}
+			folded[strings.Join(stack, ";")]++
+		}
+		comm = ""
+		frames = frames[:0]
+	}
+
+	for _, l := range lines {
+		if len(strings.TrimSpace(l)) == 0 {
+			flush()
+			continue
+		}
+		if l[0] != ' ' && l[0] != '\t' {
+			flush()
+			comm = strings.Fields(l)[0]
+			continue
+		}
+		fields := strings.Fields(l)
+		if len(fields) < 2 {
+			continue
+		}
+		// <address> <symbol>[+offset] (<module>)
+		sym := strings.Join(fields[1:], " ")
+		if i := strings.LastIndex(sym, " ("); i > 0 {
+			sym = sym[:i]
+		}
+		frames = append(frames, cleanFrame(sym))
+	}
+	flush()
+
+	return folded
+}
+
+func collapseBpftrace(lines []string) Folded {
+	folded := Folded{}
+	root := ""
+	frames := []string{}
+	inStack := false
+
+	for _, l := range lines {
+		trimmed := strings.TrimSpace(l)
+		if m := bpftraceKey.FindStringSubmatch(trimmed); m != nil {
+			inStack = true
+			frames = frames[:0]
+			// Keys like @[comm, kstack] carry the process name before the stack
+			root = strings.TrimSpace(strings.TrimSuffix(m[1], ","))
+			continue
+		}
+		if !inStack {
+			continue
+		}
+		if m := bpftraceEnd.FindStringSubmatch(trimmed); m != nil {
+			inStack = false
+			count, _ := strconv.Atoi(m[1])
+			if len(frames) == 0 {
+				continue
+			}
+			// bpftrace prints the stacks from the leaf to the root
+			stack := []string{}
+			if len(root) > 0 {
+				stack = append(stack, root)
+			}
+			for i := len(frames) - 1; i >= 0; i-- {
+				stack = append(stack, frames[i])
+			}
+			folded[strings.Join(stack, ";")] += count
+			continue
+		}
+		if len(trimmed) > 0 {
+			frames = append(frames, cleanFrame(trimmed))
+		}
+	}
+
+	return folded
+}
+
+func cleanFrame(f string) string {
+	f = offsetRe.ReplaceAllString(f, "")
+	f = strings.Replace(f, ";", ":", -1)
+	if len(f) == 0 {
+		return "[unknown]"
+	}
+	return f
+}
@@ -0,0 +1,68 @@
+package flamegraph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCollapse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Folded
+	}{
+		{
+			name: "collapsed stacks",
+			input: `main;handler;compute 10
+main;handler;compute 5
+main;idle 3
+`,
+			want: Folded{
+				"main;handler;compute": 15,
+				"main;idle":            3,
+			},
+		},
+		{
+			name: "perf script output",
+			input: "nginx  1234 [000] 12345.678901:   10101010 cpu-clock:\r\n" +
+				"\tffffffff81063b46 native_safe_halt+0x6 ([kernel.kallsyms])\r\n" +
+				"\tffffffff8103ab2d default_idle+0x1d ([kernel.kallsyms])\r\n" +
+				"\r\n" +
+				"nginx  1234 [000] 12345.688901:   10101010 cpu-clock:\n" +
+				"\tffffffff81063b46 native_safe_halt+0x6 ([kernel.kallsyms])\n" +
+				"\tffffffff8103ab2d default_idle+0x1d ([kernel.kallsyms])\n",
+			want: Folded{
+				"nginx;default_idle;native_safe_halt": 2,
+			},
+		},
+		{
+			name: "bpftrace stack map",
+			input: `Attaching 1 probe...
+
+@[
+    native_safe_halt+6
+    default_idle+29
+]: 42
+@[swapper/0,
+    cpu_idle+10
+]: 2
+`,
+			want: Folded{
+				"default_idle;native_safe_halt": 42,
+				"swapper/0;cpu_idle":            2,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Collapse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Collapse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Collapse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package flamegraph
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+)
+
+const (
+	imageWidth  = 1200
+	frameHeight = 16
+	padding     = 10
+	titleHeight = 30
+	fontSize    = 12
+	charWidth   = 7
+	minWidth    = 0.1
+)
+
+type frame struct {
+	name     string
+	value    int
+	children map[string]*frame
+}
+
+func newFrame(name string) *frame {
+	return &frame{name: name, children: map[string]*frame{}}
+}
+
+func (f *frame) depth() int {
+	d := 0
+	for _, c := range f.children {
+		if cd := c.depth() + 1; cd > d {
+			d = cd
+		}
+	}
+	return d
+}
+
+// Render draws the folded stacks as an interactive SVG flamegraph.
+func Render(w io.Writer, title string, folded Folded) error {
+	root := newFrame("all")
+	for stack, count := range folded {
+		root.value += count
+		cur := root
+		for _, name := range strings.Split(stack, ";") {
+			child, ok := cur.children[name]
+			if !ok {
+				child = newFrame(name)
+				cur.children[name] = child
+			}
+			child.value += count
+			cur = child
+		}
+	}
+
+	if root.value == 0 {
+		return fmt.Errorf(i18n.T("no stacks to render"))
+	}
+
+	depth := root.depth() + 1
+	height := titleHeight + depth*frameHeight + 2*padding
+	scale := float64(imageWidth-2*padding) / float64(root.value)
+
+	fmt.Fprintf(w, `<?xml version="1.0" standalone="no"?>`+"\n")
+	fmt.Fprintf(w, `<svg version="1.1" width="%d" height="%d" xmlns="http://www.w3.org/2000/svg">`+"\n", imageWidth, height)
+	fmt.Fprintf(w, `<rect x="0" y="0" width="%d" height="%d" fill="#eeeeee"/>`+"\n", imageWidth, height)
+	fmt.Fprintf(w, `<text x="%d" y="%d" font-size="17" font-family="Verdana" text-anchor="middle">%s</text>`+"\n", imageWidth/2, titleHeight-padding, html.EscapeString(title))
+
+	r := renderer{w: w, scale: scale, total: root.value, bottom: height - padding}
+	r.draw(root, padding, 0)
+
+	_, err := fmt.Fprintln(w, "</svg>")
+	return err
+}
+
+type renderer struct {
+	w      io.Writer
+	scale  float64
+	total  int
+	bottom int
+}
+
+func (r renderer) draw(f *frame, x float64, level int) {
+	width := float64(f.value) * r.scale
+	if width < minWidth {
+		return
+	}
+	y := r.bottom - (level+1)*frameHeight
+	name := html.EscapeString(f.name)
+	pct := float64(f.value) * 100 / float64(r.total)
+
+	fmt.Fprintf(r.w, "<g>\n<title>%s (%d samples, %.2f%%)</title>\n", name, f.value, pct)
+	fmt.Fprintf(r.w, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s" rx="2" ry="2"/>`+"\n", x, y, width, frameHeight-1, color(f.name))
+	if chars := int(width / charWidth); chars > 2 {
+		label := f.name
+		if len(label) > chars {
+			label = label[:chars-2] + ".."
+		}
+		fmt.Fprintf(r.w, `<text x="%.1f" y="%d" font-size="%d" font-family="Verdana">%s</text>`+"\n", x+3, y+frameHeight-4, fontSize, html.EscapeString(label))
+	}
+	fmt.Fprintln(r.w, "</g>")
+
+	names := []string{}
+	for n := range f.children {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		c := f.children[n]
+		r.draw(c, x, level+1)
+		x += float64(c.value) * r.scale
+	}
+}
+
+// color picks a warm color, stable for a given frame name.
+func color(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	v := h.Sum32()
+	return fmt.Sprintf("rgb(%d,%d,%d)", 205+v%50, (v>>8)%230, (v>>16)%55)
+}
@@ -0,0 +1,243 @@
+// Package histogram renders the histograms printed by bpftrace, hist() and
+// lhist() maps, as unicode bar charts or as heatmaps over time.
+package histogram
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Bars renders each histogram as aligned bars with eighth of a cell steps.
+	Bars = "bars"
+	// Heatmap renders each histogram as a line of shades, one per bucket, so
+	// that the histograms printed over time stack into a heatmap.
+	Heatmap = "heatmap"
+)
+
+// Modes are the ways histograms can be rendered.
+var Modes = []string{Bars, Heatmap}
+
+const (
+	// barWidth is the width of the bar of the largest bucket.
+	barWidth = 40
+	// eighths are the blocks of one to eight eighths of a cell.
+	eighths = "▏▎▍▌▋▊▉█"
+	// shades are the shades of the buckets of heatmaps, from empty to the
+	// largest bucket.
+	shades = " ░▒▓█"
+)
+
+var (
+	// header starts a histogram, e.g. @usecs[nginx]:
+	header = regexp.MustCompile(`^(@[A-Za-z0-9_]*(?:\[.*\])?):$`)
+	// bucketLine is a bucket of a histogram, e.g. [2, 4)   5 |@@@@@   |
+	bucketLine = regexp.MustCompile(`^([\[(][^\])]*[\])])\s+([0-9]+)\s+\|[@ ]*\|$`)
+)
+
+type bucket struct {
+	label string
+	count uint64
+}
+
+// histogram is a histogram being read.
+type histogram struct {
+	name    string
+	header  string
+	buckets []bucket
+	// eol is the line ending of the histogram, CRLF when printed on a TTY
+	eol string
+}
+
+// Renderer writes the output of bpftrace to w, its histograms rendered and the
+// other lines as is.
+type Renderer struct {
+	w    io.Writer
+	mode string
+	now  func() time.Time
+
+	partial []byte
+	// midLine tells that the start of the current line was written as is
+	midLine bool
+	hist    *histogram
+	// labels are the buckets of the last heatmap line of each histogram, the
+	// header of a heatmap is written again when they change
+	labels map[string]string
+}
+
+// NewRenderer provides a Renderer writing to w, rendering the histograms in
+// the mode, Bars or Heatmap.
+func NewRenderer(w io.Writer, mode string) *Renderer {
+	return &Renderer{
+		w:      w,
+		mode:   mode,
+		now:    time.Now,
+		labels: map[string]string{},
+	}
+}
+
+// Write writes the complete lines of p, holding the histograms until their
+// last bucket is written.
+func (r *Renderer) Write(p []byte) (int, error) {
+	r.partial = append(r.partial, p...)
+	for {
+		i := strings.IndexByte(string(r.partial), '\n')
+		if i < 0 {
+			break
+		}
+		line := string(r.partial[:i+1])
+		r.partial = r.partial[i+1:]
+		if err := r.line(line); err != nil {
+			return 0, err
+		}
+	}
+
+	// What cannot start a histogram is not held, e.g. a prompt
+	if len(r.partial) > 0 && (r.midLine || r.hist == nil && r.partial[0] != '@') {
+		if _, err := r.w.Write(r.partial); err != nil {
+			return 0, err
+		}
+		r.partial = r.partial[:0]
+		r.midLine = true
+	}
+	return len(p), nil
+}
+
+// line handles a complete line, along with its line ending.
+func (r *Renderer) line(line string) error {
+	if r.midLine {
+		r.midLine = false
+		_, err := io.WriteString(r.w, line)
+		return err
+	}
+
+	text := strings.TrimRight(line, "\r\n")
+	if r.hist != nil {
+		if m := bucketLine.FindStringSubmatch(text); m != nil {
+			count, _ := strconv.ParseUint(m[2], 10, 64)
+			r.hist.buckets = append(r.hist.buckets, bucket{label: m[1], count: count})
+			return nil
+		}
+		if err := r.flush(); err != nil {
+			return err
+		}
+	}
+
+	if m := header.FindStringSubmatch(text); m != nil {
+		r.hist = &histogram{name: m[1], header: line, eol: line[len(text):]}
+		return nil
+	}
+	_, err := io.WriteString(r.w, line)
+	return err
+}
+
+// flush renders the histogram read so far.
+func (r *Renderer) flush() error {
+	h := r.hist
+	r.hist = nil
+	// A map without buckets is not a histogram
+	if len(h.buckets) == 0 {
+		_, err := io.WriteString(r.w, h.header)
+		return err
+	}
+
+	var lines []string
+	if r.mode == Heatmap {
+		lines = r.heatmap(h)
+	} else {
+		lines = bars(h)
+	}
+	for _, l := range lines {
+		if _, err := io.WriteString(r.w, l+h.eol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bars renders the histogram with a bar per bucket, along with its count and
+// its share of the total.
+func bars(h *histogram) []string {
+	labelWidth, countWidth := 0, 0
+	var max, total uint64
+	for _, b := range h.buckets {
+		if len(b.label) > labelWidth {
+			labelWidth = len(b.label)
+		}
+		if n := len(strconv.FormatUint(b.count, 10)); n > countWidth {
+			countWidth = n
+		}
+		if b.count > max {
+			max = b.count
+		}
+		total += b.count
+	}
+
+	lines := []string{h.name + ":"}
+	for _, b := range h.buckets {
+		share := 0.0
+		if total > 0 {
+			share = float64(b.count) * 100 / float64(total)
+		}
+		lines = append(lines, fmt.Sprintf("%-*s %*d %s %5.1f%%", labelWidth, b.label, countWidth, b.count, bar(b.count, max), share))
+	}
+	return lines
+}
+
+// bar provides the bar of a count, barWidth cells wide for max.
+func bar(count, max uint64) string {
+	blocks := []rune(eighths)
+	n := 0
+	if max > 0 {
+		n = int(count * barWidth * 8 / max)
+	}
+	// A bucket which is not empty is never blank
+	if n == 0 && count > 0 {
+		n = 1
+	}
+	s := strings.Repeat(string(blocks[7]), n/8)
+	cells := n / 8
+	if n%8 > 0 {
+		s += string(blocks[n%8-1])
+		cells++
+	}
+	return s + strings.Repeat(" ", barWidth-cells)
+}
+
+// heatmap renders the histogram as a line of shades, one per bucket, preceded
+// by the range of its buckets when they changed since its previous line.
+func (r *Renderer) heatmap(h *histogram) []string {
+	lines := []string{}
+	first, last := h.buckets[0].label, h.buckets[len(h.buckets)-1].label
+	labels := ""
+	for _, b := range h.buckets {
+		labels += b.label
+	}
+	if r.labels[h.name] != labels {
+		r.labels[h.name] = labels
+		lines = append(lines, fmt.Sprintf("%s: %s .. %s", h.name, first, last))
+	}
+
+	var max, total uint64
+	for _, b := range h.buckets {
+		if b.count > max {
+			max = b.count
+		}
+		total += b.count
+	}
+	levels := []rune(shades)
+	var s strings.Builder
+	for _, b := range h.buckets {
+		level := 0
+		if b.count > 0 {
+			// The buckets which are not empty are at least of the lightest shade
+			level = 1 + int(b.count*uint64(len(levels)-2)/max)
+		}
+		s.WriteRune(levels[level])
+	}
+	return append(lines, fmt.Sprintf("%s |%s| %d", r.now().Format("15:04:05"), s.String(), total))
+}
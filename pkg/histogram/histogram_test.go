@@ -0,0 +1,95 @@
+package histogram
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const usecs = `Attaching 2 probes...
+@usecs:
+[0]                    1 |@@@@@@@@@@@@@                                       |
+[1]                    0 |                                                    |
+[2, 4)                 4 |@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@|
+
+`
+
+func TestRenderer(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		writes []string
+		want   string
+	}{
+		{
+			name:   "bars",
+			mode:   Bars,
+			writes: []string{usecs},
+			want: "Attaching 2 probes...\n" +
+				"@usecs:\n" +
+				"[0]    1 ██████████                                20.0%\n" +
+				"[1]    0                                            0.0%\n" +
+				"[2, 4) 4 ████████████████████████████████████████  80.0%\n" +
+				"\n",
+		},
+		{
+			name:   "bars of a keyed histogram on a TTY",
+			mode:   Bars,
+			writes: []string{"@bytes[nginx]:\r\n[1K, 2K)   3 |@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@|\r\n", "\r\n"},
+			want: "@bytes[nginx]:\r\n" +
+				"[1K, 2K) 3 ████████████████████████████████████████ 100.0%\r\n" +
+				"\r\n",
+		},
+		{
+			name: "heatmap",
+			mode: Heatmap,
+			writes: []string{
+				usecs,
+				strings.Replace(usecs, "[1]                    0", "[1]                    2", 1),
+				"@usecs:\n[0]  1 |@|\n\n",
+			},
+			want: "Attaching 2 probes...\n" +
+				"@usecs: [0] .. [2, 4)\n" +
+				"12:03:01 |░ █| 5\n" +
+				"\n" +
+				"Attaching 2 probes...\n" +
+				"12:03:01 |░▒█| 7\n" +
+				"\n" +
+				"@usecs: [0] .. [0]\n" +
+				"12:03:01 |█| 1\n" +
+				"\n",
+		},
+		{
+			name:   "lines split across writes",
+			mode:   Bars,
+			writes: []string{"hel", "lo\n@", "x:\n[0]  2 |@@|", "\n", "@y: 3\n"},
+			want: "hello\n" +
+				"@x:\n" +
+				"[0] 2 ████████████████████████████████████████ 100.0%\n" +
+				"@y: 3\n",
+		},
+		{
+			name:   "map without buckets",
+			mode:   Bars,
+			writes: []string{"@x:\nnot a bucket\n"},
+			want:   "@x:\nnot a bucket\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			r := NewRenderer(&b, tt.mode)
+			r.now = func() time.Time { return time.Date(2018, 11, 22, 12, 3, 1, 0, time.UTC) }
+			for _, w := range tt.writes {
+				if _, err := r.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if b.String() != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", b.String(), tt.want)
+			}
+		})
+	}
+}
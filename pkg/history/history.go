@@ -0,0 +1,69 @@
+package history
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Entry is a run of a trace recorded in the history.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Args are the arguments of the command line, to run the trace again.
+	Args        []string `json:"args"`
+	Namespace   string   `json:"namespace,omitempty"`
+	Targets     []string `json:"targets,omitempty"`
+	ProgramHash string   `json:"programHash,omitempty"`
+	TraceIDs    []string `json:"traceIDs,omitempty"`
+	// Error is why the run failed, it succeeded when empty.
+	Error string `json:"error,omitempty"`
+}
+
+// ProgramHash provides the hash identifying a program in the history.
+func ProgramHash(program string) string {
+	h := sha256.Sum256([]byte(program))
+	return hex.EncodeToString(h[:])
+}
+
+// Append appends an entry to the history file at path, one JSON object per line,
+// creating it when missing.
+func Append(path string, e Entry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(e)
+}
+
+// Load loads the entries of the history file at path, oldest first. A missing
+// file is an empty history and corrupted lines are skipped.
+func Load(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return []Entry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []Entry{}
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		var e Entry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, s.Err()
+}
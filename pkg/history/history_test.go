@@ -0,0 +1,61 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAppendLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "nested", "history")
+
+	entries, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected an empty history, got %v", entries)
+	}
+
+	first := Entry{
+		Time:        time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Args:        []string{"run", "node/n1", "-e", "BEGIN{}"},
+		Targets:     []string{"n1"},
+		ProgramHash: ProgramHash("BEGIN{}"),
+		TraceIDs:    []string{"656ee75a-ee3c-11e8-9e7a-8c164500a77e"},
+	}
+	second := Entry{
+		Time:  time.Date(2020, 1, 3, 3, 4, 5, 0, time.UTC),
+		Args:  []string{"run", "node/n2", "-f", "read.bt"},
+		Error: "node n2 not found",
+	}
+	for _, e := range []Entry{first, second} {
+		if err := Append(path, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Corrupted lines are skipped
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("{not json\n")
+	f.Close()
+
+	entries, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entries, []Entry{first, second}) {
+		t.Errorf("unexpected entries %v", entries)
+	}
+}
@@ -0,0 +1,86 @@
+// Package i18n translates the messages of kubectl trace in the language of the
+// locale, with the catalogs of a translations directory.
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// localeEnv are the environment variables telling the language of the messages,
+// by precedence like gettext.
+var localeEnv = []string{"LC_ALL", "LC_MESSAGES", "LANG"}
+
+var (
+	mu      sync.RWMutex
+	catalog map[string]string
+)
+
+// LoadTranslations loads the catalog of the language of the locale from the
+// directory, e.g. pt_BR.json or else pt.json for the pt_BR.UTF-8 locale. A
+// catalog is a JSON object mapping the messages to their translation, the
+// verbs of the messages must be kept. A missing catalog translates nothing.
+func LoadTranslations(dir string, getenv func(string) string) error {
+	lang := language(getenv)
+	if len(dir) == 0 || len(lang) == 0 {
+		return nil
+	}
+
+	candidates := []string{lang}
+	if i := strings.Index(lang, "_"); i > 0 {
+		candidates = append(candidates, lang[:i])
+	}
+	for _, c := range candidates {
+		path := filepath.Join(dir, c+".json")
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		translations := map[string]string{}
+		if err := json.Unmarshal(b, &translations); err != nil {
+			return fmt.Errorf("invalid translations %s: %v", path, err)
+		}
+		mu.Lock()
+		catalog = translations
+		mu.Unlock()
+		return nil
+	}
+	return nil
+}
+
+// language provides the language of the locale without its encoding, e.g.
+// pt_BR, empty for the C and POSIX locales which are not translated.
+func language(getenv func(string) string) string {
+	for _, env := range localeEnv {
+		locale := getenv(env)
+		if len(locale) == 0 {
+			continue
+		}
+		// Encoding and modifier, as in pt_BR.UTF-8@euro
+		locale = strings.SplitN(locale, ".", 2)[0]
+		locale = strings.SplitN(locale, "@", 2)[0]
+		if locale == "C" || locale == "POSIX" {
+			return ""
+		}
+		return locale
+	}
+	return ""
+}
+
+// T translates the message, left as is without translation.
+func T(msg string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if t, ok := catalog[msg]; ok && len(t) > 0 {
+		return t
+	}
+	return msg
+}
@@ -0,0 +1,49 @@
+package i18n
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTranslations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "translations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "fr.json"), []byte(`{"trace %s created": "trace %s créée"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{"LANG": "fr_FR.UTF-8"}
+	if err := LoadTranslations(dir, func(k string) string { return env[k] }); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { catalog = nil }()
+
+	if got := T("trace %s created"); got != "trace %s créée" {
+		t.Fatalf("expected the French translation, got %q", got)
+	}
+	if got := T("trace %s deleted"); got != "trace %s deleted" {
+		t.Fatalf("expected the message without translation as is, got %q", got)
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	cases := []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{"LANG": "pt_BR.UTF-8"}, "pt_BR"},
+		{map[string]string{"LANG": "de_DE.UTF-8", "LC_ALL": "it_IT@euro"}, "it_IT"},
+		{map[string]string{"LANG": "C.UTF-8"}, ""},
+		{map[string]string{}, ""},
+	}
+	for _, c := range cases {
+		if got := language(func(k string) string { return c.env[k] }); got != c.want {
+			t.Errorf("expected language %q for %v, got %q", c.want, c.env, got)
+		}
+	}
+}
@@ -7,7 +7,61 @@ const (
 	TraceIDLabelKey = "fntlnz.wtf/kubectl-trace-id"
 	// TraceLabelKey is a meta to annotate objects created by this tool
 	TraceLabelKey = "fntlnz.wtf/kubectl-trace"
+	// TraceGroupLabelKey is a meta grouping the traces created by one invocation
+	TraceGroupLabelKey = "kubectl-trace.fntlnz.wtf/group"
+	// RequestedByAnnotationKey is the annotation telling who requested a trace
+	RequestedByAnnotationKey = "kubectl-trace.fntlnz.wtf/requested-by"
+	// ReservedKeyDomain is the domain of the prefixes of the label and annotation
+	// keys of this tool, and of its subdomains
+	ReservedKeyDomain = "fntlnz.wtf"
 
 	// ObjectNamePrefix is the prefix used for objects created by kubectl-trace
 	ObjectNamePrefix = "kubectl-trace-"
+
+	// TraceJobGroup is the API group of the TraceJob custom resource
+	TraceJobGroup = "kubectl-trace.fntlnz.wtf"
+	// TraceJobVersion is the API version of the TraceJob custom resource
+	TraceJobVersion = "v1alpha1"
+	// TraceJobKind is the kind of the TraceJob custom resource
+	TraceJobKind = "TraceJob"
+
+	// BTFLabelKey is the node label telling whether the node kernel has BTF
+	BTFLabelKey = "kubectl-trace.fntlnz.wtf/btf"
+	// NFDBTFLabelKey is the node label set by Node Feature Discovery when configured to report CONFIG_DEBUG_INFO_BTF
+	NFDBTFLabelKey = "feature.node.kubernetes.io/kernel-config.DEBUG_INFO_BTF"
+	// ArchLabelKey is the node label telling the architecture of the node
+	ArchLabelKey = "kubernetes.io/arch"
+
+	// ImageName is the name of the image running the tracers
+	ImageName = "quay.io/fntlnz/kubectl-trace-bpftrace"
+	// ImageTag is the tag of the image running the tracers
+	ImageTag = "master"
+	// ImageNameTag is the default image running the tracers
+	ImageNameTag = ImageName + ":" + ImageTag
+	// BpftraceTagPrefix prefixes the tags of the images running a given
+	// bpftrace release, e.g. bpftrace-v0.9.4
+	BpftraceTagPrefix = "bpftrace-"
+	// ImageArch is the architecture of the default image, other architectures
+	// have their own images tagged with the architecture as suffix
+	ImageArch = "amd64"
 )
+
+// ImageNameTagForArch provides the default image running the tracers on nodes
+// of the given architecture, an unknown architecture gets ImageNameTag.
+func ImageNameTagForArch(arch string) string {
+	return ImageNameTagForBpftrace("", arch)
+}
+
+// ImageNameTagForBpftrace provides the image running the given bpftrace
+// release on nodes of the given architecture, the default image of the
+// architecture when the version is empty.
+func ImageNameTagForBpftrace(version, arch string) string {
+	tag := ImageTag
+	if len(version) > 0 {
+		tag = BpftraceTagPrefix + version
+	}
+	if len(arch) == 0 || arch == ImageArch {
+		return ImageName + ":" + tag
+	}
+	return ImageName + ":" + tag + "-" + arch
+}
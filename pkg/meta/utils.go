@@ -11,3 +11,9 @@ func IsObjectName(name string) bool {
 	}
 	return strings.HasPrefix(name, ObjectNamePrefix)
 }
+
+// TrimResource provides the trace name or ID of an argument, which may be
+// prefixed by its resource like the names printed by get -o name.
+func TrimResource(arg string) string {
+	return arg[strings.LastIndex(arg, "/")+1:]
+}
@@ -47,3 +47,72 @@ func TestIsObjectName(t *testing.T) {
 		})
 	}
 }
+
+func TestTrimResource(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		want string
+	}{
+		{
+			name: "trace name",
+			arg:  "kubectl-trace-1bb3ae39-efe8-11e8-9f29-8c164500a77e",
+			want: "kubectl-trace-1bb3ae39-efe8-11e8-9f29-8c164500a77e",
+		},
+		{
+			name: "trace name with its resource",
+			arg:  "tracejob.kubectl-trace.fntlnz.wtf/kubectl-trace-1bb3ae39-efe8-11e8-9f29-8c164500a77e",
+			want: "kubectl-trace-1bb3ae39-efe8-11e8-9f29-8c164500a77e",
+		},
+		{
+			name: "trace ID",
+			arg:  "1bb3ae39-efe8-11e8-9f29-8c164500a77e",
+			want: "1bb3ae39-efe8-11e8-9f29-8c164500a77e",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TrimResource(tt.arg); got != tt.want {
+				t.Errorf("TrimResource() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageNameTagForBpftrace(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		arch    string
+		want    string
+	}{
+		{
+			name: "default image",
+			want: "quay.io/fntlnz/kubectl-trace-bpftrace:master",
+		},
+		{
+			name: "default image of another architecture",
+			arch: "arm64",
+			want: "quay.io/fntlnz/kubectl-trace-bpftrace:master-arm64",
+		},
+		{
+			name:    "bpftrace release",
+			version: "v0.9.4",
+			arch:    "amd64",
+			want:    "quay.io/fntlnz/kubectl-trace-bpftrace:bpftrace-v0.9.4",
+		},
+		{
+			name:    "bpftrace release of another architecture",
+			version: "v0.9.4",
+			arch:    "arm64",
+			want:    "quay.io/fntlnz/kubectl-trace-bpftrace:bpftrace-v0.9.4-arm64",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ImageNameTagForBpftrace(tt.version, tt.arch); got != tt.want {
+				t.Errorf("ImageNameTagForBpftrace() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Package nodepolicy tells whether a node may be traced, by lists of nodes
+// allowed or denied by name or by labels, for the nodes that must not be traced
+// by accident.
+package nodepolicy
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// entry is a node of a list, matched by name or by labels.
+type entry struct {
+	pattern  string
+	selector labels.Selector
+}
+
+// matches tells whether the node matches the entry.
+func (e entry) matches(name string, set map[string]string) bool {
+	if e.selector != nil {
+		return e.selector.Matches(labels.Set(set))
+	}
+	ok, _ := path.Match(e.pattern, name)
+	return ok
+}
+
+// Policy is the nodes allowed and denied. A denied node may not be traced, nor
+// may the nodes matching no allowed node when some are.
+type Policy struct {
+	allow []entry
+	deny  []entry
+}
+
+// New provides the policy of the allowed and denied nodes. Each node is either a
+// name, which may have the wildcards of path.Match like ip-10-0-*, or a label
+// selector like node-role.kubernetes.io/production or env in (prod, staging).
+func New(allow, deny []string) (*Policy, error) {
+	p := &Policy{}
+	var err error
+	if p.allow, err = parse(allow); err != nil {
+		return nil, err
+	}
+	if p.deny, err = parse(deny); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func parse(nodes []string) ([]entry, error) {
+	entries := []entry{}
+	for _, n := range nodes {
+		n = strings.TrimSpace(n)
+		if len(n) == 0 {
+			continue
+		}
+		// Names of nodes never have these, label selectors are told by them or
+		// by a prefix ending with a slash
+		if strings.ContainsAny(n, "=!() ") || strings.Contains(n, "/") {
+			selector, err := labels.Parse(n)
+			if err != nil {
+				return nil, fmt.Errorf("invalid node label selector %s: %v", n, err)
+			}
+			entries = append(entries, entry{selector: selector})
+			continue
+		}
+		if _, err := path.Match(n, ""); err != nil {
+			return nil, fmt.Errorf("invalid node name %s: %v", n, err)
+		}
+		entries = append(entries, entry{pattern: n})
+	}
+	return entries, nil
+}
+
+// Check provides why the node of the name and the labels may not be traced, or
+// an empty string when it may.
+func (p *Policy) Check(name string, set map[string]string) string {
+	for _, e := range p.deny {
+		if e.matches(name, set) {
+			return "denied"
+		}
+	}
+	if len(p.allow) == 0 {
+		return ""
+	}
+	for _, e := range p.allow {
+		if e.matches(name, set) {
+			return ""
+		}
+	}
+	return "not allowed"
+}
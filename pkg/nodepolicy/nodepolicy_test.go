@@ -0,0 +1,48 @@
+package nodepolicy
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	prod := map[string]string{"env": "prod", "node-role.kubernetes.io/db": ""}
+	staging := map[string]string{"env": "staging"}
+
+	tests := []struct {
+		name   string
+		allow  []string
+		deny   []string
+		node   string
+		labels map[string]string
+		want   string
+	}{
+		{name: "no policy", node: "n1", labels: prod},
+		{name: "denied by name", deny: []string{"n1"}, node: "n1", want: "denied"},
+		{name: "denied by wildcard", deny: []string{"ip-10-0-*"}, node: "ip-10-0-1-2", want: "denied"},
+		{name: "other name", deny: []string{"n1"}, node: "n2"},
+		{name: "denied by label", deny: []string{"env=prod"}, node: "n1", labels: prod, want: "denied"},
+		{name: "denied by label key", deny: []string{"node-role.kubernetes.io/db"}, node: "n1", labels: prod, want: "denied"},
+		{name: "other labels", deny: []string{"env in (prod)"}, node: "n1", labels: staging},
+		{name: "allowed", allow: []string{"env=staging"}, node: "n1", labels: staging},
+		{name: "not allowed", allow: []string{"env=staging", "n2"}, node: "n1", labels: prod, want: "not allowed"},
+		{name: "denied though allowed", allow: []string{"n*"}, deny: []string{"env!=staging"}, node: "n1", labels: prod, want: "denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(tt.allow, tt.deny)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Check(tt.node, tt.labels); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, n := range []string{"env in (prod", "ip-[10"} {
+		if _, err := New(nil, []string{n}); err == nil {
+			t.Errorf("expected an error for %s", n)
+		}
+	}
+}
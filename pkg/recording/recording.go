@@ -0,0 +1,91 @@
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+)
+
+// TimeFormat is the format of the timestamp starting each line of a recording.
+const TimeFormat = time.RFC3339Nano
+
+const invalidLineErr = "invalid recording line %d: %s"
+
+// Recorder writes the output of a trace line by line, each line prefixed
+// with the time it started to be written at.
+type Recorder struct {
+	w       io.Writer
+	line    bytes.Buffer
+	started time.Time
+	now     func() time.Time
+}
+
+// NewRecorder provides a Recorder writing the recording to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		w:   w,
+		now: time.Now,
+	}
+}
+
+func (r *Recorder) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if r.line.Len() == 0 {
+			r.started = r.now()
+		}
+		r.line.WriteByte(b)
+		if b == '\n' {
+			if err := r.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// Close records the last line, even when it does not end yet.
+func (r *Recorder) Close() error {
+	if r.line.Len() == 0 {
+		return nil
+	}
+	r.line.WriteByte('\n')
+	return r.flush()
+}
+
+func (r *Recorder) flush() error {
+	_, err := fmt.Fprintf(r.w, "%s %s", r.started.UTC().Format(TimeFormat), r.line.Bytes())
+	r.line.Reset()
+	return err
+}
+
+// Replay writes the lines of a recording to w, waiting between them as long
+// as when they were recorded divided by speed. A zero speed does not wait.
+func Replay(r io.Reader, w io.Writer, speed float64) error {
+	return replay(r, w, speed, time.Sleep)
+}
+
+func replay(r io.Reader, w io.Writer, speed float64, sleep func(time.Duration)) error {
+	var previous time.Time
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; s.Scan(); n++ {
+		parts := strings.SplitN(s.Text(), " ", 2)
+		at, err := time.Parse(TimeFormat, parts[0])
+		if err != nil || len(parts) != 2 {
+			return fmt.Errorf(i18n.T(invalidLineErr), n, s.Text())
+		}
+		if speed > 0 && !previous.IsZero() && at.After(previous) {
+			sleep(time.Duration(float64(at.Sub(previous)) / speed))
+		}
+		previous = at
+		if _, err := fmt.Fprintln(w, parts[1]); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
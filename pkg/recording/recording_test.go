@@ -0,0 +1,49 @@
+package recording
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordReplay(t *testing.T) {
+	start := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := start
+	var recorded bytes.Buffer
+	r := NewRecorder(&recorded)
+	r.now = func() time.Time { return now }
+
+	r.Write([]byte("Attaching 1 probe...\n@rea"))
+	now = now.Add(2 * time.Second)
+	r.Write([]byte("ds: 12\n"))
+	r.Write([]byte("done"))
+	r.Close()
+
+	want := "2019-01-02T03:04:05Z Attaching 1 probe...\n" +
+		"2019-01-02T03:04:05Z @reads: 12\n" +
+		"2019-01-02T03:04:07Z done\n"
+	if recorded.String() != want {
+		t.Fatalf("recorded %q, want %q", recorded.String(), want)
+	}
+
+	var out bytes.Buffer
+	sleeps := []time.Duration{}
+	err := replay(&recorded, &out, 2, func(d time.Duration) { sleeps = append(sleeps, d) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "Attaching 1 probe...\n@reads: 12\ndone\n" {
+		t.Errorf("replayed %q", out.String())
+	}
+	if !reflect.DeepEqual(sleeps, []time.Duration{time.Second}) {
+		t.Errorf("slept %v, want 1s", sleeps)
+	}
+}
+
+func TestReplayInvalid(t *testing.T) {
+	err := replay(bytes.NewBufferString("not a recording\n"), &bytes.Buffer{}, 1, func(time.Duration) {})
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
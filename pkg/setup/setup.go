@@ -0,0 +1,164 @@
+// Package setup provides the objects the trace jobs need to run in a cluster:
+// the service account of their pods, allowed to run privileged pods by the
+// pod security policy or the OpenShift security context constraints of the
+// cluster when it enforces them.
+package setup
+
+import (
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DefaultName is the name of the objects of the setup.
+const DefaultName = "kubectl-trace"
+
+// SecurityContextConstraintsResource is the resource of the security context
+// constraints of OpenShift, telling the clusters enforcing them.
+var SecurityContextConstraintsResource = schema.GroupVersionResource{
+	Group:    "security.openshift.io",
+	Version:  "v1",
+	Resource: "securitycontextconstraints",
+}
+
+// Options are what the setup is made of.
+type Options struct {
+	// Name is the name of the service account and of the cluster wide objects.
+	Name string
+	// Namespace is the namespace of the service account, where the traces run.
+	Namespace string
+	// PodSecurityPolicy grants the service account a privileged pod security policy.
+	PodSecurityPolicy bool
+	// SecurityContextConstraints grants the service account privileged security
+	// context constraints, on OpenShift.
+	SecurityContextConstraints bool
+}
+
+// Objects provides the objects of the setup: the service account, then the
+// objects allowing it to run privileged pods if any, along with the cluster
+// role granting their use and its binding to the service account.
+func Objects(o Options) []runtime.Object {
+	labels := map[string]string{"app.kubernetes.io/name": DefaultName}
+	objs := []runtime.Object{
+		&apiv1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      o.Name,
+				Namespace: o.Namespace,
+				Labels:    labels,
+			},
+		},
+	}
+
+	if o.SecurityContextConstraints {
+		objs = append(objs, securityContextConstraints(o.Name, o.Namespace, labels))
+	}
+
+	rules := []rbacv1.PolicyRule{}
+	if o.PodSecurityPolicy {
+		objs = append(objs, podSecurityPolicy(o.Name, labels))
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups:     []string{policyv1beta1.GroupName},
+			Resources:     []string{"podsecuritypolicies"},
+			ResourceNames: []string{o.Name},
+			Verbs:         []string{"use"},
+		})
+	}
+	if len(rules) == 0 {
+		return objs
+	}
+
+	return append(objs,
+		&rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   o.Name,
+				Labels: labels,
+			},
+			Rules: rules,
+		},
+		&rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   o.Name,
+				Labels: labels,
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "ClusterRole",
+				Name:     o.Name,
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind:      rbacv1.ServiceAccountKind,
+					Name:      o.Name,
+					Namespace: o.Namespace,
+				},
+			},
+		},
+	)
+}
+
+// podSecurityPolicy allows what the trace pods need: privileged containers in
+// the host PID and network namespaces, with host paths for the kernel
+// sources, debugfs and the like.
+func podSecurityPolicy(name string, labels map[string]string) *policyv1beta1.PodSecurityPolicy {
+	return &policyv1beta1.PodSecurityPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Spec: policyv1beta1.PodSecurityPolicySpec{
+			Privileged:          true,
+			HostPID:             true,
+			HostNetwork:         true,
+			AllowedCapabilities: []apiv1.Capability{policyv1beta1.AllowAllCapabilities},
+			Volumes:             []policyv1beta1.FSType{policyv1beta1.All},
+			RunAsUser: policyv1beta1.RunAsUserStrategyOptions{
+				Rule: policyv1beta1.RunAsUserStrategyRunAsAny,
+			},
+			SELinux: policyv1beta1.SELinuxStrategyOptions{
+				Rule: policyv1beta1.SELinuxStrategyRunAsAny,
+			},
+			SupplementalGroups: policyv1beta1.SupplementalGroupsStrategyOptions{
+				Rule: policyv1beta1.SupplementalGroupsStrategyRunAsAny,
+			},
+			FSGroup: policyv1beta1.FSGroupStrategyOptions{
+				Rule: policyv1beta1.FSGroupStrategyRunAsAny,
+			},
+		},
+	}
+}
+
+// securityContextConstraints allow the same as the pod security policy, for the
+// service account listed as their user.
+func securityContextConstraints(name, namespace string, labels map[string]string) *unstructured.Unstructured {
+	runAsAny := map[string]interface{}{"type": "RunAsAny"}
+	u := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"allowPrivilegedContainer": true,
+			"allowPrivilegeEscalation": true,
+			"allowHostPID":             true,
+			"allowHostNetwork":         true,
+			"allowHostDirVolumePlugin": true,
+			"allowHostIPC":             false,
+			"allowHostPorts":           false,
+			"readOnlyRootFilesystem":   false,
+			"allowedCapabilities":      []interface{}{"*"},
+			"volumes":                  []interface{}{"*"},
+			"runAsUser":                runAsAny,
+			"seLinuxContext":           runAsAny,
+			"fsGroup":                  runAsAny,
+			"supplementalGroups":       runAsAny,
+			"users":                    []interface{}{fmt.Sprintf("system:serviceaccount:%s:%s", namespace, name)},
+		},
+	}
+	u.SetAPIVersion(SecurityContextConstraintsResource.GroupVersion().String())
+	u.SetKind("SecurityContextConstraints")
+	u.SetName(name)
+	u.SetLabels(labels)
+	return u
+}
@@ -0,0 +1,46 @@
+package setup
+
+import (
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestObjects(t *testing.T) {
+	objs := Objects(Options{Name: DefaultName, Namespace: "tracing"})
+	if len(objs) != 1 {
+		t.Fatalf("expected only the service account without pod security policy, got %d objects", len(objs))
+	}
+	if sa, ok := objs[0].(*apiv1.ServiceAccount); !ok || sa.Namespace != "tracing" {
+		t.Fatalf("expected the service account in tracing, got %#v", objs[0])
+	}
+
+	objs = Objects(Options{Name: DefaultName, Namespace: "tracing", PodSecurityPolicy: true})
+	if len(objs) != 4 {
+		t.Fatalf("expected 4 objects with a pod security policy, got %d", len(objs))
+	}
+	if psp, ok := objs[1].(*policyv1beta1.PodSecurityPolicy); !ok || !psp.Spec.Privileged || !psp.Spec.HostPID {
+		t.Fatalf("expected a privileged pod security policy, got %#v", objs[1])
+	}
+	role := objs[2].(*rbacv1.ClusterRole)
+	if r := role.Rules[0]; r.Verbs[0] != "use" || r.ResourceNames[0] != DefaultName {
+		t.Fatalf("expected the use of the pod security policy, got %#v", r)
+	}
+	binding := objs[3].(*rbacv1.ClusterRoleBinding)
+	if s := binding.Subjects[0]; s.Name != DefaultName || s.Namespace != "tracing" {
+		t.Fatalf("expected the service account bound, got %#v", s)
+	}
+
+	objs = Objects(Options{Name: DefaultName, Namespace: "tracing", SecurityContextConstraints: true})
+	if len(objs) != 2 {
+		t.Fatalf("expected the service account and its security context constraints, got %d objects", len(objs))
+	}
+	scc := objs[1].(*unstructured.Unstructured)
+	users, _, _ := unstructured.NestedStringSlice(scc.Object, "users")
+	if scc.GetKind() != "SecurityContextConstraints" || len(users) != 1 || users[0] != "system:serviceaccount:tracing:kubectl-trace" {
+		t.Fatalf("expected security context constraints for the service account, got %#v", scc.Object)
+	}
+}
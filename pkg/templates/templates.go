@@ -0,0 +1,28 @@
+// Package templates normalizes the descriptions and the examples of the
+// commands, once translated, like kubectl does.
+package templates
+
+import "strings"
+
+// exampleIndent is the indentation of the lines of the examples.
+const exampleIndent = "  "
+
+// LongDesc normalizes the long description of a command.
+func LongDesc(s string) string {
+	return strings.TrimSpace(s)
+}
+
+// Examples normalizes the examples of a command, every line being indented.
+func Examples(s string) string {
+	lines := strings.Split(strings.Trim(s, "\n"), "\n")
+	for i, l := range lines {
+		if len(strings.TrimSpace(l)) == 0 {
+			lines[i] = ""
+			continue
+		}
+		if !strings.HasPrefix(l, exampleIndent) {
+			lines[i] = exampleIndent + strings.TrimLeft(l, " \t")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,11 @@
+package templates
+
+import "testing"
+
+func TestExamples(t *testing.T) {
+	got := Examples("\n  # Get all traces\n  kubectl trace get -A\n\n# Translated without indent\nkubectl trace get\n")
+	want := "  # Get all traces\n  kubectl trace get -A\n\n  # Translated without indent\n  kubectl trace get"
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,163 @@
+// Package top aggregates the maps periodically printed by bpftrace into a table
+// of their latest values, to be refreshed in place.
+package top
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+const (
+	// SortByValue sorts the rows by decreasing value.
+	SortByValue = "value"
+	// SortByKey sorts the rows by map and key.
+	SortByKey = "key"
+)
+
+// Sorts are the orders the rows can be sorted in.
+var Sorts = []string{SortByValue, SortByKey}
+
+var (
+	// mapLine is a value of a map as printed by bpftrace, e.g. @bytes[nginx]: 12
+	mapLine = regexp.MustCompile(`^(@[A-Za-z0-9_]*)(?:\[(.*)\])?:\s*(.*)$`)
+	// number is the first number of a value, the count of stats
+	number = regexp.MustCompile(`-?[0-9]+(\.[0-9]+)?`)
+)
+
+// Row is the latest value of a key of a map.
+type Row struct {
+	Map   string
+	Key   string
+	Value string
+	// number is what the row is sorted by, the first number of its value
+	number float64
+}
+
+// Options selects and sorts the rows of the table.
+type Options struct {
+	// Sort is SortByValue or SortByKey.
+	Sort string
+	// Map only keeps the rows of the map when set, with or without its @.
+	Map string
+	// Filter only keeps the rows whose map and key, e.g. @bytes[nginx], match.
+	Filter *regexp.Regexp
+}
+
+// Table holds the latest values of the maps written to it.
+type Table struct {
+	mu   sync.Mutex
+	maps map[string]map[string]Row
+	// last is the map of the previous line, a line of another map starts a new
+	// dump of its map
+	last    string
+	partial []byte
+}
+
+// NewTable provides an instance of Table without any map.
+func NewTable() *Table {
+	return &Table{
+		maps: map[string]map[string]Row{},
+	}
+}
+
+// Write updates the table with the complete lines of p, the output of bpftrace.
+func (t *Table) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.partial = append(t.partial, p...)
+	for {
+		i := strings.IndexByte(string(t.partial), '\n')
+		if i < 0 {
+			break
+		}
+		t.update(string(t.partial[:i]))
+		t.partial = t.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// update updates the table with a line, each dump of a map replacing the
+// previous one so that the keys cleared since are gone.
+func (t *Table) update(line string) {
+	m := mapLine.FindStringSubmatch(strings.TrimRight(line, "\r"))
+	// Histograms start with a line without value, their buckets are not rows
+	if m == nil || len(m[3]) == 0 {
+		t.last = ""
+		return
+	}
+
+	name, key, value := m[1], m[2], m[3]
+	if name != t.last {
+		t.maps[name] = map[string]Row{}
+		t.last = name
+	}
+	n, _ := strconv.ParseFloat(number.FindString(value), 64)
+	t.maps[name][key] = Row{Map: name, Key: key, Value: value, number: n}
+}
+
+// Rows provides the rows selected by the options, sorted accordingly.
+func (t *Table) Rows(o Options) []Row {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	mapName := o.Map
+	if len(mapName) > 0 && !strings.HasPrefix(mapName, "@") {
+		mapName = "@" + mapName
+	}
+	rows := []Row{}
+	for name, keys := range t.maps {
+		if len(mapName) > 0 && name != mapName {
+			continue
+		}
+		for _, r := range keys {
+			if o.Filter != nil && !o.Filter.MatchString(r.name()) {
+				continue
+			}
+			rows = append(rows, r)
+		}
+	}
+
+	byKey := func(i, j int) bool {
+		if rows[i].Map != rows[j].Map {
+			return rows[i].Map < rows[j].Map
+		}
+		return rows[i].Key < rows[j].Key
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if o.Sort != SortByKey && rows[i].number != rows[j].number {
+			return rows[i].number > rows[j].number
+		}
+		return byKey(i, j)
+	})
+	return rows
+}
+
+// name provides the map and the key of the row as bpftrace prints them.
+func (r Row) name() string {
+	if len(r.Key) == 0 {
+		return r.Map
+	}
+	return fmt.Sprintf("%s[%s]", r.Map, r.Key)
+}
+
+// Render writes the rows as a table, at most limit of them if limit is
+// positive.
+func Render(w io.Writer, rows []Row, limit int) error {
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "MAP\tKEY\tVALUE")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Map, r.Key, r.Value)
+	}
+	return tw.Flush()
+}
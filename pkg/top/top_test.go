@@ -0,0 +1,96 @@
+package top
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func TestTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		writes  []string
+		options Options
+		want    string
+	}{
+		{
+			name:   "sorted by value",
+			writes: []string{"@bytes[nginx]: 12\r\n@bytes[curl]: 40\n@bytes[sh]: 3\n"},
+			want: "MAP     KEY    VALUE\n" +
+				"@bytes  curl   40\n" +
+				"@bytes  nginx  12\n" +
+				"@bytes  sh     3\n",
+		},
+		{
+			name:    "sorted by key",
+			writes:  []string{"@bytes[nginx]: 12\n@bytes[curl]: 40\n@: 7\n"},
+			options: Options{Sort: SortByKey},
+			want: "MAP     KEY    VALUE\n" +
+				"@              7\n" +
+				"@bytes  curl   40\n" +
+				"@bytes  nginx  12\n",
+		},
+		{
+			name: "new dump replaces the previous one",
+			writes: []string{
+				"@bytes[nginx]: 12\n@bytes[curl]: 40\n\n",
+				"12:03:01\n@bytes[ng", "inx]: 20\n\n",
+			},
+			want: "MAP     KEY    VALUE\n" +
+				"@bytes  nginx  20\n",
+		},
+		{
+			name: "maps kept apart",
+			writes: []string{
+				"@reads[1, nginx]: 2\n\n@writes[nginx]: 5\n\n",
+				"@writes[curl]: 1\n",
+			},
+			want: "MAP      KEY       VALUE\n" +
+				"@reads   1, nginx  2\n" +
+				"@writes  curl      1\n",
+		},
+		{
+			name:    "map and filter",
+			writes:  []string{"@reads[nginx]: 2\n@reads[curl]: 3\n\n@writes[nginx]: 5\n"},
+			options: Options{Map: "reads", Filter: regexp.MustCompile(`ngi`)},
+			want: "MAP     KEY    VALUE\n" +
+				"@reads  nginx  2\n",
+		},
+		{
+			name:   "stats and histograms",
+			writes: []string{"@lat:\n[1, 2)  3 |@@@@|\n\n@stats[read]: count 4, average 10, total 40\n@stats[write]: count 9, average 1, total 9\n"},
+			want: "MAP     KEY    VALUE\n" +
+				"@stats  write  count 9, average 1, total 9\n" +
+				"@stats  read   count 4, average 10, total 40\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := NewTable()
+			for _, w := range tt.writes {
+				table.Write([]byte(w))
+			}
+			var b bytes.Buffer
+			if err := Render(&b, table.Rows(tt.options), 0); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderLimit(t *testing.T) {
+	table := NewTable()
+	table.Write([]byte("@[a]: 1\n@[b]: 2\n@[c]: 3\n"))
+	var b bytes.Buffer
+	Render(&b, table.Rows(Options{}), 2)
+	want := "MAP  KEY  VALUE\n" +
+		"@    c    3\n" +
+		"@    b    2\n"
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
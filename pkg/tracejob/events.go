@@ -0,0 +1,80 @@
+package tracejob
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// Reasons of the events recorded on the trace jobs along their lifecycle.
+const (
+	EventReasonCreated   = "TraceCreated"
+	EventReasonStarted   = "TraceStarted"
+	EventReasonCompleted = "TraceCompleted"
+	EventReasonFailed    = "TraceFailed"
+)
+
+// eventComponent is the source of the events recorded on the trace jobs.
+const eventComponent = "kubectl-trace"
+
+// RecordEvent records an event on an object of a trace job, once per reason so
+// that the lifecycle of the trace is told once whoever observes it. Nothing is
+// recorded without an EventClient.
+func (t *TraceJobClient) RecordEvent(ctx context.Context, obj metav1.ObjectMeta, kind, apiVersion, eventType, reason, message string) error {
+	if t.EventClient == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	el, err := t.EventClient.List(metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.uid": string(obj.UID),
+			"reason":             reason,
+		}.AsSelector().String(),
+	})
+	if err != nil {
+		return err
+	}
+	if len(el.Items) > 0 || ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	now := metav1.Now()
+	_, err = t.EventClient.Create(&apiv1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: obj.Name + ".",
+			Namespace:    obj.Namespace,
+		},
+		InvolvedObject: apiv1.ObjectReference{
+			Kind:            kind,
+			APIVersion:      apiVersion,
+			Name:            obj.Name,
+			Namespace:       obj.Namespace,
+			UID:             obj.UID,
+			ResourceVersion: obj.ResourceVersion,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         apiv1.EventSource{Component: eventComponent},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	})
+	return err
+}
+
+// EventMessage describes a transition of the trace job of an object, along
+// with who requested it when known, e.g. "trace ID started (requested by alice)".
+func EventMessage(obj metav1.ObjectMeta, transition string) string {
+	message := fmt.Sprintf("trace %s %s", obj.Labels[meta.TraceIDLabelKey], transition)
+	if user, ok := obj.Annotations[meta.RequestedByAnnotationKey]; ok {
+		message += fmt.Sprintf(" (requested by %s)", user)
+	}
+	return message
+}
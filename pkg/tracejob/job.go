@@ -1,32 +1,330 @@
 package tracejob
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
 	"fmt"
+	"time"
+	"unicode/utf8"
 
 	"io"
 	"io/ioutil"
+	"strings"
+	"sync"
 
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
 	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	"github.com/golang/glog"
 	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/watch"
 	batchv1typed "k8s.io/client-go/kubernetes/typed/batch/v1"
+	batchv1beta1typed "k8s.io/client-go/kubernetes/typed/batch/v1beta1"
 	corev1typed "k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
+// TraceJobClient manages the trace jobs through its clients. Its methods stop
+// between their requests once their context is done, the requests in flight
+// are aborted too when the clients are made from a config bound to the context
+// with factory.WithContext.
 type TraceJobClient struct {
-	JobClient    batchv1typed.JobInterface
-	ConfigClient corev1typed.ConfigMapInterface
-	outStream    io.Writer
+	JobClient     batchv1typed.JobInterface
+	CronJobClient batchv1beta1typed.CronJobInterface
+	ConfigClient  corev1typed.ConfigMapInterface
+	// PodClient is optional, it provides the reasons of the failures of trace pods
+	// and deletes the pods left by trace jobs deleted without cascading.
+	PodClient corev1typed.PodInterface
+	// ServiceClient is optional, it creates the Service exposing the metrics of
+	// the trace jobs having a metrics port.
+	ServiceClient corev1typed.ServiceInterface
+	// SecretClient is optional, it creates and deletes the Secrets holding the
+	// programs of the trace jobs having ProgramSecret.
+	SecretClient corev1typed.SecretInterface
+	// EventClient is optional, it records the lifecycle of the trace jobs as
+	// events on their jobs.
+	EventClient corev1typed.EventInterface
+	// DeletePropagation is how the pods of deleted trace jobs are deleted,
+	// before the trace jobs themselves when empty.
+	DeletePropagation metav1.DeletionPropagation
+	outStream         io.Writer
 }
 
+// Tracer is the tracing tool executed by the trace-runner in the trace job.
+type Tracer string
+
+const (
+	// BpftraceTracer executes a bpftrace program.
+	BpftraceTracer Tracer = "bpftrace"
+	// PerfTracer samples the stacks of the whole node using perf.
+	PerfTracer Tracer = "perf"
+	// PyspyTracer samples the stacks of a Python interpreter using py-spy.
+	PyspyTracer Tracer = "pyspy"
+	// RbspyTracer samples the stacks of a Ruby interpreter using rbspy.
+	RbspyTracer Tracer = "rbspy"
+	// TcTracer attaches a compiled BPF object to a network interface as a tc classifier.
+	TcTracer Tracer = "tc"
+	// XDPTracer attaches a compiled BPF object to a network interface as an XDP program.
+	XDPTracer Tracer = "xdp"
+	// CommandTracer runs the command given as arguments, e.g. a tracing binary of a custom image.
+	CommandTracer Tracer = "command"
+)
+
+const (
+	// DirectionIngress makes tc programs see the traffic received by the interface.
+	DirectionIngress = "ingress"
+	// DirectionEgress makes tc programs see the traffic sent by the interface.
+	DirectionEgress = "egress"
+)
+
+// OutputFormatJSON makes bpftrace print its events as JSON lines.
+const OutputFormatJSON = "json"
+
+// deadlineGracePeriod is how long a trace job can outlive its duration
+// before being killed, so that the tracer can report what it collected.
+const deadlineGracePeriod = time.Minute
+
+// IDLength is the length of the trace job IDs, which are UUIDs.
+const IDLength = len("1bb3ae39-efe8-11e8-9f29-8c164500a77e")
+
+// DefaultTTL is how long finished trace jobs are kept, so that their output
+// can still be read, when their TTL is not set.
+const DefaultTTL = time.Hour
+
+// DefaultBackoffLimit is how many times a failed tracer is retried when the
+// backoff limit of the trace job is not set.
+const DefaultBackoffLimit = 1
+
+// DefaultMemlock is the RLIMIT_MEMLOCK of the tracer when the one of the trace
+// job is not set and the tracer can raise it, the maps of BPF programs count
+// against it on kernels accounting them to the locked memory rather than to
+// the memory cgroup.
+const DefaultMemlock = "unlimited"
+
+// appArmorAnnotationKeyPrefix is the prefix of the annotation declaring
+// the AppArmor profile of a container, followed by the container name.
+const appArmorAnnotationKeyPrefix = "container.apparmor.security.beta.kubernetes.io/"
+
+// ReservedVolumes are the names of the volumes a trace pod can have.
+var ReservedVolumes = []string{"program", "modules", "usrsrc", "sys", "headers", "hostetc", "metrics", ResultsVolume}
+
+// ResultsVolume is the name of the volume of the claim the results are saved to.
+const ResultsVolume = "results"
+
+// ResultsPath is where the results of the traces are saved, in a directory
+// named after their ID.
+const ResultsPath = "/results"
+
+// ProgramKey is the key of the program in its ConfigMap, CompressedProgramKey
+// the key of the gzipped program when it is too large to be stored as is.
+const (
+	ProgramKey           = "program.bt"
+	CompressedProgramKey = ProgramKey + ".gz"
+)
+
+// maxProgramSize is the size programs are compressed above, and the size they
+// cannot exceed once compressed. It leaves room for the metadata of the ConfigMap
+// within the 1MiB limit of the objects stored by the API server.
+const maxProgramSize = 900 * 1024
+
+const (
+	programSizeErrString  = "the program is %d bytes once compressed, more than the %d bytes it can have to fit in a ConfigMap"
+	secretClientErrString = "no client to create the Secret holding the program"
+)
+
+// headersPath is where the fetched kernel headers are mounted.
+const headersPath = "/kheaders"
+
+// metricsPath is where the tracer shares its output with the metrics exporter.
+const metricsPath = "/metrics-data"
+
+// Tracers lists all the tracers supported by the trace-runner.
+var Tracers = []Tracer{BpftraceTracer, PerfTracer, PyspyTracer, RbspyTracer, TcTracer, XDPTracer, CommandTracer}
+
+// IsProfiler tells whether the tracer samples stacks for a duration instead of executing a program.
+func (t Tracer) IsProfiler() bool {
+	return t == PerfTracer || t == PyspyTracer || t == RbspyTracer
+}
+
+// TargetsProcess tells whether the tracer needs the process of a container to profile.
+func (t Tracer) TargetsProcess() bool {
+	return t == PyspyTracer || t == RbspyTracer
+}
+
+// IsNetwork tells whether the tracer attaches a compiled BPF object to a network
+// interface instead of executing a bpftrace program.
+func (t Tracer) IsNetwork() bool {
+	return t == TcTracer || t == XDPTracer
+}
+
+// TraceJobStatus is the status of a trace job, as reported by get.
+type TraceJobStatus string
+
+const (
+	// TraceJobStatusCreated means the trace pod has not started yet.
+	TraceJobStatusCreated TraceJobStatus = "Created"
+	// TraceJobStatusRunning means the trace is running.
+	TraceJobStatusRunning TraceJobStatus = "Running"
+	// TraceJobStatusCompleted means the trace ran until its end.
+	TraceJobStatusCompleted TraceJobStatus = "Completed"
+	// TraceJobStatusFailed means the trace failed.
+	TraceJobStatusFailed TraceJobStatus = "Failed"
+	// TraceJobStatusScheduled means the trace runs on a schedule.
+	TraceJobStatusScheduled TraceJobStatus = "Scheduled"
+	// TraceJobStatusSuspended means the scheduled trace is suspended.
+	TraceJobStatusSuspended TraceJobStatus = "Suspended"
+	// TraceJobStatusDeleted means the trace job has been deleted while being watched.
+	TraceJobStatusDeleted TraceJobStatus = "Deleted"
+)
+
 type TraceJob struct {
-	Name      string
-	ID        types.UID
-	Namespace string
-	Hostname  string
-	Program   string
+	Name      string    `json:"-"`
+	ID        types.UID `json:"-"`
+	Namespace string    `json:"-"`
+	Hostname  string    `json:"hostname"`
+	Program   string    `json:"program,omitempty"`
+	// Args are the positional parameters of the program, or the command of the
+	// command tracer.
+	Args   []string `json:"args,omitempty"`
+	Tracer Tracer   `json:"tracer,omitempty"`
+	// Duration is how long the trace runs, it runs until deleted when zero.
+	Duration metav1.Duration `json:"duration,omitempty"`
+	// ContainerID is the runtime ID of the container targeted by the trace, if any.
+	ContainerID string `json:"containerID,omitempty"`
+	// CgroupFilter scopes the probes of the program to the cgroup of the
+	// container or of the unit, so that the trace only sees its activity.
+	CgroupFilter bool `json:"cgroupFilter,omitempty"`
+	// Unit is the node service targeted by the trace, if any, a systemd unit
+	// like kubelet or the command name of its processes.
+	Unit string `json:"unit,omitempty"`
+	// Interface is the network interface of the node network tracers attach to,
+	// the host side of the interface of the targeted container when empty.
+	Interface string `json:"interface,omitempty"`
+	// Direction is the traffic seen by tc programs, DirectionIngress when empty
+	// or DirectionEgress.
+	Direction string `json:"direction,omitempty"`
+	// Section is the ELF section of the program of network tracers, the iproute2
+	// default when empty.
+	Section string `json:"section,omitempty"`
+	// TargetPod is the name of the pod targeted by the trace, if any.
+	TargetPod string `json:"targetPod,omitempty"`
+	// Schedule is the cron schedule of recurring traces.
+	Schedule string `json:"schedule,omitempty"`
+	// TTL is how long the trace job is kept once finished, DefaultTTL when nil
+	// and forever when zero. It requires the TTL controller of the cluster.
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+	// BackoffLimit is how many times a failed tracer is retried, DefaultBackoffLimit
+	// when nil. Every retry attaches the probes again.
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+	// RestartPolicy is the restart policy of the trace pod, Never when empty or
+	// OnFailure to restart the tracer in the same pod.
+	RestartPolicy apiv1.RestartPolicy `json:"restartPolicy,omitempty"`
+	// Memlock is the RLIMIT_MEMLOCK of the tracer, unlimited or a quantity like
+	// 64Mi. When empty it is DefaultMemlock for the tracers having SYS_RESOURCE,
+	// privileged ones included, and the one of the runtime otherwise.
+	Memlock string `json:"memlock,omitempty"`
+	// ImageNameTag is the image running the tracer, meta.ImageNameTag when empty.
+	ImageNameTag string `json:"image,omitempty"`
+	// ImagePullPolicy is the pull policy of the image, the cluster default when empty.
+	ImagePullPolicy apiv1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// ImagePullSecrets are the names of the secrets used to pull the image.
+	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
+	// Resources are the compute resources of the tracer container.
+	Resources apiv1.ResourceRequirements `json:"resources,omitempty"`
+	// ServiceAccount is the service account of the trace pod, the namespace default when empty.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// Tolerations let the trace pod run on tainted nodes.
+	Tolerations []apiv1.Toleration `json:"tolerations,omitempty"`
+	// Capabilities run the tracer container unprivileged with only these capabilities,
+	// it is privileged when empty.
+	Capabilities []apiv1.Capability `json:"capabilities,omitempty"`
+	// RunAsUser is the user running the tracer, the image default when nil.
+	RunAsUser *int64 `json:"runAsUser,omitempty"`
+	// SELinuxType is the SELinux type of the tracer container, the runtime default when empty.
+	SELinuxType string `json:"seLinuxType,omitempty"`
+	// SeccompProfile is the seccomp profile of the trace pod, e.g. runtime/default.
+	SeccompProfile string `json:"seccompProfile,omitempty"`
+	// AppArmorProfile is the AppArmor profile of the tracer container, e.g. runtime/default.
+	AppArmorProfile string `json:"appArmorProfile,omitempty"`
+	// PriorityClassName is the priority class of the trace pod.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// HostPID runs the trace pod in the host PID namespace, traces of containers always do.
+	HostPID bool `json:"hostPID,omitempty"`
+	// HostNetwork runs the trace pod in the host network namespace.
+	HostNetwork bool `json:"hostNetwork,omitempty"`
+	// Restricted runs the trace pod without host namespaces nor host mounts, only
+	// with the Capabilities, for clusters enforcing the Pod Security standards.
+	// The tracer then reads the kernel types from BTF through its own /sys.
+	Restricted bool `json:"restricted,omitempty"`
+	// Volumes are added to the volumes of the trace pod.
+	Volumes []apiv1.Volume `json:"volumes,omitempty"`
+	// VolumeMounts are added to the mounts of the tracer container.
+	VolumeMounts []apiv1.VolumeMount `json:"volumeMounts,omitempty"`
+	// Env is added to the environment of the tracer container.
+	Env []apiv1.EnvVar `json:"env,omitempty"`
+	// Overrides is a JSON merge patch applied to the Job, or to the job template of scheduled traces.
+	Overrides string `json:"overrides,omitempty"`
+	// BTF tells whether the node kernel exposes its types through BTF, in which
+	// case its headers are not needed.
+	BTF bool `json:"btf,omitempty"`
+	// FetchHeaders fetches the kernel headers of the node in an init container,
+	// for nodes having neither headers nor BTF.
+	FetchHeaders bool `json:"fetchHeaders,omitempty"`
+	// HeadersURL is the URL template of the headers archive to download when the
+	// kernel does not provide them, e.g. https://mirror/linux-headers-{{.KernelRelease}}.tar.gz.
+	HeadersURL string `json:"headersURL,omitempty"`
+	// OutputFormat is the output format of bpftrace, text when empty or OutputFormatJSON.
+	OutputFormat string `json:"outputFormat,omitempty"`
+	// MetricsPort is the port an exporter sidecar serves the maps of bpftrace on as
+	// Prometheus metrics, there is no exporter when zero. It implies OutputFormatJSON.
+	MetricsPort int32 `json:"metricsPort,omitempty"`
+	// ResultsClaim is the PersistentVolumeClaim the output and the artifacts of the
+	// tracer are saved to, so that they survive the trace pod.
+	ResultsClaim string `json:"resultsClaim,omitempty"`
+	// UploadURL is the bucket the output and the artifacts of the tracer are
+	// uploaded to when it ends, e.g. s3://BUCKET/PREFIX.
+	UploadURL string `json:"uploadURL,omitempty"`
+	// UploadSecret is the Secret holding the credentials of the upload bucket,
+	// exposed to the tracer as environment variables.
+	UploadSecret string `json:"uploadSecret,omitempty"`
+	// ProgramSecret stores the program in a Secret rather than a ConfigMap, for
+	// programs embedding sensitive paths, tokens or hostnames.
+	ProgramSecret bool `json:"programSecret,omitempty"`
+	// RequestedBy is who requested the trace, annotated on its objects and told
+	// by the events recorded along its lifecycle.
+	RequestedBy string `json:"requestedBy,omitempty"`
+	// NotifyURL is where the trace pod posts a JSON notification when the
+	// tracer completes or fails.
+	NotifyURL string `json:"notifyURL,omitempty"`
+	// Group is the ID shared by the trace jobs created by one invocation, so that
+	// they can be managed as one unit.
+	Group string `json:"group,omitempty"`
+	// Labels and Annotations are added to the objects of the trace, e.g. the team
+	// or the ticket the trace is for. They cannot replace the ones of kubectl-trace.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Check only checks the program can be parsed instead of running it.
+	Check bool `json:"-"`
+	// OwnerReferences are set on all the objects created for the trace.
+	OwnerReferences []metav1.OwnerReference `json:"-"`
+	// Status is the status of an existing trace job.
+	Status TraceJobStatus `json:"-"`
+	// CreationTimestamp is the time an existing trace job was created at.
+	CreationTimestamp metav1.Time `json:"-"`
+	// Reason is why the pod of an existing trace job cannot start or has failed, if so.
+	Reason string `json:"-"`
+	// ExitCode is the exit code of the tracer of an existing trace job once it
+	// ended, the one of its failed runs if any.
+	ExitCode int32 `json:"-"`
 }
 
 // WithOutStream setup a file stream to output trace job operation information
@@ -40,6 +338,10 @@ func (t *TraceJobClient) WithOutStream(o io.Writer) {
 type TraceJobFilter struct {
 	Name *string
 	ID   *types.UID
+	// Group selects the trace jobs created by one invocation.
+	Group string
+	// Selector further selects the trace jobs by their labels.
+	Selector string
 }
 
 func (nf TraceJobFilter) selectorOptions() metav1.ListOptions {
@@ -63,11 +365,21 @@ func (nf TraceJobFilter) selectorOptions() metav1.ListOptions {
 		}
 	}
 
+	if len(nf.Group) > 0 {
+		selectorOptions.LabelSelector += fmt.Sprintf(",%s=%s", meta.TraceGroupLabelKey, nf.Group)
+	}
+
+	if len(nf.Selector) > 0 {
+		selectorOptions.LabelSelector += "," + nf.Selector
+	}
+
 	return selectorOptions
 }
 
-func (t *TraceJobClient) findJobsWithFilter(nf TraceJobFilter) ([]batchv1.Job, error) {
-
+func (t *TraceJobClient) findJobsWithFilter(ctx context.Context, nf TraceJobFilter) ([]batchv1.Job, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	selectorOptions := nf.selectorOptions()
 	if len(selectorOptions.LabelSelector) == 0 {
 		return []batchv1.Job{}, nil
@@ -81,7 +393,27 @@ func (t *TraceJobClient) findJobsWithFilter(nf TraceJobFilter) ([]batchv1.Job, e
 	return jl.Items, nil
 }
 
-func (t *TraceJobClient) findConfigMapsWithFilter(nf TraceJobFilter) ([]apiv1.ConfigMap, error) {
+func (t *TraceJobClient) findCronJobsWithFilter(ctx context.Context, nf TraceJobFilter) ([]batchv1beta1.CronJob, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	selectorOptions := nf.selectorOptions()
+	if len(selectorOptions.LabelSelector) == 0 || t.CronJobClient == nil {
+		return []batchv1beta1.CronJob{}, nil
+	}
+
+	cl, err := t.CronJobClient.List(selectorOptions)
+
+	if err != nil {
+		return nil, err
+	}
+	return cl.Items, nil
+}
+
+func (t *TraceJobClient) findConfigMapsWithFilter(ctx context.Context, nf TraceJobFilter) ([]apiv1.ConfigMap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	selectorOptions := nf.selectorOptions()
 	if len(selectorOptions.LabelSelector) == 0 {
 		return []apiv1.ConfigMap{}, nil
@@ -95,33 +427,63 @@ func (t *TraceJobClient) findConfigMapsWithFilter(nf TraceJobFilter) ([]apiv1.Co
 	return cm.Items, nil
 }
 
-func (t *TraceJobClient) GetJob(nf TraceJobFilter) ([]TraceJob, error) {
+func (t *TraceJobClient) findSecretsWithFilter(ctx context.Context, nf TraceJobFilter) ([]apiv1.Secret, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	selectorOptions := nf.selectorOptions()
+	if len(selectorOptions.LabelSelector) == 0 || t.SecretClient == nil {
+		return []apiv1.Secret{}, nil
+	}
+
+	sl, err := t.SecretClient.List(selectorOptions)
 
-	jl, err := t.findJobsWithFilter(nf)
+	if err != nil {
+		return nil, err
+	}
+	return sl.Items, nil
+}
+
+func (t *TraceJobClient) GetJob(ctx context.Context, nf TraceJobFilter) ([]TraceJob, error) {
+	jl, err := t.findJobsWithFilter(ctx, nf)
+	if err != nil {
+		return nil, err
+	}
+	reasons, exitCodes, err := t.podStatuses(ctx, nf)
 	if err != nil {
 		return nil, err
 	}
 	tjobs := []TraceJob{}
 
 	for _, j := range jl {
-		labels := j.GetLabels()
-		name, ok := labels[meta.TraceLabelKey]
-		if !ok {
-			name = ""
-		}
-		id, ok := labels[meta.TraceIDLabelKey]
-		if !ok {
-			id = ""
-		}
-		hostname, err := jobHostname(j)
+		tj := FromJob(j)
+		tj.Reason = reasons[j.Name]
+		tj.ExitCode = exitCodes[j.Name]
+		tjobs = append(tjobs, tj)
+	}
+
+	cl, err := t.findCronJobsWithFilter(ctx, nf)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range cl {
+		hostname, err := jobHostname(batchv1.Job{Spec: c.Spec.JobTemplate.Spec})
 		if err != nil {
 			hostname = ""
 		}
 		tj := TraceJob{
-			Name:      name,
-			ID:        types.UID(id),
-			Namespace: j.Namespace,
-			Hostname:  hostname,
+			Name:              c.Labels[meta.TraceLabelKey],
+			ID:                types.UID(c.Labels[meta.TraceIDLabelKey]),
+			Namespace:         c.Namespace,
+			Hostname:          hostname,
+			Group:             c.Labels[meta.TraceGroupLabelKey],
+			Schedule:          c.Spec.Schedule,
+			Status:            TraceJobStatusScheduled,
+			CreationTimestamp: c.CreationTimestamp,
+		}
+		if c.Spec.Suspend != nil && *c.Spec.Suspend {
+			tj.Status = TraceJobStatusSuspended
 		}
 		tjobs = append(tjobs, tj)
 	}
@@ -129,19 +491,184 @@ func (t *TraceJobClient) GetJob(nf TraceJobFilter) ([]TraceJob, error) {
 	return tjobs, nil
 }
 
-func (t *TraceJobClient) DeleteJobs(nf TraceJobFilter) error {
+// ResolveIDPrefix completes the filter when its ID is only the prefix of the ID
+// of a trace job, it fails when the IDs of several trace jobs start with it.
+func (t *TraceJobClient) ResolveIDPrefix(ctx context.Context, nf TraceJobFilter) (TraceJobFilter, error) {
+	if nf.ID == nil || len(*nf.ID) >= IDLength {
+		return nf, nil
+	}
+	tjs, err := t.GetJob(ctx, TraceJobFilter{Selector: nf.Selector})
+	if err != nil {
+		return nf, err
+	}
+	var found *types.UID
+	for _, tj := range tjs {
+		if !strings.HasPrefix(string(tj.ID), string(*nf.ID)) {
+			continue
+		}
+		if found != nil && *found != tj.ID {
+			return nf, fmt.Errorf(i18n.T("several traces have an ID starting with %s"), *nf.ID)
+		}
+		id := tj.ID
+		found = &id
+	}
+	if found != nil {
+		nf.ID = found
+	}
+	return nf, nil
+}
+
+// podStatuses provides the failure reasons and the tracer exit codes of the pods
+// of the trace jobs by job name.
+func (t *TraceJobClient) podStatuses(ctx context.Context, nf TraceJobFilter) (map[string]string, map[string]int32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	reasons := map[string]string{}
+	exitCodes := map[string]int32{}
+	if t.PodClient == nil {
+		return reasons, exitCodes, nil
+	}
+	pl, err := t.PodClient.List(nf.selectorOptions())
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, p := range pl.Items {
+		job := p.Labels["job-name"]
+		if reason := PodFailureReason(p); len(reason) > 0 {
+			reasons[job] = reason
+		}
+		// A failed run tells more than the retry succeeding it
+		if code := TracerExitCode(p); code != nil && exitCodes[job] == 0 {
+			exitCodes[job] = *code
+		}
+	}
+	return reasons, exitCodes, nil
+}
+
+// WatchJobs watches the jobs of the trace jobs matching the filter, scheduled
+// trace jobs are not watched but the jobs they spawn are. The watch stops when
+// the context is done.
+func (t *TraceJobClient) WatchJobs(ctx context.Context, nf TraceJobFilter) (watch.Interface, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	w, err := t.JobClient.Watch(nf.selectorOptions())
+	if err != nil {
+		return nil, err
+	}
+	return newContextWatch(ctx, w), nil
+}
+
+// contextWatch is a watch stopped when its context is done.
+type contextWatch struct {
+	watch.Interface
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newContextWatch(ctx context.Context, w watch.Interface) *contextWatch {
+	cw := &contextWatch{
+		Interface: w,
+		stop:      make(chan struct{}),
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			cw.Stop()
+		case <-cw.stop:
+		}
+	}()
+	return cw
+}
+
+func (cw *contextWatch) Stop() {
+	cw.stopOnce.Do(func() {
+		close(cw.stop)
+		cw.Interface.Stop()
+	})
+}
+
+// FromJob reads the trace job running as a job.
+func FromJob(j batchv1.Job) TraceJob {
+	labels := j.GetLabels()
+	hostname, err := jobHostname(j)
+	if err != nil {
+		hostname = ""
+	}
+	return TraceJob{
+		Name:              labels[meta.TraceLabelKey],
+		ID:                types.UID(labels[meta.TraceIDLabelKey]),
+		Namespace:         j.Namespace,
+		Hostname:          hostname,
+		Group:             labels[meta.TraceGroupLabelKey],
+		Status:            jobStatus(j.Status),
+		CreationTimestamp: j.CreationTimestamp,
+	}
+}
+
+func jobStatus(s batchv1.JobStatus) TraceJobStatus {
+	for _, c := range s.Conditions {
+		if c.Status != apiv1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return TraceJobStatusCompleted
+		case batchv1.JobFailed:
+			return TraceJobStatusFailed
+		}
+	}
+	if s.Active > 0 {
+		return TraceJobStatusRunning
+	}
+	return TraceJobStatusCreated
+}
+
+func (t *TraceJobClient) DeleteJobs(ctx context.Context, nf TraceJobFilter) error {
 	nothingDeleted := true
-	jl, err := t.findJobsWithFilter(nf)
+	dp := t.DeletePropagation
+	if len(dp) == 0 {
+		dp = metav1.DeletePropagationForeground
+	}
+
+	// Delete the cron jobs first so that they don't spawn new trace jobs
+	cjl, err := t.findCronJobsWithFilter(ctx, nf)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range cjl {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := t.CronJobClient.Delete(c.Name, &metav1.DeleteOptions{
+			PropagationPolicy: &dp,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(t.outStream, "trace cron job %s deleted\n", c.Name)
+		nothingDeleted = false
+	}
+
+	jl, err := t.findJobsWithFilter(ctx, nf)
 	if err != nil {
 		return err
 	}
 
-	dp := metav1.DeletePropagationForeground
 	for _, j := range jl {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		err := t.JobClient.Delete(j.Name, &metav1.DeleteOptions{
 			GracePeriodSeconds: int64Ptr(0),
 			PropagationPolicy:  &dp,
 		})
+		// Jobs spawned by a cron job might be already gone with it
+		if errors.IsNotFound(err) {
+			continue
+		}
 		if err != nil {
 			return err
 		}
@@ -149,14 +676,20 @@ func (t *TraceJobClient) DeleteJobs(nf TraceJobFilter) error {
 		nothingDeleted = false
 	}
 
-	cl, err := t.findConfigMapsWithFilter(nf)
+	cl, err := t.findConfigMapsWithFilter(ctx, nf)
 
 	if err != nil {
 		return err
 	}
 
 	for _, c := range cl {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		err := t.ConfigClient.Delete(c.Name, nil)
+		if errors.IsNotFound(err) {
+			continue
+		}
 		if err != nil {
 			return err
 		}
@@ -164,7 +697,56 @@ func (t *TraceJobClient) DeleteJobs(nf TraceJobFilter) error {
 		nothingDeleted = false
 	}
 
+	sl, err := t.findSecretsWithFilter(ctx, nf)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sl {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := t.SecretClient.Delete(s.Name, nil)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(t.outStream, "trace secret %s deleted\n", s.Name)
+		nothingDeleted = false
+	}
+
+	// Pods of trace jobs deleted without cascading, e.g. by other tools, are left running
+	if t.PodClient != nil && dp != metav1.DeletePropagationOrphan {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		pl, err := t.PodClient.List(nf.selectorOptions())
+		if err != nil {
+			return err
+		}
+		for _, p := range pl.Items {
+			if metav1.GetControllerOf(&p) != nil || p.DeletionTimestamp != nil {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			err := t.PodClient.Delete(p.Name, &metav1.DeleteOptions{GracePeriodSeconds: int64Ptr(0)})
+			if errors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(t.outStream, "trace pod %s deleted\n", p.Name)
+			nothingDeleted = false
+		}
+	}
+
 	if nothingDeleted {
+		glog.V(2).Infof("no trace resource matches the selector %q", nf.selectorOptions().LabelSelector)
 		fmt.Fprintf(t.outStream, "error: no trace found to be deleted\n")
 	}
 	return nil
@@ -173,115 +755,510 @@ func (t *TraceJobClient) DeleteJobs(nf TraceJobFilter) error {
 // todo(fntlnz): deal with programs that needs the user to send a signal to complete,
 // like how the hist() function does
 // Will likely need to allocate a TTY for this one thing.
-func (t *TraceJobClient) CreateJob(nj TraceJob) (*batchv1.Job, error) {
-	bpfTraceCmd := []string{
-		"bpftrace",
-		"/programs/program.bt",
-	}
-
-	commonMeta := metav1.ObjectMeta{
-		Name:      nj.Name,
-		Namespace: nj.Namespace,
-		Labels: map[string]string{
-			meta.TraceLabelKey:   nj.Name,
-			meta.TraceIDLabelKey: string(nj.ID),
-		},
-		Annotations: map[string]string{
-			meta.TraceLabelKey:   nj.Name,
-			meta.TraceIDLabelKey: string(nj.ID),
+func (t *TraceJobClient) CreateJob(ctx context.Context, nj TraceJob) (*batchv1.Job, error) {
+	program, err := newProgram(nj)
+	if err != nil {
+		return nil, err
+	}
+	job := newJob(nj, nj.Name)
+	if err := applyOverrides(job, nj.Overrides); err != nil {
+		return nil, err
+	}
+
+	program, err = t.createProgram(ctx, program)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	job, err = t.JobClient.Create(job)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := t.ownProgram(ctx, program, batchv1.SchemeGroupVersion.WithKind("Job"), job.ObjectMeta); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Create creates the objects making up the trace job, as listed by Objects,
+// and provides them as populated by the server. It stops between the requests
+// once the context is done.
+func (t *TraceJobClient) Create(ctx context.Context, nj TraceJob) ([]runtime.Object, error) {
+	objs, err := Objects(nj)
+	if err != nil {
+		return nil, err
+	}
+
+	program, err := t.createProgram(ctx, objs[0])
+	if err != nil {
+		return nil, err
+	}
+	glog.V(2).Infof("created the program of trace %s", nj.ID)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var obj runtime.Object
+	var gvk schema.GroupVersionKind
+	var owner metav1.ObjectMeta
+	switch o := objs[1].(type) {
+	case *batchv1beta1.CronJob:
+		var cj *batchv1beta1.CronJob
+		cj, err = t.CronJobClient.Create(o)
+		if err == nil {
+			obj, gvk, owner = cj, batchv1beta1.SchemeGroupVersion.WithKind("CronJob"), cj.ObjectMeta
+			program, err = t.ownProgram(ctx, program, gvk, owner)
+		}
+	case *batchv1.Job:
+		var job *batchv1.Job
+		job, err = t.JobClient.Create(o)
+		if err == nil {
+			obj, gvk, owner = job, batchv1.SchemeGroupVersion.WithKind("Job"), job.ObjectMeta
+			program, err = t.ownProgram(ctx, program, gvk, owner)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	glog.V(2).Infof("created %s %s of trace %s", gvk.Kind, owner.Name, nj.ID)
+	created := []runtime.Object{program, obj}
+
+	// Events are informative, failing to record them does not fail the trace
+	t.RecordEvent(ctx, owner, gvk.Kind, gvk.GroupVersion().String(), apiv1.EventTypeNormal, EventReasonCreated, EventMessage(owner, "created"))
+
+	// The Service is garbage collected along with the trace job
+	if len(objs) > 2 && t.ServiceClient != nil {
+		svc := objs[2].(*apiv1.Service)
+		svc.OwnerReferences = append(svc.OwnerReferences, metav1.OwnerReference{
+			APIVersion: gvk.GroupVersion().String(),
+			Kind:       gvk.Kind,
+			Name:       owner.Name,
+			UID:        owner.UID,
+		})
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		svc, err = t.ServiceClient.Create(svc)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, svc)
+	}
+	return created, nil
+}
+
+// createProgram creates the ConfigMap or the Secret holding the program.
+func (t *TraceJobClient) createProgram(ctx context.Context, program runtime.Object) (runtime.Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s, ok := program.(*apiv1.Secret); ok {
+		if t.SecretClient == nil {
+			return nil, fmt.Errorf(i18n.T(secretClientErrString))
+		}
+		return t.SecretClient.Create(s)
+	}
+	return t.ConfigClient.Create(program.(*apiv1.ConfigMap))
+}
+
+// ownProgram makes the ConfigMap or the Secret holding the program of a trace
+// job garbage collected along with its job, whatever tool deletes it. It is
+// created first so that the program is there when the pod starts.
+func (t *TraceJobClient) ownProgram(ctx context.Context, program runtime.Object, gvk schema.GroupVersionKind, owner metav1.ObjectMeta) (runtime.Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ref := metav1.OwnerReference{
+		APIVersion: gvk.GroupVersion().String(),
+		Kind:       gvk.Kind,
+		Name:       owner.Name,
+		UID:        owner.UID,
+	}
+	if s, ok := program.(*apiv1.Secret); ok {
+		s.OwnerReferences = append(s.OwnerReferences, ref)
+		return t.SecretClient.Update(s)
+	}
+	cm := program.(*apiv1.ConfigMap)
+	cm.OwnerReferences = append(cm.OwnerReferences, ref)
+	return t.ConfigClient.Update(cm)
+}
+
+// Objects provides the objects making up the trace job without creating them:
+// the ConfigMap or the Secret holding the program and the Job, or the CronJob of
+// scheduled traces, followed by the Service of its metrics if any.
+func Objects(nj TraceJob) ([]runtime.Object, error) {
+	program, err := newProgram(nj)
+	if err != nil {
+		return nil, err
+	}
+	objs := []runtime.Object{program}
+	if len(nj.Schedule) > 0 {
+		cj := newCronJob(nj, nj.Name)
+		if err := applyOverrides(&cj.Spec.JobTemplate, nj.Overrides); err != nil {
+			return nil, err
+		}
+		objs = append(objs, cj)
+	} else {
+		job := newJob(nj, nj.Name)
+		if err := applyOverrides(job, nj.Overrides); err != nil {
+			return nil, err
+		}
+		objs = append(objs, job)
+	}
+
+	if nj.MetricsPort > 0 {
+		objs = append(objs, newMetricsService(nj))
+	}
+	return objs, nil
+}
+
+// applyOverrides applies a JSON merge patch to obj, in place.
+func applyOverrides(obj interface{}, overrides string) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	b, err = jsonpatch.MergePatch(b, []byte(overrides))
+	if err != nil {
+		return fmt.Errorf(i18n.T("error applying the overrides: %v"), err)
+	}
+	return json.Unmarshal(b, obj)
+}
+
+func newJob(nj TraceJob, configName string) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: objectMeta(nj),
+		Spec:       newJobSpec(nj, configName),
+	}
+}
+
+func newCronJob(nj TraceJob, configName string) *batchv1beta1.CronJob {
+	cj := &batchv1beta1.CronJob{
+		ObjectMeta: objectMeta(nj),
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule: nj.Schedule,
+			// A new capture never overlaps with a previous one still running
+			ConcurrencyPolicy: batchv1beta1.ForbidConcurrent,
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				ObjectMeta: objectMeta(nj),
+				Spec:       newJobSpec(nj, configName),
+			},
 		},
 	}
+	// Names of the jobs are generated by the cron job controller
+	cj.Spec.JobTemplate.ObjectMeta.Name = ""
+	return cj
+}
+
+func objectMeta(nj TraceJob) metav1.ObjectMeta {
+	annotations := map[string]string{}
+	for k, v := range nj.Annotations {
+		annotations[k] = v
+	}
+	annotations[meta.TraceLabelKey] = nj.Name
+	annotations[meta.TraceIDLabelKey] = string(nj.ID)
+	if len(nj.RequestedBy) > 0 {
+		annotations[meta.RequestedByAnnotationKey] = nj.RequestedBy
+	}
+	labels := map[string]string{}
+	for k, v := range nj.Labels {
+		labels[k] = v
+	}
+	labels[meta.TraceLabelKey] = nj.Name
+	labels[meta.TraceIDLabelKey] = string(nj.ID)
+	if len(nj.Group) > 0 {
+		labels[meta.TraceGroupLabelKey] = nj.Group
+	}
+	return metav1.ObjectMeta{
+		Name:            nj.Name,
+		Namespace:       nj.Namespace,
+		OwnerReferences: nj.OwnerReferences,
+		Labels:          labels,
+		Annotations:     annotations,
+	}
+}
 
+// newConfigMap provides the ConfigMap holding the program, gzipped when it is
+// too large or binary, in which case the runner decompresses it.
+func newConfigMap(nj TraceJob) (*apiv1.ConfigMap, error) {
 	cm := &apiv1.ConfigMap{
-		ObjectMeta: commonMeta,
-		Data: map[string]string{
-			"program.bt": nj.Program,
-		},
+		ObjectMeta: objectMeta(nj),
+	}
+	if len(nj.Program) <= maxProgramSize && utf8.ValidString(nj.Program) {
+		cm.Data = map[string]string{ProgramKey: nj.Program}
+		return cm, nil
 	}
 
-	job := &batchv1.Job{
-		ObjectMeta: commonMeta,
-		Spec: batchv1.JobSpec{
-			TTLSecondsAfterFinished: int32Ptr(5),
-			Parallelism:             int32Ptr(1),
-			Completions:             int32Ptr(1),
-			// This is why your tracing job is being killed after 100 seconds,
-			// someone should work on it to make it configurable and let it run
-			// indefinitely by default.
-			ActiveDeadlineSeconds: int64Ptr(100), // TODO(fntlnz): allow canceling from kubectl and increase this,
-			BackoffLimit:          int32Ptr(1),
-			Template: apiv1.PodTemplateSpec{
-				ObjectMeta: commonMeta,
-				Spec: apiv1.PodSpec{
-					Volumes: []apiv1.Volume{
-						apiv1.Volume{
-							Name: "program",
-							VolumeSource: apiv1.VolumeSource{
-								ConfigMap: &apiv1.ConfigMapVolumeSource{
-									LocalObjectReference: apiv1.LocalObjectReference{
-										Name: cm.Name,
-									},
-								},
-							},
-						},
-						apiv1.Volume{
-							Name: "modules",
-							VolumeSource: apiv1.VolumeSource{
-								HostPath: &apiv1.HostPathVolumeSource{
-									Path: "/lib/modules",
-								},
-							},
-						},
-						apiv1.Volume{
-							Name: "sys",
-							VolumeSource: apiv1.VolumeSource{
-								HostPath: &apiv1.HostPathVolumeSource{
-									Path: "/sys",
-								},
+	var b bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&b, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write([]byte(nj.Program)); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if b.Len() > maxProgramSize {
+		return nil, fmt.Errorf(i18n.T(programSizeErrString), b.Len(), maxProgramSize)
+	}
+	cm.BinaryData = map[string][]byte{CompressedProgramKey: b.Bytes()}
+	return cm, nil
+}
+
+// newProgram provides the ConfigMap holding the program, or the Secret for
+// trace jobs having ProgramSecret, with the same keys.
+func newProgram(nj TraceJob) (runtime.Object, error) {
+	cm, err := newConfigMap(nj)
+	if err != nil || !nj.ProgramSecret {
+		return cm, err
+	}
+	s := &apiv1.Secret{
+		ObjectMeta: cm.ObjectMeta,
+		Type:       apiv1.SecretTypeOpaque,
+		Data:       map[string][]byte{},
+	}
+	for k, v := range cm.Data {
+		s.Data[k] = []byte(v)
+	}
+	for k, v := range cm.BinaryData {
+		s.Data[k] = v
+	}
+	return s, nil
+}
+
+// SecretProgram provides the program stored in the Secret of a trace job.
+func SecretProgram(s apiv1.Secret) (string, error) {
+	return Program(apiv1.ConfigMap{
+		Data:       map[string]string{ProgramKey: string(s.Data[ProgramKey])},
+		BinaryData: s.Data,
+	})
+}
+
+// Program provides the program stored in the ConfigMap of a trace job.
+func Program(cm apiv1.ConfigMap) (string, error) {
+	if b, ok := cm.BinaryData[CompressedProgramKey]; ok {
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return "", err
+		}
+		program, err := ioutil.ReadAll(zr)
+		return string(program), err
+	}
+	return cm.Data[ProgramKey], nil
+}
+
+func newJobSpec(nj TraceJob, configName string) batchv1.JobSpec {
+	tracer := nj.Tracer
+	if len(tracer) == 0 {
+		tracer = BpftraceTracer
+	}
+
+	traceCmd := []string{
+		"/bin/trace-runner",
+		"--tracer=" + string(tracer),
+		"--program=/programs/" + ProgramKey,
+	}
+
+	if len(nj.ContainerID) > 0 {
+		traceCmd = append(traceCmd, "--container-id="+nj.ContainerID)
+	}
+	if len(nj.Unit) > 0 {
+		traceCmd = append(traceCmd, "--unit="+nj.Unit)
+	}
+	if nj.CgroupFilter {
+		traceCmd = append(traceCmd, "--cgroup-filter")
+	}
+	if len(nj.Interface) > 0 {
+		traceCmd = append(traceCmd, "--interface="+nj.Interface)
+	}
+	if len(nj.Direction) > 0 {
+		traceCmd = append(traceCmd, "--direction="+nj.Direction)
+	}
+	if len(nj.Section) > 0 {
+		traceCmd = append(traceCmd, "--section="+nj.Section)
+	}
+	memlock := nj.Memlock
+	if len(memlock) == 0 && canRaiseMemlock(nj) {
+		memlock = DefaultMemlock
+	}
+	if len(memlock) > 0 {
+		traceCmd = append(traceCmd, "--memlock="+memlock)
+	}
+
+	image := nj.ImageNameTag
+	if len(image) == 0 {
+		image = meta.ImageNameTag
+	}
+
+	var pullSecrets []apiv1.LocalObjectReference
+	for _, s := range nj.ImagePullSecrets {
+		pullSecrets = append(pullSecrets, apiv1.LocalObjectReference{Name: s})
+	}
+
+	securityContext := &apiv1.SecurityContext{
+		Privileged: boolPtr(true),
+	}
+	if len(nj.Capabilities) > 0 {
+		securityContext = &apiv1.SecurityContext{
+			Privileged:               boolPtr(false),
+			AllowPrivilegeEscalation: boolPtr(false),
+			Capabilities: &apiv1.Capabilities{
+				Drop: []apiv1.Capability{"ALL"},
+				Add:  nj.Capabilities,
+			},
+		}
+	}
+	securityContext.RunAsUser = nj.RunAsUser
+	if len(nj.SELinuxType) > 0 {
+		securityContext.SELinuxOptions = &apiv1.SELinuxOptions{Type: nj.SELinuxType}
+	}
+
+	// Seccomp and AppArmor profiles are only declared through annotations.
+	podMeta := objectMeta(nj)
+	if len(nj.SeccompProfile) > 0 {
+		podMeta.Annotations[apiv1.SeccompPodAnnotationKey] = nj.SeccompProfile
+	}
+	if len(nj.AppArmorProfile) > 0 {
+		podMeta.Annotations[appArmorAnnotationKeyPrefix+nj.Name] = nj.AppArmorProfile
+	}
+	// Prometheus discovers the exporters of trace pods through these annotations.
+	if nj.MetricsPort > 0 {
+		podMeta.Annotations["prometheus.io/scrape"] = "true"
+		podMeta.Annotations["prometheus.io/port"] = fmt.Sprintf("%d", nj.MetricsPort)
+		podMeta.Annotations["prometheus.io/path"] = "/metrics"
+	}
+
+	// The interfaces of the node are only visible from the host network namespace.
+	hostNetwork := nj.HostNetwork || tracer.IsNetwork()
+	// Pods on the host network only resolve cluster names with this policy.
+	dnsPolicy := apiv1.DNSClusterFirst
+	if hostNetwork {
+		dnsPolicy = apiv1.DNSClusterFirstWithHostNet
+	}
+
+	// Traces without a duration run until they are deleted.
+	var activeDeadline *int64
+	if nj.Duration.Duration > 0 {
+		traceCmd = append(traceCmd, "--duration="+nj.Duration.Duration.String())
+		// Leave the tracer some room to print its results once interrupted.
+		activeDeadline = int64Ptr(int64((nj.Duration.Duration + deadlineGracePeriod).Seconds()))
+	}
+
+	if nj.Check {
+		traceCmd = append(traceCmd, "--check")
+	}
+	if nj.MetricsPort > 0 {
+		traceCmd = append(traceCmd, "--output-format="+OutputFormatJSON, "--metrics-output="+metricsPath+"/output.json")
+	} else if len(nj.OutputFormat) > 0 {
+		traceCmd = append(traceCmd, "--output-format="+nj.OutputFormat)
+	}
+
+	if len(nj.ResultsClaim) > 0 {
+		traceCmd = append(traceCmd, "--results-dir="+ResultsPath+"/"+string(nj.ID))
+	}
+	if len(nj.UploadURL) > 0 {
+		traceCmd = append(traceCmd, "--upload-url="+nj.UploadURL)
+	}
+	if len(nj.NotifyURL) > 0 {
+		traceCmd = append(traceCmd, "--notify-url="+nj.NotifyURL)
+	}
+
+	// Program arguments come after all the flags of the runner
+	if len(nj.Args) > 0 {
+		traceCmd = append(append(traceCmd, "--"), nj.Args...)
+	}
+
+	ttl := int32Ptr(int32(DefaultTTL.Seconds()))
+	if nj.TTL != nil {
+		ttl = nil
+		if nj.TTL.Duration > 0 {
+			ttl = int32Ptr(int32(nj.TTL.Duration.Seconds()))
+		}
+	}
+
+	backoffLimit := int32Ptr(DefaultBackoffLimit)
+	if nj.BackoffLimit != nil {
+		backoffLimit = int32Ptr(*nj.BackoffLimit)
+	}
+	restartPolicy := nj.RestartPolicy
+	if len(restartPolicy) == 0 {
+		restartPolicy = apiv1.RestartPolicyNever
+	}
+
+	spec := batchv1.JobSpec{
+		TTLSecondsAfterFinished: ttl,
+		Parallelism:             int32Ptr(1),
+		Completions:             int32Ptr(1),
+		ActiveDeadlineSeconds:   activeDeadline,
+		BackoffLimit:            backoffLimit,
+		Template: apiv1.PodTemplateSpec{
+			ObjectMeta: podMeta,
+			Spec: apiv1.PodSpec{
+				// The container and unit processes are only visible from the host PID namespace.
+				HostPID:            nj.HostPID || len(nj.ContainerID) > 0 || len(nj.Unit) > 0,
+				HostNetwork:        hostNetwork,
+				DNSPolicy:          dnsPolicy,
+				ImagePullSecrets:   pullSecrets,
+				ServiceAccountName: nj.ServiceAccount,
+				Tolerations:        nj.Tolerations,
+				PriorityClassName:  nj.PriorityClassName,
+				Volumes: []apiv1.Volume{
+					apiv1.Volume{
+						Name:         "program",
+						VolumeSource: programVolumeSource(nj, configName),
+					},
+					apiv1.Volume{
+						Name: "sys",
+						VolumeSource: apiv1.VolumeSource{
+							HostPath: &apiv1.HostPathVolumeSource{
+								Path: "/sys",
 							},
 						},
 					},
-					Containers: []apiv1.Container{
-						apiv1.Container{
-							Name:    nj.Name,
-							Image:   "quay.io/fntlnz/kubectl-trace-bpftrace:master", //TODO(fntlnz): yes this should be configurable!
-							Command: bpfTraceCmd,
-							TTY:     true,
-							Stdin:   true,
-							VolumeMounts: []apiv1.VolumeMount{
-								apiv1.VolumeMount{
-									Name:      "program",
-									MountPath: "/programs",
-									ReadOnly:  true,
-								},
-								apiv1.VolumeMount{
-									Name:      "modules",
-									MountPath: "/lib/modules",
-									ReadOnly:  true,
-								},
-								apiv1.VolumeMount{
-									Name:      "sys",
-									MountPath: "/sys",
-									ReadOnly:  true,
-								},
+				},
+				Containers: []apiv1.Container{
+					apiv1.Container{
+						Name:            nj.Name,
+						Image:           image,
+						ImagePullPolicy: nj.ImagePullPolicy,
+						Resources:       nj.Resources,
+						Env:             env(nj),
+						Command:         traceCmd,
+						TTY:             true,
+						Stdin:           true,
+						VolumeMounts: []apiv1.VolumeMount{
+							apiv1.VolumeMount{
+								Name:      "program",
+								MountPath: "/programs",
+								ReadOnly:  true,
 							},
-							SecurityContext: &apiv1.SecurityContext{
-								Privileged: boolPtr(true),
+							apiv1.VolumeMount{
+								Name:      "sys",
+								MountPath: "/sys",
+								ReadOnly:  true,
 							},
 						},
+						SecurityContext: securityContext,
 					},
-					RestartPolicy: "Never",
-					Affinity: &apiv1.Affinity{
-						NodeAffinity: &apiv1.NodeAffinity{
-							RequiredDuringSchedulingIgnoredDuringExecution: &apiv1.NodeSelector{
-								NodeSelectorTerms: []apiv1.NodeSelectorTerm{
-									apiv1.NodeSelectorTerm{
-										MatchExpressions: []apiv1.NodeSelectorRequirement{
-											apiv1.NodeSelectorRequirement{
-												Key:      "kubernetes.io/hostname",
-												Operator: apiv1.NodeSelectorOpIn,
-												Values:   []string{nj.Hostname},
-											},
+				},
+				RestartPolicy: restartPolicy,
+				Affinity: &apiv1.Affinity{
+					NodeAffinity: &apiv1.NodeAffinity{
+						RequiredDuringSchedulingIgnoredDuringExecution: &apiv1.NodeSelector{
+							NodeSelectorTerms: []apiv1.NodeSelectorTerm{
+								apiv1.NodeSelectorTerm{
+									MatchExpressions: []apiv1.NodeSelectorRequirement{
+										apiv1.NodeSelectorRequirement{
+											Key:      "kubernetes.io/hostname",
+											Operator: apiv1.NodeSelectorOpIn,
+											Values:   []string{nj.Hostname},
 										},
 									},
 								},
@@ -293,10 +1270,226 @@ func (t *TraceJobClient) CreateJob(nj TraceJob) (*batchv1.Job, error) {
 		},
 	}
 
-	if _, err := t.ConfigClient.Create(cm); err != nil {
-		return nil, err
+	c := &spec.Template.Spec.Containers[0]
+
+	// The sysfs of the container exposes the BTF of the kernel already
+	if nj.Restricted {
+		spec.Template.Spec.HostPID = false
+		spec.Template.Spec.Volumes = spec.Template.Spec.Volumes[:1]
+		c.VolumeMounts = c.VolumeMounts[:1]
+	}
+
+	// Without BTF, bpftrace needs the kernel headers of the node
+	if !nj.BTF && !nj.Restricted {
+		headers := []struct{ name, path string }{
+			{"modules", "/lib/modules"},
+			{"usrsrc", "/usr/src"},
+		}
+		for _, h := range headers {
+			spec.Template.Spec.Volumes = append(spec.Template.Spec.Volumes, apiv1.Volume{
+				Name: h.name,
+				VolumeSource: apiv1.VolumeSource{
+					HostPath: &apiv1.HostPathVolumeSource{Path: h.path},
+				},
+			})
+			c.VolumeMounts = append(c.VolumeMounts, apiv1.VolumeMount{
+				Name:      h.name,
+				MountPath: h.path,
+				ReadOnly:  true,
+			})
+		}
+	}
+
+	if nj.FetchHeaders {
+		headersCmd := []string{"/bin/trace-runner", "headers", "--dest=" + headersPath}
+		if len(nj.HeadersURL) > 0 {
+			headersCmd = append(headersCmd, "--url="+nj.HeadersURL)
+		}
+		headersMount := apiv1.VolumeMount{
+			Name:      "headers",
+			MountPath: headersPath,
+		}
+
+		// The os-release file of the host tells where to download headers from
+		etcMount := apiv1.VolumeMount{
+			Name:      "hostetc",
+			MountPath: "/host/etc",
+			ReadOnly:  true,
+		}
+
+		spec.Template.Spec.Volumes = append(spec.Template.Spec.Volumes,
+			apiv1.Volume{
+				Name: "headers",
+				VolumeSource: apiv1.VolumeSource{
+					EmptyDir: &apiv1.EmptyDirVolumeSource{},
+				},
+			},
+			apiv1.Volume{
+				Name: "hostetc",
+				VolumeSource: apiv1.VolumeSource{
+					HostPath: &apiv1.HostPathVolumeSource{Path: "/etc"},
+				},
+			},
+		)
+		// Loading the kheaders module requires the modules and privileges
+		spec.Template.Spec.InitContainers = []apiv1.Container{
+			apiv1.Container{
+				Name:            "headers",
+				Image:           image,
+				ImagePullPolicy: nj.ImagePullPolicy,
+				Command:         headersCmd,
+				VolumeMounts:    append([]apiv1.VolumeMount{headersMount, etcMount}, c.VolumeMounts...),
+				SecurityContext: &apiv1.SecurityContext{
+					Privileged: boolPtr(true),
+				},
+			},
+		}
+		headersMount.ReadOnly = true
+		c.VolumeMounts = append(c.VolumeMounts, headersMount)
+	}
+
+	if len(nj.ResultsClaim) > 0 {
+		spec.Template.Spec.Volumes = append(spec.Template.Spec.Volumes, apiv1.Volume{
+			Name: ResultsVolume,
+			VolumeSource: apiv1.VolumeSource{
+				PersistentVolumeClaim: &apiv1.PersistentVolumeClaimVolumeSource{
+					ClaimName: nj.ResultsClaim,
+				},
+			},
+		})
+		c.VolumeMounts = append(c.VolumeMounts, apiv1.VolumeMount{
+			Name:      ResultsVolume,
+			MountPath: ResultsPath,
+		})
+	}
+
+	if len(nj.UploadSecret) > 0 {
+		c.EnvFrom = append(c.EnvFrom, apiv1.EnvFromSource{
+			SecretRef: &apiv1.SecretEnvSource{
+				LocalObjectReference: apiv1.LocalObjectReference{Name: nj.UploadSecret},
+			},
+		})
+	}
+
+	// The exporter comes after the tracer container, which stays the first one
+	if nj.MetricsPort > 0 {
+		metricsMount := apiv1.VolumeMount{
+			Name:      "metrics",
+			MountPath: metricsPath,
+		}
+		spec.Template.Spec.Volumes = append(spec.Template.Spec.Volumes, apiv1.Volume{
+			Name: "metrics",
+			VolumeSource: apiv1.VolumeSource{
+				EmptyDir: &apiv1.EmptyDirVolumeSource{},
+			},
+		})
+		c.VolumeMounts = append(c.VolumeMounts, metricsMount)
+		metricsMount.ReadOnly = true
+		spec.Template.Spec.Containers = append(spec.Template.Spec.Containers, apiv1.Container{
+			Name:            "exporter",
+			Image:           image,
+			ImagePullPolicy: nj.ImagePullPolicy,
+			Command: []string{
+				"/bin/trace-runner", "exporter",
+				"--input=" + metricsPath + "/output.json",
+				fmt.Sprintf("--port=%d", nj.MetricsPort),
+			},
+			Ports: []apiv1.ContainerPort{
+				apiv1.ContainerPort{
+					Name:          "metrics",
+					ContainerPort: nj.MetricsPort,
+				},
+			},
+			VolumeMounts: []apiv1.VolumeMount{metricsMount},
+		})
+		c = &spec.Template.Spec.Containers[0]
+	}
+
+	// Volumes and mounts requested for the trace come after the ones it requires
+	spec.Template.Spec.Volumes = append(spec.Template.Spec.Volumes, nj.Volumes...)
+	c.VolumeMounts = append(c.VolumeMounts, nj.VolumeMounts...)
+
+	return spec
+}
+
+// newMetricsService provides the Service exposing the metrics of the trace
+// job, selecting its pods.
+func newMetricsService(nj TraceJob) *apiv1.Service {
+	return &apiv1.Service{
+		ObjectMeta: objectMeta(nj),
+		Spec: apiv1.ServiceSpec{
+			Selector: map[string]string{
+				meta.TraceIDLabelKey: string(nj.ID),
+			},
+			Ports: []apiv1.ServicePort{
+				apiv1.ServicePort{
+					Name:       "metrics",
+					Port:       nj.MetricsPort,
+					TargetPort: intstr.FromString("metrics"),
+				},
+			},
+		},
+	}
+}
+
+// env provides the environment of the tracer container, describing the trace
+// context through the downward API before the variables of the trace.
+func env(nj TraceJob) []apiv1.EnvVar {
+	env := []apiv1.EnvVar{
+		apiv1.EnvVar{
+			Name: "NODE_NAME",
+			ValueFrom: &apiv1.EnvVarSource{
+				FieldRef: &apiv1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+			},
+		},
+		apiv1.EnvVar{
+			Name: "TRACE_ID",
+			ValueFrom: &apiv1.EnvVarSource{
+				FieldRef: &apiv1.ObjectFieldSelector{FieldPath: fmt.Sprintf("metadata.labels['%s']", meta.TraceIDLabelKey)},
+			},
+		},
+	}
+	if len(nj.TargetPod) > 0 {
+		env = append(env, apiv1.EnvVar{Name: "TARGET_POD", Value: nj.TargetPod})
+	}
+	if nj.FetchHeaders {
+		env = append(env, apiv1.EnvVar{Name: "BPFTRACE_KERNEL_SOURCE", Value: headersPath + "/build"})
+	}
+	return append(env, nj.Env...)
+}
+
+// programVolumeSource provides the source of the volume of the program, from
+// its ConfigMap or its Secret.
+func programVolumeSource(nj TraceJob, configName string) apiv1.VolumeSource {
+	if nj.ProgramSecret {
+		return apiv1.VolumeSource{
+			Secret: &apiv1.SecretVolumeSource{
+				SecretName: configName,
+			},
+		}
+	}
+	return apiv1.VolumeSource{
+		ConfigMap: &apiv1.ConfigMapVolumeSource{
+			LocalObjectReference: apiv1.LocalObjectReference{
+				Name: configName,
+			},
+		},
+	}
+}
+
+// canRaiseMemlock tells whether the tracer can raise its RLIMIT_MEMLOCK, which
+// requires SYS_RESOURCE. Tracers without it run on kernels from 5.11 anyway,
+// which do not count the maps against it.
+func canRaiseMemlock(nj TraceJob) bool {
+	if len(nj.Capabilities) == 0 {
+		return true
+	}
+	for _, c := range nj.Capabilities {
+		if c == "SYS_RESOURCE" {
+			return true
+		}
 	}
-	return t.JobClient.Create(job)
+	return false
 }
 
 func int32Ptr(i int32) *int32 { return &i }
@@ -306,40 +1499,40 @@ func boolPtr(b bool) *bool    { return &b }
 func jobHostname(j batchv1.Job) (string, error) {
 	aff := j.Spec.Template.Spec.Affinity
 	if aff == nil {
-		return "", fmt.Errorf("affinity not found for job")
+		return "", fmt.Errorf(i18n.T("affinity not found for job"))
 	}
 
 	nodeAff := aff.NodeAffinity
 
 	if nodeAff == nil {
-		return "", fmt.Errorf("node affinity not found for job")
+		return "", fmt.Errorf(i18n.T("node affinity not found for job"))
 	}
 
 	requiredScheduling := nodeAff.RequiredDuringSchedulingIgnoredDuringExecution
 
 	if requiredScheduling == nil {
-		return "", fmt.Errorf("node affinity RequiredDuringSchedulingIgnoredDuringExecution not found for job")
+		return "", fmt.Errorf(i18n.T("node affinity RequiredDuringSchedulingIgnoredDuringExecution not found for job"))
 	}
 	nst := requiredScheduling.NodeSelectorTerms
 	if len(nst) == 0 {
-		return "", fmt.Errorf("node selector terms are empty in node affinity for job")
+		return "", fmt.Errorf(i18n.T("node selector terms are empty in node affinity for job"))
 	}
 
 	me := nst[0].MatchExpressions
 
 	if len(me) == 0 {
-		return "", fmt.Errorf("node selector terms match expressions are empty in node affinity for job")
+		return "", fmt.Errorf(i18n.T("node selector terms match expressions are empty in node affinity for job"))
 	}
 
 	for _, v := range me {
 		if v.Key == "kubernetes.io/hostname" {
 			if len(v.Values) == 0 {
-				return "", fmt.Errorf("hostname affinity found but no values in it for job")
+				return "", fmt.Errorf(i18n.T("hostname affinity found but no values in it for job"))
 			}
 
 			return v.Values[0], nil
 		}
 	}
 
-	return "", fmt.Errorf("hostname not found for job")
+	return "", fmt.Errorf(i18n.T("hostname not found for job"))
 }
@@ -0,0 +1,49 @@
+package tracejob
+
+import (
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// startingReasons are the waiting reasons of containers starting normally.
+var startingReasons = map[string]bool{
+	"ContainerCreating": true,
+	"PodInitializing":   true,
+}
+
+// TracerExitCode provides the exit code of the tracer container of the pod of a
+// trace job once terminated, nil while it runs.
+func TracerExitCode(pod apiv1.Pod) *int32 {
+	for _, s := range pod.Status.ContainerStatuses {
+		if t := s.State.Terminated; t != nil && s.Name == pod.Labels["job-name"] {
+			code := t.ExitCode
+			return &code
+		}
+	}
+	return nil
+}
+
+// PodFailureReason provides why the pod of a trace job cannot start or has
+// failed, like ImagePullBackOff or OOMKilled, it is empty when nothing went wrong.
+func PodFailureReason(pod apiv1.Pod) string {
+	// Evicted pods have their reason set on the pod itself
+	if len(pod.Status.Reason) > 0 {
+		return pod.Status.Reason
+	}
+
+	statuses := append([]apiv1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, s := range statuses {
+		if w := s.State.Waiting; w != nil && len(w.Reason) > 0 && !startingReasons[w.Reason] {
+			return w.Reason
+		}
+		if t := s.State.Terminated; t != nil && t.ExitCode != 0 {
+			if len(t.Reason) == 0 {
+				return fmt.Sprintf("exit code %d", t.ExitCode)
+			}
+			return fmt.Sprintf("%s, exit code %d", t.Reason, t.ExitCode)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package tracejob
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+	"github.com/fntlnz/kubectl-trace/pkg/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// TraceJobResource identifies the TraceJob custom resource, whose spec is a TraceJob.
+var TraceJobResource = schema.GroupVersionResource{
+	Group:    meta.TraceJobGroup,
+	Version:  meta.TraceJobVersion,
+	Resource: "tracejobs",
+}
+
+// TraceJobPhase is the phase of a TraceJob custom resource reconciled by the controller.
+type TraceJobPhase string
+
+const (
+	// TraceJobPhaseCreated means the trace job has been created for the resource.
+	TraceJobPhaseCreated TraceJobPhase = "Created"
+	// TraceJobPhaseFailed means the trace job could not be created for the resource.
+	TraceJobPhaseFailed TraceJobPhase = "Failed"
+)
+
+// ToUnstructured converts the trace job into a TraceJob custom resource.
+func (nj TraceJob) ToUnstructured() (*unstructured.Unstructured, error) {
+	b, err := json.Marshal(nj)
+	if err != nil {
+		return nil, err
+	}
+	spec := map[string]interface{}{}
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return nil, err
+	}
+
+	u := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": spec,
+		},
+	}
+	u.SetAPIVersion(TraceJobResource.GroupVersion().String())
+	u.SetKind(meta.TraceJobKind)
+	u.SetName(nj.Name)
+	u.SetNamespace(nj.Namespace)
+	u.SetLabels(map[string]string{
+		meta.TraceLabelKey:   nj.Name,
+		meta.TraceIDLabelKey: string(nj.ID),
+	})
+	return u, nil
+}
+
+// FromUnstructured reads the trace job declared by a TraceJob custom resource.
+// Resources created without kubectl-trace get their trace ID from their UID.
+func FromUnstructured(u *unstructured.Unstructured) (TraceJob, error) {
+	nj := TraceJob{}
+	spec, ok := u.Object["spec"]
+	if !ok {
+		return nj, fmt.Errorf(i18n.T("spec not found in %s %s"), u.GetKind(), u.GetName())
+	}
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return nj, err
+	}
+	if err := json.Unmarshal(b, &nj); err != nil {
+		return nj, err
+	}
+
+	nj.Name = u.GetName()
+	if !meta.IsObjectName(nj.Name) {
+		nj.Name = meta.ObjectNamePrefix + nj.Name
+	}
+	nj.Namespace = u.GetNamespace()
+	nj.ID = types.UID(u.GetLabels()[meta.TraceIDLabelKey])
+	if len(nj.ID) == 0 {
+		nj.ID = u.GetUID()
+	}
+	return nj, nil
+}
+
+// ControllerReference is the owner reference making the objects of a trace
+// job garbage collected along with the TraceJob custom resource.
+func ControllerReference(u *unstructured.Unstructured) metav1.OwnerReference {
+	controller := true
+	return metav1.OwnerReference{
+		APIVersion: u.GetAPIVersion(),
+		Kind:       u.GetKind(),
+		Name:       u.GetName(),
+		UID:        u.GetUID(),
+		Controller: &controller,
+	}
+}
@@ -0,0 +1,229 @@
+package upload
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fntlnz/kubectl-trace/pkg/i18n"
+)
+
+const (
+	schemeS3    = "s3"
+	schemeGCS   = "gs"
+	schemeAzure = "azblob"
+
+	gcsEndpoint = "https://storage.googleapis.com"
+
+	urlErrString         = "invalid upload URL %s, must be one of s3://BUCKET/PREFIX, gs://BUCKET/PREFIX or azblob://ACCOUNT/CONTAINER/PREFIX"
+	credentialsErrString = "missing %s in the environment to upload to %s"
+	uploadErrString      = "error uploading %s: %s"
+)
+
+// Uploader uploads objects to a bucket, under the prefix of its URL.
+type Uploader struct {
+	// endpoint is the URL of the bucket the object keys are appended to
+	endpoint string
+	// sign signs the requests, e.g. with AWS Signature Version 4
+	sign   func(r *http.Request, body []byte) error
+	client *http.Client
+}
+
+// New provides an Uploader for the URL of a bucket with an optional prefix,
+// s3://BUCKET/PREFIX, gs://BUCKET/PREFIX or azblob://ACCOUNT/CONTAINER/PREFIX.
+// The credentials are looked up with env:
+//   - S3: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_REGION and optionally
+//     AWS_ENDPOINT_URL for S3 compatible storages
+//   - GCS: the HMAC keys of a service account as GCS_ACCESS_KEY_ID and GCS_SECRET_ACCESS_KEY
+//   - Azure: a SAS token of the container as AZURE_STORAGE_SAS_TOKEN
+func New(rawURL string, env func(string) string) (*Uploader, error) {
+	u, prefix, err := parseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := func(keys ...string) (map[string]string, error) {
+		values := map[string]string{}
+		for _, k := range keys {
+			values[k] = env(k)
+			if len(values[k]) == 0 {
+				return nil, fmt.Errorf(i18n.T(credentialsErrString), k, rawURL)
+			}
+		}
+		return values, nil
+	}
+
+	switch u.Scheme {
+	case schemeS3:
+		creds, err := lookup("AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_REGION")
+		if err != nil {
+			return nil, err
+		}
+		endpoint := env("AWS_ENDPOINT_URL")
+		if len(endpoint) == 0 {
+			endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", creds["AWS_REGION"])
+		}
+		return newSigV4Uploader(endpoint, u.Host, prefix, creds["AWS_ACCESS_KEY_ID"], creds["AWS_SECRET_ACCESS_KEY"], creds["AWS_REGION"]), nil
+	case schemeGCS:
+		// GCS is interoperable with S3 through HMAC keys
+		creds, err := lookup("GCS_ACCESS_KEY_ID", "GCS_SECRET_ACCESS_KEY")
+		if err != nil {
+			return nil, err
+		}
+		return newSigV4Uploader(gcsEndpoint, u.Host, prefix, creds["GCS_ACCESS_KEY_ID"], creds["GCS_SECRET_ACCESS_KEY"], "auto"), nil
+	case schemeAzure:
+		parts := strings.SplitN(prefix, "/", 2)
+		creds, err := lookup("AZURE_STORAGE_SAS_TOKEN")
+		if err != nil {
+			return nil, err
+		}
+		endpoint := fmt.Sprintf("https://%s.blob.core.windows.net/%s", u.Host, parts[0])
+		if len(parts) > 1 {
+			endpoint += "/" + parts[1]
+		}
+		sas := strings.TrimPrefix(creds["AZURE_STORAGE_SAS_TOKEN"], "?")
+		return &Uploader{
+			endpoint: endpoint,
+			sign: func(r *http.Request, body []byte) error {
+				r.URL.RawQuery = sas
+				r.Header.Set("x-ms-blob-type", "BlockBlob")
+				return nil
+			},
+			client: http.DefaultClient,
+		}, nil
+	}
+	return nil, fmt.Errorf(i18n.T(urlErrString), rawURL)
+}
+
+// ValidateURL validates the URL of a bucket without looking up the credentials.
+func ValidateURL(rawURL string) error {
+	_, _, err := parseURL(rawURL)
+	return err
+}
+
+func parseURL(rawURL string) (*url.URL, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || len(u.Host) == 0 {
+		return nil, "", fmt.Errorf(i18n.T(urlErrString), rawURL)
+	}
+	prefix := strings.Trim(u.Path, "/")
+	switch u.Scheme {
+	case schemeS3, schemeGCS:
+		return u, prefix, nil
+	case schemeAzure:
+		// The container comes first in the path
+		if len(prefix) > 0 {
+			return u, prefix, nil
+		}
+	}
+	return nil, "", fmt.Errorf(i18n.T(urlErrString), rawURL)
+}
+
+func newSigV4Uploader(endpoint, bucket, prefix, accessKey, secretKey, region string) *Uploader {
+	endpoint = strings.TrimSuffix(endpoint, "/") + "/" + bucket
+	if len(prefix) > 0 {
+		endpoint += "/" + prefix
+	}
+	return &Uploader{
+		endpoint: endpoint,
+		sign: func(r *http.Request, body []byte) error {
+			// S3 requires the hash of the payload in the headers as well
+			r.Header.Set("X-Amz-Content-Sha256", sha256Hex(body))
+			signV4(r, body, accessKey, secretKey, region, "s3", time.Now())
+			return nil
+		},
+		client: http.DefaultClient,
+	}
+}
+
+// Upload uploads an object under the prefix of the bucket.
+func (u *Uploader) Upload(key string, body []byte) error {
+	target := u.endpoint + "/" + strings.TrimPrefix(key, "/")
+	r, err := http.NewRequest(http.MethodPut, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if err := u.sign(r, body); err != nil {
+		return err
+	}
+	resp, err := u.client.Do(r)
+	if err != nil {
+		return fmt.Errorf(i18n.T(uploadErrString), key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf(i18n.T(uploadErrString), key, fmt.Sprintf("%s %s", resp.Status, bytes.TrimSpace(msg)))
+	}
+	return nil
+}
+
+// signV4 signs a request with AWS Signature Version 4 in its headers.
+func signV4(r *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	r.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": r.URL.Host}
+	for k, v := range r.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := []string{}
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	canonicalHeaders := ""
+	for _, k := range names {
+		canonicalHeaders += k + ":" + headers[k] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := r.URL.EscapedPath()
+	if len(path) == 0 {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		path,
+		r.URL.Query().Encode(),
+		canonicalHeaders,
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	r.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,62 @@
+package upload
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla case of the AWS Signature Version 4 test suite
+	r, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signV4(r, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := r.Header.Get("Authorization"); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	env := func(values map[string]string) func(string) string {
+		return func(k string) string { return values[k] }
+	}
+	aws := env(map[string]string{"AWS_ACCESS_KEY_ID": "id", "AWS_SECRET_ACCESS_KEY": "secret", "AWS_REGION": "eu-west-1"})
+	gcs := env(map[string]string{"GCS_ACCESS_KEY_ID": "id", "GCS_SECRET_ACCESS_KEY": "secret"})
+	azure := env(map[string]string{"AZURE_STORAGE_SAS_TOKEN": "?sv=2020&sig=abc"})
+
+	tests := []struct {
+		url      string
+		env      func(string) string
+		endpoint string
+		err      bool
+	}{
+		{"s3://traces/prod/", aws, "https://s3.eu-west-1.amazonaws.com/traces/prod", false},
+		{"s3://traces", aws, "https://s3.eu-west-1.amazonaws.com/traces", false},
+		{"s3://traces", gcs, "", true},
+		{"gs://traces/prod", gcs, "https://storage.googleapis.com/traces/prod", false},
+		{"azblob://account/traces/prod", azure, "https://account.blob.core.windows.net/traces/prod", false},
+		{"azblob://account", azure, "", true},
+		{"ftp://traces", aws, "", true},
+		{"traces", aws, "", true},
+	}
+	for _, tt := range tests {
+		u, err := New(tt.url, tt.env)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.url)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.url, err)
+			continue
+		}
+		if u.endpoint != tt.endpoint {
+			t.Errorf("%s: expected endpoint %s, got %s", tt.url, tt.endpoint, u.endpoint)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+// Package version tells the version of the plugin, set at build time with
+// -ldflags "-X github.com/fntlnz/kubectl-trace/pkg/version.Version=v0.1.0".
+package version
+
+var (
+	// Version is the release of the plugin, dev when built from source.
+	Version = "dev"
+	// GitCommit is the commit the plugin was built from, empty when unknown.
+	GitCommit = ""
+)